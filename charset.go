@@ -0,0 +1,134 @@
+package goupnp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// NewCharsetReader returns a reader that converts input from the charset to
+// UTF-8. It supports the charsets that devices are known to use: UTF-8,
+// US-ASCII, ISO-8859-1 and windows-1252. As browsers do, US-ASCII and
+// ISO-8859-1 are decoded as windows-1252, which they are commonly mislabelled
+// as. It has the signature of xml.Decoder.CharsetReader, and is used when
+// fetching descriptions unless FetchConfig.CharsetReader or
+// CharsetReaderDefault is set.
+func NewCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "utf-8", "utf8", "unicode-1-1-utf-8":
+		return input, nil
+	case "us-ascii", "ascii", "ansi_x3.4-1968", "iso-ir-6", "cp367", "ibm367",
+		"iso-8859-1", "iso8859-1", "iso_8859-1", "iso88591", "iso-ir-100", "latin1", "l1", "cp819", "ibm819",
+		"windows-1252", "cp1252", "x-cp1252":
+		return &windows1252Reader{r: bufio.NewReader(input)}, nil
+	}
+	return nil, fmt.Errorf("goupnp: unsupported charset %q", charset)
+}
+
+// windows1252High maps windows-1252 bytes 0x80 to 0x9F to runes. Bytes that
+// are undefined in windows-1252 map to the C1 control characters, as do the
+// other bytes in ISO-8859-1. Bytes from 0xA0 up are the same as ISO-8859-1.
+var windows1252High = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡',
+	'ˆ', '‰', 'Š', '‹', 'Œ', '\u008D', 'Ž', '\u008F',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—',
+	'˜', '™', 'š', '›', 'œ', '\u009D', 'ž', 'Ÿ',
+}
+
+// windows1252Reader converts windows-1252 from r to UTF-8.
+type windows1252Reader struct {
+	r       *bufio.Reader
+	buf     [utf8.UTFMax]byte
+	pending []byte // The part of buf that is still to be read.
+}
+
+func (wr *windows1252Reader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(wr.pending) > 0 {
+			copied := copy(p[n:], wr.pending)
+			wr.pending = wr.pending[copied:]
+			n += copied
+			continue
+		}
+		if n > 0 && wr.r.Buffered() == 0 {
+			// Avoid blocking when some has already been read.
+			break
+		}
+		b, err := wr.r.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		if b < utf8.RuneSelf {
+			p[n] = b
+			n++
+			continue
+		}
+		r := rune(b)
+		if b < 0xA0 {
+			r = windows1252High[b-0x80]
+		}
+		wr.pending = wr.buf[:utf8.EncodeRune(wr.buf[:], r)]
+	}
+	return n, nil
+}
+
+var utf8BOM = []byte("\xEF\xBB\xBF")
+
+// xmlEncodingRegexp matches the encoding in an XML declaration.
+var xmlEncodingRegexp = regexp.MustCompile(`^<\?xml[^>]*?\sencoding\s*=\s*["']([^"']*)["']`)
+
+// decodeBody prepares a description body for XML decoding. A UTF-8 BOM is
+// removed, and overrides the document's declared encoding. Otherwise, if the
+// document does not declare its encoding, the body is converted from the
+// charset in the contentType header, if any. The returned charsetReader is
+// for the encodings declared in the document.
+func (cfg *FetchConfig) decodeBody(body io.Reader, contentType string) (
+	decoded io.Reader,
+	charsetReader func(charset string, input io.Reader) (io.Reader, error),
+	err error,
+) {
+	charsetReader = cfg.CharsetReader
+	if charsetReader == nil {
+		charsetReader = CharsetReaderDefault
+	}
+	if charsetReader == nil {
+		charsetReader = NewCharsetReader
+	}
+
+	br := bufio.NewReader(body)
+	if prefix, _ := br.Peek(len(utf8BOM)); bytes.Equal(prefix, utf8BOM) {
+		br.Discard(len(utf8BOM))
+		return br, func(charset string, input io.Reader) (io.Reader, error) {
+			return input, nil
+		}, nil
+	}
+
+	// An XML declaration, if any, must be at the start of the document.
+	head, _ := br.Peek(256)
+	if xmlEncodingRegexp.Match(head) {
+		return br, charsetReader, nil
+	}
+	if contentType == "" {
+		return br, charsetReader, nil
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// Devices may send malformed headers, so ignore it.
+		return br, charsetReader, nil
+	}
+	charset := params["charset"]
+	if charset == "" || strings.EqualFold(charset, "utf-8") {
+		return br, charsetReader, nil
+	}
+	decoded, err = charsetReader(charset, br)
+	if err != nil {
+		return nil, nil, err
+	}
+	return decoded, charsetReader, nil
+}
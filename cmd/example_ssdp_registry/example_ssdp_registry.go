@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"log"
 
 	"github.com/huin/goupnp/ssdp"
@@ -8,12 +9,24 @@ import (
 
 func main() {
 	c := make(chan ssdp.Update)
-	srv, reg := ssdp.NewServerAndRegistry()
+	servers, reg, err := ssdp.NewServersAndRegistry()
+	if err != nil {
+		log.Fatal(err)
+	}
 	reg.AddListener(c)
+	stopSweeper := reg.StartSweeper(0)
+	defer stopSweeper()
 	go listener(c)
-	if err := srv.ListenAndServe(); err != nil {
-		log.Print("ListenAndServe failed: ", err)
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		srv := srv
+		go func() {
+			if err := srv.ListenAndServe(); err != nil {
+				errs <- fmt.Errorf("ListenAndServe on %s failed: %v", srv.Addr, err)
+			}
+		}()
 	}
+	log.Print(<-errs)
 }
 
 func listener(c <-chan ssdp.Update) {
@@ -0,0 +1,84 @@
+// Package controlpoint describes the identity of a UPnP control point, which
+// is sent in its SSDP searches and HTTP requests to devices. Some devices
+// throttle or misbehave with control points that do not identify themselves.
+//
+// NOTE: the interface for this is experimental and may change, or go away
+// entirely.
+package controlpoint
+
+import (
+	"net/http"
+	"runtime"
+	"strconv"
+)
+
+// DefaultProduct is the product token used in USER-AGENT if an Identity has
+// none.
+const DefaultProduct = "goupnp/1.0"
+
+// Identity identifies a control point. A nil *Identity is valid, and only
+// sends USER-AGENT with DefaultProduct.
+type Identity struct {
+	// Product is the product token(s) of the control point, e.g. "MyApp/1.0",
+	// sent in USER-AGENT after the OS and UPnP version tokens. DefaultProduct
+	// if empty.
+	Product string
+	// FriendlyName is sent as CPFN.UPNP.ORG, as defined by UDA 2.0. A control
+	// point that sets it identifies as UPnP/2.0 rather than UPnP/1.1.
+	FriendlyName string
+	// UUID is sent as CPUUID.UPNP.ORG, as defined by UDA 2.0.
+	UUID string
+	// TCPPort is sent in searches as TCPPORT.UPNP.ORG, the port that the
+	// control point listens on for responses over TCP, if not 0.
+	TCPPort int
+}
+
+// osToken is the OS token of USER-AGENT. UDA requires an "OS/version" token,
+// but the OS version is not readily available, so a fixed version is used.
+const osToken = runtime.GOOS + "/1.0"
+
+// UserAgent returns the USER-AGENT header value, of the form
+// "OS/1.0 UPnP/1.1 product/version", e.g. "linux/1.0 UPnP/1.1 goupnp/1.0".
+func (id *Identity) UserAgent() string {
+	product := DefaultProduct
+	upnpVersion := "UPnP/1.1"
+	if id != nil {
+		if id.Product != "" {
+			product = id.Product
+		}
+		if id.FriendlyName != "" {
+			upnpVersion = "UPnP/2.0"
+		}
+	}
+	return osToken + " " + upnpVersion + " " + product
+}
+
+// SetSearchHeaders sets the identity's headers of an SSDP search request.
+// Header names are upper case, as SSDP headers are case-sensitive for some
+// devices.
+func (id *Identity) SetSearchHeaders(h http.Header) {
+	h["USER-AGENT"] = []string{id.UserAgent()}
+	id.setUPnPHeaders(h)
+	if id != nil && id.TCPPort != 0 {
+		h["TCPPORT.UPNP.ORG"] = []string{strconv.Itoa(id.TCPPort)}
+	}
+}
+
+// SetRequestHeaders sets the identity's headers of an HTTP request, such as
+// for a description or SOAP action.
+func (id *Identity) SetRequestHeaders(h http.Header) {
+	h.Set("User-Agent", id.UserAgent())
+	id.setUPnPHeaders(h)
+}
+
+func (id *Identity) setUPnPHeaders(h http.Header) {
+	if id == nil {
+		return
+	}
+	if id.FriendlyName != "" {
+		h["CPFN.UPNP.ORG"] = []string{id.FriendlyName}
+	}
+	if id.UUID != "" {
+		h["CPUUID.UPNP.ORG"] = []string{id.UUID}
+	}
+}
@@ -0,0 +1,44 @@
+package controlpoint
+
+import (
+	"net/http"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestIdentity(t *testing.T) {
+	var anonymous *Identity
+	h := http.Header{}
+	anonymous.SetSearchHeaders(h)
+	if ua := h["USER-AGENT"]; len(ua) != 1 || !strings.HasSuffix(ua[0], " UPnP/1.1 "+DefaultProduct) {
+		t.Errorf("got USER-AGENT %q for nil identity, want the default product", ua)
+	}
+	if len(h) != 1 {
+		t.Errorf("got headers %v for nil identity, want only USER-AGENT", h)
+	}
+
+	id := &Identity{Product: "test/2.0", FriendlyName: "Test", UUID: "uuid:1", TCPPort: 5000}
+	h = http.Header{}
+	id.SetSearchHeaders(h)
+	want := http.Header{
+		"USER-AGENT":       []string{id.UserAgent()},
+		"CPFN.UPNP.ORG":    []string{"Test"},
+		"CPUUID.UPNP.ORG":  []string{"uuid:1"},
+		"TCPPORT.UPNP.ORG": []string{"5000"},
+	}
+	if got, want := id.UserAgent(), runtime.GOOS+"/1.0 UPnP/2.0 test/2.0"; got != want {
+		t.Errorf("got UserAgent %q, want %q", got, want)
+	}
+	for k, v := range want {
+		if len(h[k]) != 1 || h[k][0] != v[0] {
+			t.Errorf("got %s %q, want %q", k, h[k], v)
+		}
+	}
+
+	h = http.Header{}
+	id.SetRequestHeaders(h)
+	if h.Get("User-Agent") != id.UserAgent() || h["CPFN.UPNP.ORG"] == nil || h["TCPPORT.UPNP.ORG"] != nil {
+		t.Errorf("got request headers %v, want User-Agent and CPFN without TCPPORT", h)
+	}
+}
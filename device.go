@@ -12,6 +12,8 @@ import (
 
 	"github.com/huin/goupnp/scpd"
 	"github.com/huin/goupnp/soap"
+	"github.com/huin/goupnp/ssdp"
+	"github.com/huin/goupnp/urn"
 )
 
 const (
@@ -21,12 +23,42 @@ const (
 // RootDevice is the device description as described by section 2.3 "Device
 // description" in
 // http://upnp.org/specs/arch/UPnP-arch-DeviceArchitecture-v1.1.pdf
+//
+// It marshals back to a device description, including its Extensions.
 type RootDevice struct {
 	XMLName     xml.Name    `xml:"root"`
 	SpecVersion SpecVersion `xml:"specVersion"`
 	URLBase     url.URL     `xml:"-"`
-	URLBaseStr  string      `xml:"URLBase"`
+	URLBaseStr  string      `xml:"URLBase,omitempty"`
 	Device      Device      `xml:"device"`
+	// ConfigID is the configId attribute added by UDA 1.1, "" if absent.
+	ConfigID string `xml:"configId,attr,omitempty"`
+
+	// Extensions are the child elements that are not otherwise decoded, such
+	// as vendor extensions.
+	Extensions []Extension `xml:",any"`
+	// ExtensionAttrs are the attributes that are not otherwise decoded,
+	// without namespace declarations, as namespaces are in the names.
+	ExtensionAttrs []xml.Attr `xml:",any,attr"`
+}
+
+// UnmarshalXML implements xml.Unmarshaler, to omit namespace declarations
+// from ExtensionAttrs.
+func (root *RootDevice) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type rootDevice RootDevice // Without the XML methods.
+	if err := d.DecodeElement((*rootDevice)(root), &start); err != nil {
+		return err
+	}
+	root.ExtensionAttrs = withoutNamespaceDecls(root.ExtensionAttrs)
+	return nil
+}
+
+// MarshalXML implements xml.Marshaler, to encode the root element in the
+// device namespace.
+func (root RootDevice) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type rootDevice RootDevice // Without the XML methods.
+	start = xml.StartElement{Name: xml.Name{Space: DeviceXMLNamespace, Local: "root"}}
+	return e.EncodeElement(rootDevice(root), start)
 }
 
 // SetURLBase sets the URLBase for the RootDevice and its underlying components.
@@ -36,6 +68,35 @@ func (root *RootDevice) SetURLBase(urlBase *url.URL) {
 	root.Device.SetURLBase(urlBase)
 }
 
+// Advertisements returns the SSDP notification type and unique service name
+// pairs to announce for the root device, its embedded devices and their
+// services, as described by section 1.1.2 "SSDP message header fields" in
+// http://upnp.org/specs/arch/UPnP-arch-DeviceArchitecture-v1.1.pdf
+func (root *RootDevice) Advertisements() []ssdp.Advertisement {
+	ads := []ssdp.Advertisement{{
+		NT:  ssdp.UPNPRootDevice,
+		USN: root.Device.UDN + "::" + ssdp.UPNPRootDevice,
+	}}
+	root.Device.VisitDevices(func(d *Device) {
+		ads = append(ads,
+			ssdp.Advertisement{NT: d.UDN, USN: d.UDN},
+			ssdp.Advertisement{NT: d.DeviceType, USN: d.UDN + "::" + d.DeviceType},
+		)
+		seen := make(map[string]bool, len(d.Services))
+		for _, srv := range d.Services {
+			if seen[srv.ServiceType] {
+				continue
+			}
+			seen[srv.ServiceType] = true
+			ads = append(ads, ssdp.Advertisement{
+				NT:  srv.ServiceType,
+				USN: d.UDN + "::" + srv.ServiceType,
+			})
+		}
+	})
+	return ads
+}
+
 // SpecVersion is part of a RootDevice, describes the version of the
 // specification that the data adheres to.
 type SpecVersion struct {
@@ -63,6 +124,91 @@ type Device struct {
 
 	// Extra observed elements:
 	PresentationURL URLField `xml:"presentationURL"`
+
+	// Extensions are the child elements that are not otherwise decoded, such
+	// as dlna:X_DLNADOC and other vendor extensions.
+	Extensions []Extension `xml:",any"`
+	// ExtensionAttrs are the attributes that are not otherwise decoded,
+	// without namespace declarations, as namespaces are in the names.
+	ExtensionAttrs []xml.Attr `xml:",any,attr"`
+}
+
+// UnmarshalXML implements xml.Unmarshaler, to omit namespace declarations
+// from ExtensionAttrs.
+func (device *Device) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type plainDevice Device // Without the XML methods.
+	if err := d.DecodeElement((*plainDevice)(device), &start); err != nil {
+		return err
+	}
+	device.ExtensionAttrs = withoutNamespaceDecls(device.ExtensionAttrs)
+	return nil
+}
+
+// MarshalXML implements xml.Marshaler, to omit empty lists.
+func (device Device) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	dx := deviceXML{
+		DeviceType:       device.DeviceType,
+		FriendlyName:     device.FriendlyName,
+		Manufacturer:     device.Manufacturer,
+		ManufacturerURL:  device.ManufacturerURL,
+		ModelDescription: device.ModelDescription,
+		ModelName:        device.ModelName,
+		ModelNumber:      device.ModelNumber,
+		ModelType:        device.ModelType,
+		ModelURL:         device.ModelURL,
+		SerialNumber:     device.SerialNumber,
+		UDN:              device.UDN,
+		UPC:              device.UPC,
+		PresentationURL:  device.PresentationURL,
+		Extensions:       device.Extensions,
+		ExtensionAttrs:   device.ExtensionAttrs,
+	}
+	if len(device.Icons) > 0 {
+		dx.Icons = &iconListXML{device.Icons}
+	}
+	if len(device.Services) > 0 {
+		dx.Services = &serviceListXML{device.Services}
+	}
+	if len(device.Devices) > 0 {
+		dx.Devices = &deviceListXML{device.Devices}
+	}
+	return e.EncodeElement(&dx, start)
+}
+
+// deviceXML is the marshalled form of a Device. encoding/xml does not omit
+// empty lists in "iconList>icon" style fields, so these are pointers to the
+// lists, nil if empty.
+type deviceXML struct {
+	DeviceType       string          `xml:"deviceType"`
+	FriendlyName     string          `xml:"friendlyName"`
+	Manufacturer     string          `xml:"manufacturer"`
+	ManufacturerURL  URLField        `xml:"manufacturerURL"`
+	ModelDescription string          `xml:"modelDescription,omitempty"`
+	ModelName        string          `xml:"modelName"`
+	ModelNumber      string          `xml:"modelNumber,omitempty"`
+	ModelType        string          `xml:"modelType,omitempty"`
+	ModelURL         URLField        `xml:"modelURL"`
+	SerialNumber     string          `xml:"serialNumber,omitempty"`
+	UDN              string          `xml:"UDN"`
+	UPC              string          `xml:"UPC,omitempty"`
+	Icons            *iconListXML    `xml:"iconList"`
+	Services         *serviceListXML `xml:"serviceList"`
+	Devices          *deviceListXML  `xml:"deviceList"`
+	PresentationURL  URLField        `xml:"presentationURL"`
+	Extensions       []Extension     `xml:",any"`
+	ExtensionAttrs   []xml.Attr      `xml:",any,attr"`
+}
+
+type iconListXML struct {
+	Icons []Icon `xml:"icon"`
+}
+
+type serviceListXML struct {
+	Services []Service `xml:"service"`
+}
+
+type deviceListXML struct {
+	Devices []Device `xml:"device"`
 }
 
 // VisitDevices calls visitor for the device, and all its descendent devices.
@@ -95,6 +241,95 @@ func (device *Device) FindService(serviceType string) []*Service {
 	return services
 }
 
+// FindServicesAtLeast finds all (if any) Services under the device and its
+// descendents that have the type serviceType, with at least its version, as
+// later versions are backward compatible. If serviceType is not a type URN,
+// it is the same as FindService.
+func (device *Device) FindServicesAtLeast(serviceType string) []*Service {
+	var services []*Service
+	device.VisitServices(func(s *Service) {
+		if urn.Match(s.ServiceType, serviceType) {
+			services = append(services, s)
+		}
+	})
+	return services
+}
+
+// FindHighestService is as FindServicesAtLeast, but only finds the Services
+// with the highest version available.
+func (device *Device) FindHighestService(serviceType string) []*Service {
+	var services []*Service
+	highest := 0
+	device.VisitServices(func(s *Service) {
+		if !urn.Match(s.ServiceType, serviceType) {
+			return
+		}
+		if version := typeVersion(s.ServiceType); version > highest {
+			highest = version
+			services = services[:0]
+		} else if version < highest {
+			return
+		}
+		services = append(services, s)
+	})
+	return services
+}
+
+// FindDevicesAtLeast finds all (if any) of the device and its descendents
+// that have the type deviceType, with at least its version, as later versions
+// are backward compatible.
+func (device *Device) FindDevicesAtLeast(deviceType string) []*Device {
+	var devices []*Device
+	device.VisitDevices(func(d *Device) {
+		if urn.Match(d.DeviceType, deviceType) {
+			devices = append(devices, d)
+		}
+	})
+	return devices
+}
+
+// FindHighestDevice is as FindDevicesAtLeast, but only finds the devices with
+// the highest version available.
+func (device *Device) FindHighestDevice(deviceType string) []*Device {
+	var devices []*Device
+	highest := 0
+	device.VisitDevices(func(d *Device) {
+		if !urn.Match(d.DeviceType, deviceType) {
+			return
+		}
+		if version := typeVersion(d.DeviceType); version > highest {
+			highest = version
+			devices = devices[:0]
+		} else if version < highest {
+			return
+		}
+		devices = append(devices, d)
+	})
+	return devices
+}
+
+// typeVersion returns the version of a device or service type, or 0 if it is
+// not a type URN.
+func typeVersion(t string) int {
+	u, err := urn.Parse(t)
+	if err != nil {
+		return 0
+	}
+	return u.Version
+}
+
+// FindExtensions returns the device's extension elements with the name, e.g.
+// {Space: "urn:schemas-dlna-org:device-1-0", Local: "X_DLNADOC"}.
+func (device *Device) FindExtensions(name xml.Name) []*Extension {
+	var exts []*Extension
+	for i := range device.Extensions {
+		if device.Extensions[i].XMLName == name {
+			exts = append(exts, &device.Extensions[i])
+		}
+	}
+	return exts
+}
+
 // SetURLBase sets the URLBase for the Device and its underlying components.
 func (device *Device) SetURLBase(urlBase *url.URL) {
 	device.ManufacturerURL.SetURLBase(urlBase)
@@ -116,7 +351,8 @@ func (device *Device) String() string {
 }
 
 // Icon is a representative image that a device might include in its
-// description.
+// description. Depth is the color depth in bits per pixel, and is always
+// included in a marshalled description, as it is required.
 type Icon struct {
 	Mimetype string   `xml:"mimetype"`
 	Width    int32    `xml:"width"`
@@ -151,13 +387,19 @@ func (srv *Service) String() string {
 }
 
 // RequestSCPDCtx requests the SCPD (soap actions and state variables description)
-// for the service.
+// for the service, using the default FetchConfig.
 func (srv *Service) RequestSCPDCtx(ctx context.Context) (*scpd.SCPD, error) {
+	return (&FetchConfig{}).RequestSCPD(ctx, srv)
+}
+
+// RequestSCPD requests the SCPD (soap actions and state variables description)
+// for the service.
+func (cfg *FetchConfig) RequestSCPD(ctx context.Context, srv *Service) (*scpd.SCPD, error) {
 	if !srv.SCPDURL.Ok {
 		return nil, errors.New("bad/missing SCPD URL, or no URLBase has been set")
 	}
 	s := new(scpd.SCPD)
-	if err := requestXml(ctx, srv.SCPDURL.URL.String(), scpd.SCPDXMLNamespace, s); err != nil {
+	if err := cfg.requestXml(ctx, srv.SCPDURL.URL.String(), scpd.SCPDXMLNamespace, s); err != nil {
 		return nil, err
 	}
 	return s, nil
@@ -179,13 +421,23 @@ func (srv *Service) NewSOAPClient() *soap.SOAPClient {
 	return soap.NewSOAPClient(srv.ControlURL.URL)
 }
 
-// URLField is a URL that is part of a device description.
+// URLField is a URL that is part of a device description. Str is the URL as
+// given in the description, which is marshalled, while URL is resolved
+// against the URLBase.
 type URLField struct {
 	URL url.URL `xml:"-"`
 	Ok  bool    `xml:"-"`
 	Str string  `xml:",chardata"`
 }
 
+// MarshalXML implements xml.Marshaler, to omit the element if Str is empty.
+func (uf URLField) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if uf.Str == "" {
+		return nil
+	}
+	return e.EncodeElement(uf.Str, start)
+}
+
 func (uf *URLField) SetURLBase(urlBase *url.URL) {
 	str := uf.Str
 	if !strings.Contains(str, "://") && !strings.HasPrefix(str, "/") {
@@ -202,3 +454,59 @@ func (uf *URLField) SetURLBase(urlBase *url.URL) {
 	uf.URL = *urlBase.ResolveReference(refUrl)
 	uf.Ok = true
 }
+
+// Extension is an element of a description that is not otherwise decoded,
+// such as a vendor extension. Its content is kept as text and child
+// elements, so that it marshals back to an equivalent element.
+type Extension struct {
+	XMLName xml.Name
+	// Attrs are the element's attributes, without namespace declarations.
+	Attrs []xml.Attr `xml:",any,attr"`
+	// Text is the element's character data. It is "" if it is only
+	// whitespace between child elements.
+	Text     string      `xml:",chardata"`
+	Children []Extension `xml:",any"`
+}
+
+// UnmarshalXML implements xml.Unmarshaler.
+func (ext *Extension) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	ext.XMLName = start.Name
+	ext.Attrs = withoutNamespaceDecls(start.Attr)
+	var text strings.Builder
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			var child Extension
+			if err := child.UnmarshalXML(d, t); err != nil {
+				return err
+			}
+			ext.Children = append(ext.Children, child)
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			ext.Text = text.String()
+			if len(ext.Children) > 0 && strings.TrimSpace(ext.Text) == "" {
+				ext.Text = ""
+			}
+			return nil
+		}
+	}
+}
+
+// withoutNamespaceDecls returns attrs without the xmlns attributes, which the
+// decoder has already applied to the names. Marshalling them would declare
+// the namespaces again, with invalid prefixes.
+func withoutNamespaceDecls(attrs []xml.Attr) []xml.Attr {
+	var result []xml.Attr
+	for _, attr := range attrs {
+		if attr.Name.Space == "xmlns" || attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+			continue
+		}
+		result = append(result, attr)
+	}
+	return result
+}
@@ -0,0 +1,340 @@
+// Package device hosts UPnP devices. A Host serves the device description,
+// service descriptions, SOAP control and GENA eventing for a root device and
+// its embedded devices, and advertises them with SSDP.
+//
+// NOTE: the interface for this is experimental and may change, or go away
+// entirely.
+package device
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/huin/goupnp"
+	"github.com/huin/goupnp/gena"
+	"github.com/huin/goupnp/scpd"
+	"github.com/huin/goupnp/ssdp"
+)
+
+const (
+	// DescriptionPath is the path that the root device description is
+	// served from.
+	DescriptionPath = "/description.xml"
+	// servicePathPrefix prefixes the paths of the endpoints for each service.
+	servicePathPrefix = "/upnp/"
+)
+
+// Service is the implementation of a service hosted by a Host.
+type Service struct {
+	// SCPD is served as the service description.
+	SCPD *scpd.SCPD
+	// Control receives SOAP control requests, and is typically a
+	// *soap.Server.
+	Control http.Handler
+	// Events accepts event subscriptions. If nil, a Publisher is created with
+	// the default values of the evented state variables in SCPD.
+	Events *gena.Publisher
+}
+
+// hostedService is a service in the description of the hosted root device.
+type hostedService struct {
+	udn  string
+	desc *goupnp.Service
+	impl *Service
+}
+
+var _ http.Handler = new(Host)
+
+// Host serves a root device and its embedded devices and services.
+type Host struct {
+	// Interface is the network interface to advertise on, nil for the default
+	// multicast interface. Its address is used in the LOCATION URL if
+	// ListenAndServe is given an unspecified address.
+	Interface *net.Interface
+	// Server is the SERVER header value, ssdp.DefaultServer if empty.
+	Server string
+	// MaxAge is the duration that SSDP announcements are valid for,
+	// ssdp.DefaultMaxAge if zero.
+	MaxAge time.Duration
+
+	root     *goupnp.RootDevice
+	services []*hostedService
+
+	lock       sync.Mutex
+	location   string
+	httpServer *http.Server
+	advertiser *ssdp.Advertiser
+	closing    bool
+}
+
+// NewHost creates a Host for the root device. The SCPD, control and event
+// URLs of all services in root are rewritten to endpoints served by the Host,
+// and root must not be modified afterwards. Each service's implementation is
+// then provided with SetService.
+func NewHost(root *goupnp.RootDevice) *Host {
+	host := &Host{root: root}
+	// URLs in the description are relative to the description URL.
+	root.URLBaseStr = ""
+	root.Device.VisitDevices(func(d *goupnp.Device) {
+		for i := range d.Services {
+			srv := &d.Services[i]
+			path := servicePathPrefix + strconv.Itoa(len(host.services)) + "/"
+			srv.SCPDURL.Str = path + "scpd.xml"
+			srv.ControlURL.Str = path + "control"
+			srv.EventSubURL.Str = path + "event"
+			host.services = append(host.services, &hostedService{udn: d.UDN, desc: srv})
+		}
+	})
+	return host
+}
+
+// Root returns the description of the hosted root device.
+func (host *Host) Root() *goupnp.RootDevice {
+	return host.root
+}
+
+// SetService provides the implementation for the service with the given
+// ServiceId, in the device with the given UDN.
+func (host *Host) SetService(udn, serviceID string, svc *Service) error {
+	if svc.SCPD == nil {
+		return errors.New("device: service has no SCPD")
+	}
+	for _, hs := range host.services {
+		if hs.udn != udn || hs.desc.ServiceId != serviceID {
+			continue
+		}
+		if svc.Events == nil {
+			svc.Events = gena.NewPublisher(initialState(svc.SCPD))
+		}
+		host.lock.Lock()
+		hs.impl = svc
+		host.lock.Unlock()
+		return nil
+	}
+	return fmt.Errorf("device: no service %q in device %q", serviceID, udn)
+}
+
+// initialState returns the default values of the evented state variables in
+// the service description.
+func initialState(desc *scpd.SCPD) []gena.Property {
+	var props []gena.Property
+	for _, v := range desc.StateVariables {
+		// sendEvents defaults to "yes" when absent.
+		if v.SendEvents == "no" || strings.HasPrefix(v.Name, "A_ARG_TYPE_") {
+			continue
+		}
+		props = append(props, gena.Property{Name: v.Name, Value: v.DefaultValue})
+	}
+	return props
+}
+
+// ServeHTTP implements http.Handler, and serves the description and the
+// service endpoints.
+func (host *Host) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == DescriptionPath {
+		host.serveDescription(w, r)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, servicePathPrefix) {
+		http.NotFound(w, r)
+		return
+	}
+	parts := strings.SplitN(r.URL.Path[len(servicePathPrefix):], "/", 2)
+	index, err := strconv.Atoi(parts[0])
+	if err != nil || index < 0 || index >= len(host.services) || len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	host.lock.Lock()
+	impl := host.services[index].impl
+	host.lock.Unlock()
+	if impl == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch parts[1] {
+	case "scpd.xml":
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		writeXML(w, xml.Name{Space: scpd.SCPDXMLNamespace, Local: "scpd"}, impl.SCPD)
+	case "control":
+		if impl.Control == nil {
+			http.NotFound(w, r)
+			return
+		}
+		impl.Control.ServeHTTP(w, r)
+	case "event":
+		impl.Events.ServeHTTP(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveDescription serves the root device description, which has no URLBase
+// as it is deprecated by UDA 1.1.
+func (host *Host) serveDescription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeXML(w, xml.Name{Space: goupnp.DeviceXMLNamespace, Local: "root"}, host.root)
+}
+
+// writeXML writes v as an XML document with the given root element name.
+func writeXML(w http.ResponseWriter, name xml.Name, v interface{}) {
+	buf := new(bytes.Buffer)
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(buf).EncodeElement(v, xml.StartElement{Name: name}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
+
+// Location returns the URL of the root device description, once
+// ListenAndServe has started listening.
+func (host *Host) Location() string {
+	host.lock.Lock()
+	defer host.lock.Unlock()
+	return host.location
+}
+
+// ListenAndServe listens for HTTP requests on the TCP address addr, and
+// advertises the devices and services with SSDP until Close is called.
+func (host *Host) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp4", addr)
+	if err != nil {
+		return err
+	}
+	return host.Serve(listener)
+}
+
+// Serve serves HTTP requests from the listener, which must be listening on an
+// IPv4 TCP address, and advertises the devices and services with SSDP until
+// Close is called, or serving fails. The listener is closed on return.
+func (host *Host) Serve(listener net.Listener) error {
+	tcpAddr, ok := listener.Addr().(*net.TCPAddr)
+	if !ok || tcpAddr.IP.To4() == nil {
+		listener.Close()
+		return fmt.Errorf("device: cannot serve on %s, want an IPv4 TCP address", listener.Addr())
+	}
+	ip := tcpAddr.IP
+	if ip.IsUnspecified() {
+		var err error
+		if ip, err = interfaceIPv4(host.Interface); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+	location := (&net.TCPAddr{IP: ip, Port: tcpAddr.Port}).String()
+	location = "http://" + location + DescriptionPath
+
+	host.lock.Lock()
+	if host.httpServer != nil || host.closing {
+		host.lock.Unlock()
+		listener.Close()
+		return errors.New("device: host is closed or already serving")
+	}
+	host.location = location
+	host.httpServer = &http.Server{Handler: host}
+	host.advertiser = &ssdp.Advertiser{
+		Location:       location,
+		Advertisements: host.root.Advertisements(),
+		Server:         host.Server,
+		MaxAge:         host.MaxAge,
+		Interface:      host.Interface,
+	}
+	httpServer, advertiser := host.httpServer, host.advertiser
+	host.lock.Unlock()
+
+	errs := make(chan error, 2)
+	go func() { errs <- httpServer.Serve(listener) }()
+	go func() { errs <- advertiser.ListenAndServe() }()
+	// Whichever stops first, stop the other. Closing the advertiser works
+	// even if it has not started yet.
+	err := <-errs
+	host.Close()
+	<-errs
+
+	host.lock.Lock()
+	defer host.lock.Unlock()
+	if host.closing && (err == nil || err == http.ErrServerClosed || err == ssdp.ErrAdvertiserClosed) {
+		return nil
+	}
+	return err
+}
+
+// Close stops advertising, sending ssdp:byebye for all advertisements, ends
+// all event subscriptions and stops serving.
+func (host *Host) Close() error {
+	host.lock.Lock()
+	if host.closing {
+		host.lock.Unlock()
+		return nil
+	}
+	host.closing = true
+	httpServer, advertiser := host.httpServer, host.advertiser
+	var publishers []*gena.Publisher
+	for _, hs := range host.services {
+		if hs.impl != nil {
+			publishers = append(publishers, hs.impl.Events)
+		}
+	}
+	host.lock.Unlock()
+
+	var err error
+	if advertiser != nil {
+		err = advertiser.Close()
+	}
+	for _, pub := range publishers {
+		pub.Close()
+	}
+	if httpServer != nil {
+		if closeErr := httpServer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// interfaceIPv4 returns an IPv4 address of the network interface, or if ifi
+// is nil, of the first multicast capable interface that is up.
+func interfaceIPv4(ifi *net.Interface) (net.IP, error) {
+	var ifis []net.Interface
+	if ifi != nil {
+		ifis = []net.Interface{*ifi}
+	} else {
+		var err error
+		if ifis, err = net.Interfaces(); err != nil {
+			return nil, err
+		}
+	}
+	for _, ifi := range ifis {
+		if ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagMulticast == 0 || ifi.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+				return ipNet.IP, nil
+			}
+		}
+	}
+	return nil, errors.New("device: no IPv4 address to serve on")
+}
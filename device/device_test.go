@@ -0,0 +1,226 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/huin/goupnp"
+	"github.com/huin/goupnp/gena"
+	"github.com/huin/goupnp/scpd"
+	"github.com/huin/goupnp/soap"
+)
+
+const (
+	testUDN         = "uuid:11111111-2222-3333-4444-555555555555"
+	testServiceType = "urn:schemas-upnp-org:service:SwitchPower:1"
+	testServiceID   = "urn:upnp-org:serviceId:SwitchPower"
+)
+
+func TestHost(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	root := &goupnp.RootDevice{
+		SpecVersion: goupnp.SpecVersion{Major: 1, Minor: 1},
+		Device: goupnp.Device{
+			DeviceType:   "urn:schemas-upnp-org:device:BinaryLight:1",
+			FriendlyName: "Test light",
+			UDN:          testUDN,
+			Services: []goupnp.Service{{
+				ServiceType: testServiceType,
+				ServiceId:   testServiceID,
+			}},
+		},
+	}
+	desc := &scpd.SCPD{
+		SpecVersion: scpd.SpecVersion{Major: 1, Minor: 1},
+		Actions: []scpd.Action{{
+			Name: "SetTarget",
+			Arguments: []scpd.Argument{{
+				Name:                 "newTargetValue",
+				Direction:            "in",
+				RelatedStateVariable: "Target",
+			}},
+		}},
+		StateVariables: []scpd.StateVariable{
+			{Name: "Target", SendEvents: "no", DataType: scpd.DataType{Name: "boolean"}, DefaultValue: "0"},
+			{Name: "Status", DataType: scpd.DataType{Name: "boolean"}, DefaultValue: "0"},
+		},
+	}
+
+	host := NewHost(root)
+	control := soap.NewServer()
+	var pub *gena.Publisher
+	control.HandleFunc(testServiceType, "SetTarget", func(req *soap.ActionRequest) (interface{}, error) {
+		var in struct {
+			NewTargetValue bool `soap:"newTargetValue"`
+		}
+		if err := req.DecodeArgs(&in); err != nil {
+			return nil, err
+		}
+		status, _ := soap.MarshalBoolean(in.NewTargetValue)
+		pub.Notify(gena.Property{Name: "Status", Value: status})
+		return nil, nil
+	})
+	svc := &Service{SCPD: desc, Control: control}
+	if err := host.SetService(testUDN, testServiceID, svc); err != nil {
+		t.Fatal(err)
+	}
+	pub = svc.Events
+	if err := host.SetService(testUDN, "urn:upnp-org:serviceId:Missing", svc); err == nil {
+		t.Error("SetService for missing service: got success, want error")
+	}
+
+	ts := httptest.NewServer(host)
+	t.Cleanup(ts.Close)
+	t.Cleanup(func() { host.Close() })
+	loc, err := url.Parse(ts.URL + DescriptionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clients, err := goupnp.NewServiceClientsByURLCtx(ctx, loc, testServiceType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clients) != 1 {
+		t.Fatalf("got %d service clients, want 1", len(clients))
+	}
+	client := clients[0]
+	if got, want := client.RootDevice.Device.FriendlyName, "Test light"; got != want {
+		t.Errorf("got FriendlyName %q, want %q", got, want)
+	}
+
+	gotSCPD, err := client.Service.RequestSCPDCtx(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotSCPD.GetAction("SetTarget") == nil || gotSCPD.GetStateVariable("Status") == nil {
+		t.Errorf("got SCPD %+v, want SetTarget action and Status variable", gotSCPD)
+	}
+
+	sub, err := gena.NewSubscriber("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sub.Close() })
+	s, err := client.Subscribe(ctx, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantEvent := func(seq uint32, status string) {
+		t.Helper()
+		select {
+		case ev := <-s.Events():
+			got, _ := ev.Value("Status")
+			_, hasTarget := ev.Value("Target")
+			if ev.Seq != seq || got != status || hasTarget {
+				t.Errorf("got event %+v, want SEQ %d with Status=%q", ev, seq, status)
+			}
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for event")
+		}
+	}
+	wantEvent(0, "0")
+
+	in := struct {
+		NewTargetValue string `soap:"newTargetValue"`
+	}{"1"}
+	if err := client.SOAPClient.PerformActionCtx(ctx, testServiceType, "SetTarget", &in, nil); err != nil {
+		t.Fatal(err)
+	}
+	wantEvent(1, "1")
+
+	if err := s.Unsubscribe(ctx); err != nil {
+		t.Errorf("Unsubscribe: got error %v, want success", err)
+	}
+}
+
+// serveResult runs serve, and returns its result, or fails the test if it does
+// not return in time.
+func serveResult(t *testing.T, serve func() error) error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- serve() }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("serving did not stop")
+		return nil
+	}
+}
+
+// skipIfNoMulticast skips the test if err is from the advertiser being
+// unable to use the network.
+func skipIfNoMulticast(t *testing.T, err error) {
+	t.Helper()
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op != "accept" {
+		t.Skipf("cannot advertise: %v", err)
+	}
+}
+
+func newTestHost() *Host {
+	return NewHost(&goupnp.RootDevice{
+		SpecVersion: goupnp.SpecVersion{Major: 1, Minor: 1},
+		Device: goupnp.Device{
+			DeviceType: "urn:schemas-upnp-org:device:BinaryLight:1",
+			UDN:        testUDN,
+		},
+	})
+}
+
+func TestHostCloseAfterStart(t *testing.T) {
+	host := newTestHost()
+	err := serveResult(t, func() error {
+		l, err := net.Listen("tcp4", "127.0.0.1:0")
+		if err != nil {
+			return err
+		}
+		// Close as soon as serving starts, before the advertiser has had a
+		// chance to start.
+		go func() {
+			for host.Location() == "" {
+				time.Sleep(time.Millisecond)
+			}
+			host.Close()
+		}()
+		return host.Serve(l)
+	})
+	skipIfNoMulticast(t, err)
+	if err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+}
+
+// failingListener fails to accept connections.
+type failingListener struct {
+	net.Listener
+}
+
+var errAccept = errors.New("accept failed")
+
+func (l failingListener) Accept() (net.Conn, error) {
+	return nil, errAccept
+}
+
+func TestHostServeFails(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := newTestHost()
+	err = serveResult(t, func() error {
+		return host.Serve(failingListener{l})
+	})
+	skipIfNoMulticast(t, err)
+	if err != errAccept {
+		t.Errorf("got %v, want %v", err, errAccept)
+	}
+}
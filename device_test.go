@@ -0,0 +1,229 @@
+package goupnp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testExtendedDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0"
+    xmlns:dlna="urn:schemas-dlna-org:device-1-0"
+    xmlns:sec="http://www.sec.co.kr/dlna"
+    configId="7" sec:root="1">
+  <specVersion><major>1</major><minor>1</minor></specVersion>
+  <device sec:flag="yes">
+    <deviceType>urn:schemas-upnp-org:device:MediaServer:1</deviceType>
+    <friendlyName>Media server</friendlyName>
+    <manufacturer>Acme</manufacturer>
+    <modelName>Server</modelName>
+    <modelType>NAS</modelType>
+    <UDN>uuid:1</UDN>
+    <UPC>012345678905</UPC>
+    <dlna:X_DLNADOC>DMS-1.50</dlna:X_DLNADOC>
+    <dlna:X_DLNADOC>M-DMS-1.50</dlna:X_DLNADOC>
+    <sec:ProductCap>smi,DCM10,getMediaInfo.sec</sec:ProductCap>
+    <sec:X_Nested sec:a="b">
+      <sec:Inner>text</sec:Inner>
+    </sec:X_Nested>
+    <iconList>
+      <icon>
+        <mimetype>image/png</mimetype>
+        <width>48</width>
+        <height>48</height>
+        <depth>24</depth>
+        <url>icon.png</url>
+      </icon>
+    </iconList>
+    <serviceList>
+      <service>
+        <serviceType>urn:schemas-upnp-org:service:ContentDirectory:1</serviceType>
+        <serviceId>urn:upnp-org:serviceId:ContentDirectory</serviceId>
+        <SCPDURL>/cds.xml</SCPDURL>
+        <controlURL>/cds/control</controlURL>
+        <eventSubURL>/cds/event</eventSubURL>
+      </service>
+    </serviceList>
+    <presentationURL>/</presentationURL>
+  </device>
+</root>`
+
+func decodeRootDevice(t *testing.T, data []byte) *RootDevice {
+	t.Helper()
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.DefaultSpace = DeviceXMLNamespace
+	root := new(RootDevice)
+	if err := d.Decode(root); err != nil {
+		t.Fatalf("decoding %s: %v", data, err)
+	}
+	return root
+}
+
+func TestRootDeviceRoundTrip(t *testing.T) {
+	const dlnaSpace = "urn:schemas-dlna-org:device-1-0"
+	const secSpace = "http://www.sec.co.kr/dlna"
+	root := decodeRootDevice(t, []byte(testExtendedDescription))
+
+	if root.ConfigID != "7" {
+		t.Errorf("got ConfigID %q, want %q", root.ConfigID, "7")
+	}
+	wantRootAttrs := []xml.Attr{{Name: xml.Name{Space: secSpace, Local: "root"}, Value: "1"}}
+	if !reflect.DeepEqual(root.ExtensionAttrs, wantRootAttrs) {
+		t.Errorf("got root ExtensionAttrs %v, want %v", root.ExtensionAttrs, wantRootAttrs)
+	}
+	device := &root.Device
+	if device.ModelType != "NAS" || device.UPC != "012345678905" || device.Icons[0].Depth != 24 {
+		t.Errorf("got ModelType %q, UPC %q, icon depth %d", device.ModelType, device.UPC, device.Icons[0].Depth)
+	}
+	var docs []string
+	for _, ext := range device.FindExtensions(xml.Name{Space: dlnaSpace, Local: "X_DLNADOC"}) {
+		docs = append(docs, ext.Text)
+	}
+	if want := []string{"DMS-1.50", "M-DMS-1.50"}; !reflect.DeepEqual(docs, want) {
+		t.Errorf("got X_DLNADOC %q, want %q", docs, want)
+	}
+	nested := device.FindExtensions(xml.Name{Space: secSpace, Local: "X_Nested"})
+	wantNested := []*Extension{{
+		XMLName: xml.Name{Space: secSpace, Local: "X_Nested"},
+		Attrs:   []xml.Attr{{Name: xml.Name{Space: secSpace, Local: "a"}, Value: "b"}},
+		Children: []Extension{{
+			XMLName: xml.Name{Space: secSpace, Local: "Inner"},
+			Text:    "text",
+		}},
+	}}
+	if !reflect.DeepEqual(nested, wantNested) {
+		t.Errorf("got X_Nested %+v, want %+v", nested, wantNested)
+	}
+
+	data, err := xml.Marshal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, omitted := range []string{"URLBase", "deviceList", "modelDescription", "manufacturerURL"} {
+		if bytes.Contains(data, []byte(omitted)) {
+			t.Errorf("marshalled description contains empty %s: %s", omitted, data)
+		}
+	}
+	if got := decodeRootDevice(t, data); !reflect.DeepEqual(got, root) {
+		t.Errorf("round trip:\ngot  %+v\nwant %+v\nmarshalled: %s", got, root, data)
+	}
+}
+
+func TestRootDeviceMarshalNew(t *testing.T) {
+	root := &RootDevice{
+		SpecVersion: SpecVersion{Major: 2},
+		Device: Device{
+			DeviceType: "urn:schemas-upnp-org:device:Basic:1",
+			UDN:        "uuid:1",
+			Extensions: []Extension{{
+				XMLName: xml.Name{Space: "urn:example-com:device-1-0", Local: "X_Feature"},
+				Text:    "on",
+			}},
+		},
+	}
+	data, err := xml.Marshal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<root xmlns="urn:schemas-upnp-org:device-1-0">`,
+		`<X_Feature xmlns="urn:example-com:device-1-0">on</X_Feature>`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("marshalled description %s does not contain %s", data, want)
+		}
+	}
+	if strings.Contains(string(data), "serviceList") {
+		t.Errorf("marshalled description contains empty serviceList: %s", data)
+	}
+}
+
+func TestDeviceFindVersions(t *testing.T) {
+	const (
+		wanIP1     = "urn:schemas-upnp-org:service:WANIPConnection:1"
+		wanIP2     = "urn:schemas-upnp-org:service:WANIPConnection:2"
+		wanConn1   = "urn:schemas-upnp-org:device:WANConnectionDevice:1"
+		wanConn2   = "urn:schemas-upnp-org:device:WANConnectionDevice:2"
+		wanDevice1 = "urn:schemas-upnp-org:device:WANDevice:1"
+	)
+	root := &RootDevice{Device: Device{
+		DeviceType: wanDevice1,
+		UDN:        "uuid:root",
+		Devices: []Device{
+			{
+				DeviceType: wanConn1,
+				UDN:        "uuid:conn1",
+				Services:   []Service{{ServiceType: wanIP1, ServiceId: "ip1"}},
+			},
+			{
+				DeviceType: wanConn2,
+				UDN:        "uuid:conn2",
+				Services:   []Service{{ServiceType: wanIP2, ServiceId: "ip2"}},
+			},
+		},
+	}}
+	device := &root.Device
+
+	serviceIDs := func(services []*Service) []string {
+		var ids []string
+		for _, s := range services {
+			ids = append(ids, s.ServiceId)
+		}
+		return ids
+	}
+	deviceUDNs := func(devices []*Device) []string {
+		var udns []string
+		for _, d := range devices {
+			udns = append(udns, d.UDN)
+		}
+		return udns
+	}
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"FindService v1", serviceIDs(device.FindService(wanIP1)), []string{"ip1"}},
+		{"FindServicesAtLeast v1", serviceIDs(device.FindServicesAtLeast(wanIP1)), []string{"ip1", "ip2"}},
+		{"FindServicesAtLeast v2", serviceIDs(device.FindServicesAtLeast(wanIP2)), []string{"ip2"}},
+		{"FindHighestService v1", serviceIDs(device.FindHighestService(wanIP1)), []string{"ip2"}},
+		{"FindDevicesAtLeast v1", deviceUDNs(device.FindDevicesAtLeast(wanConn1)), []string{"uuid:conn1", "uuid:conn2"}},
+		{"FindHighestDevice v1", deviceUDNs(device.FindHighestDevice(wanConn1)), []string{"uuid:conn2"}},
+		{"FindHighestDevice root", deviceUDNs(device.FindHighestDevice(wanDevice1)), []string{"uuid:root"}},
+		{"FindHighestDevice v3", deviceUDNs(device.FindHighestDevice(
+			"urn:schemas-upnp-org:device:WANConnectionDevice:3")), nil},
+	}
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, test.got, test.want)
+		}
+	}
+
+	// Exact matches are preferred, and later versions used if there are none.
+	for _, test := range []struct {
+		searchTarget string
+		want         string
+	}{
+		{wanIP1, "ip1"},
+		{wanIP2, "ip2"},
+	} {
+		clients, err := NewServiceClientsFromRootDevice(root, nil, test.searchTarget)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(clients) != 1 || clients[0].Service.ServiceId != test.want {
+			t.Errorf("NewServiceClientsFromRootDevice(%q) got %d clients, want one for %q",
+				test.searchTarget, len(clients), test.want)
+		}
+	}
+	root.Device.Devices = root.Device.Devices[1:]
+	clients, err := NewServiceClientsFromRootDevice(root, nil, wanIP1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clients) != 1 || clients[0].Service.ServiceId != "ip2" {
+		t.Errorf("NewServiceClientsFromRootDevice(%q) got %d clients, want one for %q", wanIP1, len(clients), "ip2")
+	}
+}
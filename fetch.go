@@ -0,0 +1,238 @@
+package goupnp
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/huin/goupnp/controlpoint"
+)
+
+// Defaults for FetchConfig.
+const (
+	// DefaultFetchTimeout is the default time limit for fetching a
+	// description.
+	DefaultFetchTimeout = 3 * time.Second
+	// DefaultMaxBodyBytes is the default limit on the size of a description.
+	DefaultMaxBodyBytes = 1 << 20
+	// DefaultMaxXMLDepth is the default limit on the nesting depth of
+	// elements in a description.
+	DefaultMaxXMLDepth = 32
+	// DefaultMaxXMLElements is the default limit on the number of elements in
+	// a description.
+	DefaultMaxXMLElements = 20000
+	// DefaultMaxDevices is the default limit on the number of devices in a
+	// device description, including the root device.
+	DefaultMaxDevices = 64
+	// DefaultMaxServices is the default limit on the number of services in a
+	// device description.
+	DefaultMaxServices = 256
+	// maxRedirects is the most redirects followed, as by http.Client.
+	maxRedirects = 10
+)
+
+// ErrFetchLimit is wrapped by the errors for descriptions that exceed the
+// limits of a FetchConfig.
+var ErrFetchLimit = errors.New("goupnp: description exceeds fetch limit")
+
+// FetchConfig configures the fetching of device and service descriptions. The
+// zero value uses HTTPClientDefault, DefaultFetchTimeout, the built-in
+// charsets and the default limits, and a FetchConfig must not be modified
+// while in use.
+type FetchConfig struct {
+	// HTTPClient performs the requests, HTTPClientDefault if nil.
+	HTTPClient *http.Client
+	// Timeout limits the time taken by each fetch, DefaultFetchTimeout if
+	// zero.
+	Timeout time.Duration
+	// Identity identifies the control point in requests. If nil, only a
+	// User-Agent with controlpoint.DefaultProduct is sent.
+	Identity *controlpoint.Identity
+	// CharsetReader converts descriptions in charsets other than UTF-8, for
+	// those declared in the document, or else in the Content-Type header. If
+	// nil, CharsetReaderDefault is used, or NewCharsetReader if that is also
+	// nil.
+	CharsetReader func(charset string, input io.Reader) (io.Reader, error)
+
+	// MaxBodyBytes limits the size of a description, DefaultMaxBodyBytes if
+	// zero.
+	MaxBodyBytes int64
+	// MaxXMLDepth limits the nesting depth of elements in a description,
+	// DefaultMaxXMLDepth if zero.
+	MaxXMLDepth int
+	// MaxXMLElements limits the number of elements in a description,
+	// DefaultMaxXMLElements if zero.
+	MaxXMLElements int
+	// MaxDevices limits the number of devices in a device description,
+	// including the root device, DefaultMaxDevices if zero.
+	MaxDevices int
+	// MaxServices limits the number of services in a device description,
+	// DefaultMaxServices if zero.
+	MaxServices int
+	// AllowCrossHostRedirects allows following redirects to hosts other than
+	// that of the description's URL, which are refused by default. Any
+	// CheckRedirect policy of HTTPClient also applies.
+	AllowCrossHostRedirects bool
+}
+
+// httpClient returns the client to make requests with, which applies the
+// redirect policy.
+func (cfg *FetchConfig) httpClient() *http.Client {
+	client := HTTPClientDefault
+	if cfg.HTTPClient != nil {
+		client = cfg.HTTPClient
+	}
+	if cfg.AllowCrossHostRedirects {
+		return client
+	}
+	withPolicy := *client
+	withPolicy.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if req.URL.Host != via[0].URL.Host {
+			return fmt.Errorf("goupnp: refusing redirect from %q to another host %q",
+				via[0].URL.Host, req.URL.Host)
+		}
+		if client.CheckRedirect != nil {
+			return client.CheckRedirect(req, via)
+		}
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("goupnp: stopped after %d redirects", maxRedirects)
+		}
+		return nil
+	}
+	return &withPolicy
+}
+
+func limitOrDefault(limit, def int) int {
+	if limit > 0 {
+		return limit
+	}
+	return def
+}
+
+func (cfg *FetchConfig) timeout() time.Duration {
+	if cfg.Timeout > 0 {
+		return cfg.Timeout
+	}
+	return DefaultFetchTimeout
+}
+
+func (cfg *FetchConfig) requestXml(ctx context.Context, url string, defaultSpace string, doc interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, cfg.timeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	cfg.Identity.SetRequestHeaders(req.Header)
+
+	resp, err := cfg.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("goupnp: got response status %s from %q",
+			resp.Status, url)
+	}
+
+	maxBytes := cfg.MaxBodyBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBodyBytes
+	}
+	body, charsetReader, err := cfg.decodeBody(
+		&limitedReader{r: resp.Body, remaining: maxBytes, max: maxBytes},
+		resp.Header.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+
+	tokens := xml.NewDecoder(body)
+	tokens.DefaultSpace = defaultSpace
+	tokens.CharsetReader = charsetReader
+	decoder := xml.NewTokenDecoder(&limitedTokenReader{
+		d:           tokens,
+		maxDepth:    limitOrDefault(cfg.MaxXMLDepth, DefaultMaxXMLDepth),
+		maxElements: limitOrDefault(cfg.MaxXMLElements, DefaultMaxXMLElements),
+	})
+	decoder.DefaultSpace = defaultSpace
+
+	return decoder.Decode(doc)
+}
+
+// checkDeviceCounts checks the numbers of devices and services in root
+// against the limits.
+func (cfg *FetchConfig) checkDeviceCounts(root *RootDevice) error {
+	var devices, services int
+	root.Device.VisitDevices(func(d *Device) {
+		devices++
+		services += len(d.Services)
+	})
+	if max := limitOrDefault(cfg.MaxDevices, DefaultMaxDevices); devices > max {
+		return fmt.Errorf("%w: more than %d devices", ErrFetchLimit, max)
+	}
+	if max := limitOrDefault(cfg.MaxServices, DefaultMaxServices); services > max {
+		return fmt.Errorf("%w: more than %d services", ErrFetchLimit, max)
+	}
+	return nil
+}
+
+// limitedReader reads from r, failing with ErrFetchLimit after max bytes.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	max       int64
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if lr.remaining <= 0 {
+		// Check whether the body ends at exactly the limit.
+		// Reads may return no bytes without an error, so only a byte read
+		// is over the limit.
+		var b [1]byte
+		n, err := lr.r.Read(b[:])
+		if n > 0 {
+			return 0, fmt.Errorf("%w: more than %d bytes", ErrFetchLimit, lr.max)
+		}
+		return 0, err
+	}
+	if int64(len(p)) > lr.remaining {
+		p = p[:lr.remaining]
+	}
+	n, err := lr.r.Read(p)
+	lr.remaining -= int64(n)
+	return n, err
+}
+
+// limitedTokenReader reads tokens from d, failing with ErrFetchLimit if the
+// elements are nested too deeply, or there are too many.
+type limitedTokenReader struct {
+	d           *xml.Decoder
+	maxDepth    int
+	maxElements int
+	depth       int
+	elements    int
+}
+
+func (tr *limitedTokenReader) Token() (xml.Token, error) {
+	t, err := tr.d.Token()
+	switch t.(type) {
+	case xml.StartElement:
+		tr.depth++
+		tr.elements++
+		if tr.depth > tr.maxDepth {
+			return nil, fmt.Errorf("%w: elements nested more than %d deep", ErrFetchLimit, tr.maxDepth)
+		}
+		if tr.elements > tr.maxElements {
+			return nil, fmt.Errorf("%w: more than %d elements", ErrFetchLimit, tr.maxElements)
+		}
+	case xml.EndElement:
+		tr.depth--
+	}
+	return t, err
+}
@@ -0,0 +1,299 @@
+package goupnp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <specVersion><major>1</major><minor>0</minor></specVersion>
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:Basic:1</deviceType>
+    <friendlyName>Test device</friendlyName>
+    <UDN>uuid:1</UDN>
+  </device>
+</root>`
+
+func TestFetchConfigDeviceByURL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow.xml" {
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte(testDescription))
+	}))
+	defer ts.Close()
+	loc, err := url.Parse(ts.URL + "/desc.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests int
+	client := ts.Client()
+	transport := client.Transport
+	client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return transport.RoundTrip(req)
+	})
+	cfg := &FetchConfig{HTTPClient: client, Timeout: 100 * time.Millisecond}
+
+	root, err := cfg.DeviceByURL(context.Background(), loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := root.Device.FriendlyName, "Test device"; got != want {
+		t.Errorf("got FriendlyName %q, want %q", got, want)
+	}
+	if requests != 1 {
+		t.Errorf("got %d requests through the configured client, want 1", requests)
+	}
+
+	slow, err := url.Parse(ts.URL + "/slow.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := cfg.DeviceByURL(context.Background(), slow); err == nil {
+		t.Error("fetching slow description: got success, want timeout")
+	}
+	if elapsed := time.Since(start); elapsed > DefaultFetchTimeout {
+		t.Errorf("fetching slow description took %v, want configured timeout", elapsed)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestFetchConfigLimits(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testDescription))
+	}))
+	defer other.Close()
+
+	embedded := `<device><deviceType>urn:schemas-upnp-org:device:Basic:1</deviceType>` +
+		`<UDN>uuid:2</UDN></device>`
+	descriptions := map[string]string{
+		"/desc.xml": testDescription,
+		"/big.xml": strings.Replace(testDescription, "<friendlyName>",
+			"<!--"+strings.Repeat(" ", 2000)+"--><friendlyName>", 1),
+		"/deep.xml": strings.Replace(testDescription, "<friendlyName>",
+			strings.Repeat("<a>", 10)+strings.Repeat("</a>", 10)+"<friendlyName>", 1),
+		"/many.xml": strings.Replace(testDescription, "<friendlyName>",
+			strings.Repeat("<a/>", 100)+"<friendlyName>", 1),
+		"/devices.xml": strings.Replace(testDescription, "<UDN>uuid:1</UDN>",
+			"<UDN>uuid:1</UDN><deviceList>"+embedded+embedded+"</deviceList>", 1),
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect-same.xml":
+			http.Redirect(w, r, "/desc.xml", http.StatusFound)
+		case "/redirect-other.xml":
+			http.Redirect(w, r, other.URL+"/desc.xml", http.StatusFound)
+		default:
+			w.Write([]byte(descriptions[r.URL.Path]))
+		}
+	}))
+	defer ts.Close()
+
+	cfg := &FetchConfig{
+		MaxBodyBytes:   1000,
+		MaxXMLDepth:    5,
+		MaxXMLElements: 50,
+		MaxDevices:     2,
+	}
+	tests := []struct {
+		path  string
+		limit bool // Whether a fetch limit is exceeded.
+		err   bool
+	}{
+		{"/desc.xml", false, false},
+		{"/big.xml", true, true},
+		{"/deep.xml", true, true},
+		{"/many.xml", true, true},
+		{"/devices.xml", true, true},
+		{"/redirect-same.xml", false, false},
+		{"/redirect-other.xml", false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			loc, err := url.Parse(ts.URL + test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = cfg.DeviceByURL(context.Background(), loc)
+			if gotErr := err != nil; gotErr != test.err {
+				t.Fatalf("got error %v, want error: %t", err, test.err)
+			}
+			if gotLimit := errors.Is(err, ErrFetchLimit); gotLimit != test.limit {
+				t.Errorf("got error %v, want ErrFetchLimit: %t", err, test.limit)
+			}
+		})
+	}
+
+	permissive := &FetchConfig{AllowCrossHostRedirects: true}
+	loc, err := url.Parse(ts.URL + "/redirect-other.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := permissive.DeviceByURL(context.Background(), loc); err != nil {
+		t.Errorf("got %v with cross-host redirects allowed, want success", err)
+	}
+}
+
+// emptyReadsReader returns (0, nil) before each read from r.
+type emptyReadsReader struct {
+	r     io.Reader
+	empty bool
+}
+
+func (er *emptyReadsReader) Read(p []byte) (int, error) {
+	er.empty = !er.empty
+	if er.empty {
+		return 0, nil
+	}
+	return er.r.Read(p)
+}
+
+func TestLimitedReader(t *testing.T) {
+	tests := []struct {
+		body    string
+		wantErr error
+	}{
+		{body: "1234"},
+		{body: "12345", wantErr: ErrFetchLimit},
+	}
+	for _, test := range tests {
+		lr := &limitedReader{
+			r:         &emptyReadsReader{r: strings.NewReader(test.body)},
+			remaining: 4,
+			max:       4,
+		}
+		got, err := ioutil.ReadAll(lr)
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("%q: got error %v, want %v", test.body, err, test.wantErr)
+		}
+		if test.wantErr == nil && string(got) != test.body {
+			t.Errorf("%q: got %q", test.body, got)
+		}
+	}
+}
+
+func TestFetchConfigCharsets(t *testing.T) {
+	// "Caf\xe9 \x80" is "Café €" in windows-1252.
+	const (
+		legacyName = "Caf\xe9 \x80"
+		wantName   = "Café €"
+	)
+	withName := func(decl, name string) string {
+		doc := strings.Replace(testDescription, "Test device", name, 1)
+		return strings.Replace(doc, `<?xml version="1.0"?>`, decl, 1)
+	}
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{
+			name: "utf-8",
+			body: withName(`<?xml version="1.0" encoding="utf-8"?>`, wantName),
+			want: wantName,
+		},
+		{
+			name: "declared ISO-8859-1",
+			body: withName(`<?xml version="1.0" encoding="ISO-8859-1"?>`, legacyName),
+			want: wantName,
+		},
+		{
+			name: "declared windows-1252",
+			body: withName(`<?xml version="1.0" encoding='windows-1252'?>`, legacyName),
+			want: wantName,
+		},
+		{
+			name:        "Content-Type charset",
+			contentType: `text/xml; charset="iso-8859-1"`,
+			body:        withName(`<?xml version="1.0"?>`, legacyName),
+			want:        wantName,
+		},
+		{
+			name:        "declaration overrides Content-Type",
+			contentType: `text/xml; charset="iso-8859-1"`,
+			body:        withName(`<?xml version="1.0" encoding="utf-8"?>`, wantName),
+			want:        wantName,
+		},
+		{
+			name: "UTF-8 BOM",
+			body: "\xEF\xBB\xBF" + withName(`<?xml version="1.0"?>`, wantName),
+			want: wantName,
+		},
+		{
+			name: "UTF-8 BOM overrides declaration",
+			body: "\xEF\xBB\xBF" + withName(`<?xml version="1.0" encoding="ISO-8859-1"?>`, wantName),
+			want: wantName,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if test.contentType != "" {
+					w.Header().Set("Content-Type", test.contentType)
+				}
+				w.Write([]byte(test.body))
+			}))
+			defer ts.Close()
+			loc, err := url.Parse(ts.URL + "/desc.xml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			root, err := (&FetchConfig{}).DeviceByURL(context.Background(), loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := root.Device.FriendlyName; got != test.want {
+				t.Errorf("got FriendlyName %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFetchConfigCharsetReader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Replace(testDescription,
+			`<?xml version="1.0"?>`, `<?xml version="1.0" encoding="x-test"?>`, 1)))
+	}))
+	defer ts.Close()
+	loc, err := url.Parse(ts.URL + "/desc.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (&FetchConfig{}).DeviceByURL(context.Background(), loc); err == nil {
+		t.Error("got success for unsupported charset, want error")
+	}
+
+	var gotCharset string
+	cfg := &FetchConfig{
+		CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+			gotCharset = charset
+			return input, nil
+		},
+	}
+	if _, err := cfg.DeviceByURL(context.Background(), loc); err != nil {
+		t.Fatal(err)
+	}
+	if gotCharset != "x-test" {
+		t.Errorf("got charset %q, want %q", gotCharset, "x-test")
+	}
+}
@@ -0,0 +1,166 @@
+// Package gena implements the UPnP General Event Notification Architecture
+// (GENA) used for eventing of service state variables, as described by section
+// 4 "Eventing" in
+// http://upnp.org/specs/arch/UPnP-arch-DeviceArchitecture-v1.1.pdf
+package gena
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// EventXMLNamespace is the XML namespace of the propertyset body of event
+	// messages.
+	EventXMLNamespace = "urn:schemas-upnp-org:event-1-0"
+
+	methodSubscribe   = "SUBSCRIBE"
+	methodUnsubscribe = "UNSUBSCRIBE"
+	methodNotify      = "NOTIFY"
+
+	ntEvent       = "upnp:event"
+	ntsPropChange = "upnp:propchange"
+
+	timeoutInfinite = "infinite"
+
+	// DefaultTimeout is the subscription duration requested if none is
+	// specified.
+	DefaultTimeout = 1800 * time.Second
+
+	// maxSeq is the largest SEQ value, after which the sequence wraps to 1.
+	maxSeq = 4294967295
+)
+
+// Property is the value of a single evented state variable.
+type Property struct {
+	// Name of the state variable.
+	Name string
+	// Value of the state variable, in its SOAP string encoding. Use the
+	// Unmarshal* functions in the soap package to convert it.
+	Value string
+}
+
+// Event is a single event message received for a subscription.
+type Event struct {
+	// SID is the subscription identifier that the event was sent for.
+	SID string
+	// Seq is the event key of the message. The initial event message for a
+	// subscription has a Seq of 0.
+	Seq uint32
+	// Missed is the number of event messages that were expected to arrive
+	// between the previous event and this one, but did not. If non-zero, then
+	// Properties may not reflect all state variable changes, and the
+	// subscriber may wish to query the state directly or resubscribe.
+	Missed uint32
+	// Properties contains the state variables in the event, in the order
+	// they appeared in the message.
+	Properties []Property
+}
+
+// Value returns the value of the named state variable in the event, and
+// whether it was present.
+func (e *Event) Value(name string) (string, bool) {
+	for _, p := range e.Properties {
+		if p.Name == name {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+type propertySet struct {
+	XMLName    xml.Name      `xml:"urn:schemas-upnp-org:event-1-0 propertyset"`
+	Properties []propertyXML `xml:"urn:schemas-upnp-org:event-1-0 property"`
+}
+
+type propertyXML struct {
+	Variables []variableXML `xml:",any"`
+}
+
+type variableXML struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+// ParsePropertySet decodes the e:propertyset body of an event message.
+func ParsePropertySet(r io.Reader) ([]Property, error) {
+	var ps propertySet
+	decoder := xml.NewDecoder(r)
+	if err := decoder.Decode(&ps); err != nil {
+		return nil, fmt.Errorf("gena: error decoding propertyset: %v", err)
+	}
+	var props []Property
+	for _, p := range ps.Properties {
+		for _, v := range p.Variables {
+			props = append(props, Property{
+				Name:  v.XMLName.Local,
+				Value: v.Value,
+			})
+		}
+	}
+	return props, nil
+}
+
+// WritePropertySet encodes the given properties as an e:propertyset body.
+func WritePropertySet(w io.Writer, props []Property) error {
+	if _, err := io.WriteString(w, xml.Header+`<e:propertyset xmlns:e="`+EventXMLNamespace+`">`); err != nil {
+		return err
+	}
+	for _, p := range props {
+		if _, err := io.WriteString(w, "<e:property><"+p.Name+">"); err != nil {
+			return err
+		}
+		if err := xml.EscapeText(w, []byte(p.Value)); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "</"+p.Name+"></e:property>"); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, `</e:propertyset>`)
+	return err
+}
+
+// formatTimeout formats a TIMEOUT header value. A non-positive duration is
+// formatted as an infinite timeout.
+func formatTimeout(d time.Duration) string {
+	if d <= 0 {
+		return "Second-" + timeoutInfinite
+	}
+	return "Second-" + strconv.FormatInt(int64(d/time.Second), 10)
+}
+
+// parseTimeout parses a TIMEOUT header value. An infinite timeout is returned
+// as zero.
+func parseTimeout(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, timeoutInfinite) {
+		return 0, nil
+	}
+	const prefix = "second-"
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return 0, fmt.Errorf("gena: bad TIMEOUT header %q", s)
+	}
+	s = s[len(prefix):]
+	if strings.EqualFold(s, timeoutInfinite) {
+		return 0, nil
+	}
+	secs, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("gena: bad TIMEOUT header %q: %v", s, err)
+	}
+	return time.Duration(secs) * time.Second, nil
+}
+
+// nextSeq returns the event key that follows seq. Event keys wrap to 1 rather
+// than 0, which is reserved for the initial event message.
+func nextSeq(seq uint32) uint32 {
+	if seq == maxSeq {
+		return 1
+	}
+	return seq + 1
+}
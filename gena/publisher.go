@@ -0,0 +1,349 @@
+package gena
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// notifyQueueSize is the number of event messages queued per subscriber
+	// before further messages are dropped.
+	notifyQueueSize = 16
+	// notifyTimeout bounds each NOTIFY request to a subscriber.
+	notifyTimeout = 30 * time.Second
+)
+
+var _ http.Handler = new(Publisher)
+
+// Publisher accepts event subscriptions for a single service, and sends event
+// messages to subscribers when state variables change.
+type Publisher struct {
+	// HTTPClient is used for NOTIFY requests. If nil, a client with a
+	// suitable timeout is used.
+	HTTPClient *http.Client
+	// MaxTimeout is the longest subscription duration granted to subscribers.
+	// DefaultTimeout is used if zero.
+	MaxTimeout time.Duration
+
+	lock   sync.Mutex
+	state  []Property
+	subs   map[string]*publisherSub
+	closed bool
+}
+
+type notifyMessage struct {
+	seq   uint32
+	props []Property
+}
+
+type publisherSub struct {
+	sid       string
+	callbacks []string
+	expiry    time.Time
+	nextSeq   uint32
+	queue     chan notifyMessage
+	done      chan struct{}
+}
+
+// NewPublisher creates a Publisher with the given initial values of the
+// evented state variables, which are sent to each new subscriber.
+func NewPublisher(initial []Property) *Publisher {
+	return &Publisher{
+		state: append([]Property(nil), initial...),
+		subs:  make(map[string]*publisherSub),
+	}
+}
+
+// State returns the current values of the evented state variables.
+func (pub *Publisher) State() []Property {
+	pub.lock.Lock()
+	defer pub.lock.Unlock()
+	return append([]Property(nil), pub.state...)
+}
+
+// Notify updates the values of the given state variables, and sends them in
+// an event message to all subscribers.
+func (pub *Publisher) Notify(props ...Property) {
+	if len(props) == 0 {
+		return
+	}
+	pub.lock.Lock()
+	defer pub.lock.Unlock()
+	for _, p := range props {
+		pub.setStateLocked(p)
+	}
+	pub.expireLocked(time.Now())
+	for _, s := range pub.subs {
+		s.enqueue(props)
+	}
+}
+
+// Close cancels all subscriptions. Subscription requests are refused after
+// this.
+func (pub *Publisher) Close() {
+	pub.lock.Lock()
+	defer pub.lock.Unlock()
+	pub.closed = true
+	for sid, s := range pub.subs {
+		close(s.done)
+		delete(pub.subs, sid)
+	}
+}
+
+func (pub *Publisher) setStateLocked(p Property) {
+	for i := range pub.state {
+		if pub.state[i].Name == p.Name {
+			pub.state[i].Value = p.Value
+			return
+		}
+	}
+	pub.state = append(pub.state, p)
+}
+
+// expireLocked removes subscriptions that have not been renewed in time.
+func (pub *Publisher) expireLocked(now time.Time) {
+	for sid, s := range pub.subs {
+		if !s.expiry.IsZero() && now.After(s.expiry) {
+			close(s.done)
+			delete(pub.subs, sid)
+		}
+	}
+}
+
+func (pub *Publisher) maxTimeout() time.Duration {
+	if pub.MaxTimeout > 0 {
+		return pub.MaxTimeout
+	}
+	return DefaultTimeout
+}
+
+// ServeHTTP implements http.Handler, and accepts SUBSCRIBE and UNSUBSCRIBE
+// requests.
+func (pub *Publisher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case methodSubscribe:
+		if r.Header.Get("SID") != "" {
+			pub.renew(w, r)
+		} else {
+			pub.subscribe(w, r)
+		}
+	case methodUnsubscribe:
+		pub.unsubscribe(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// grantTimeout determines the subscription duration to grant for the
+// requested TIMEOUT header value.
+func (pub *Publisher) grantTimeout(requested string) time.Duration {
+	timeout := pub.maxTimeout()
+	if requested == "" {
+		return timeout
+	}
+	if d, err := parseTimeout(requested); err == nil && d > 0 && d < timeout {
+		return d
+	}
+	return timeout
+}
+
+func (pub *Publisher) subscribe(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("NT") != ntEvent {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	callbacks := parseCallbacks(r.Header.Get("CALLBACK"))
+	if len(callbacks) == 0 {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	sid, err := newSID()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	timeout := pub.grantTimeout(r.Header.Get("TIMEOUT"))
+
+	s := &publisherSub{
+		sid:       sid,
+		callbacks: callbacks,
+		expiry:    time.Now().Add(timeout),
+		queue:     make(chan notifyMessage, notifyQueueSize),
+		done:      make(chan struct{}),
+	}
+
+	pub.lock.Lock()
+	if pub.closed {
+		pub.lock.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	pub.expireLocked(time.Now())
+	pub.subs[sid] = s
+	// Queue the initial event message while holding the lock, so that it
+	// precedes any subsequent changes.
+	s.enqueue(pub.state)
+	pub.lock.Unlock()
+
+	w.Header()["SID"] = []string{sid}
+	w.Header()["TIMEOUT"] = []string{formatTimeout(timeout)}
+	w.WriteHeader(http.StatusOK)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	// Only start sending once the subscriber has the response, so that it
+	// knows the SID of the initial event message.
+	go pub.deliver(s)
+}
+
+func (pub *Publisher) renew(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("NT") != "" || r.Header.Get("CALLBACK") != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	sid := r.Header.Get("SID")
+	timeout := pub.grantTimeout(r.Header.Get("TIMEOUT"))
+
+	pub.lock.Lock()
+	pub.expireLocked(time.Now())
+	s, ok := pub.subs[sid]
+	if ok {
+		s.expiry = time.Now().Add(timeout)
+	}
+	pub.lock.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+
+	w.Header()["SID"] = []string{sid}
+	w.Header()["TIMEOUT"] = []string{formatTimeout(timeout)}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (pub *Publisher) unsubscribe(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("NT") != "" || r.Header.Get("CALLBACK") != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	sid := r.Header.Get("SID")
+
+	pub.lock.Lock()
+	s, ok := pub.subs[sid]
+	if ok {
+		close(s.done)
+		delete(pub.subs, sid)
+	}
+	pub.lock.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// enqueue assigns the next event key to an event message and queues it for
+// delivery. If the queue is full, the message is dropped, and the subscriber
+// will see a gap in the event keys. Must be called with the Publisher's lock
+// held.
+func (s *publisherSub) enqueue(props []Property) {
+	msg := notifyMessage{
+		seq:   s.nextSeq,
+		props: append([]Property(nil), props...),
+	}
+	s.nextSeq = nextSeq(s.nextSeq)
+	select {
+	case s.queue <- msg:
+	default:
+		log.Printf("gena: dropped event message %d for subscription %s", msg.seq, s.sid)
+	}
+}
+
+// deliver sends queued event messages to the subscriber until the
+// subscription ends.
+func (pub *Publisher) deliver(s *publisherSub) {
+	client := pub.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: notifyTimeout}
+	}
+	for {
+		select {
+		case <-s.done:
+			return
+		case msg := <-s.queue:
+			if err := s.send(client, msg); err != nil {
+				log.Printf("gena: failed to send event message %d for subscription %s: %v",
+					msg.seq, s.sid, err)
+			}
+		}
+	}
+}
+
+// send sends an event message to the first of the subscriber's callback URLs
+// that accepts it.
+func (s *publisherSub) send(client *http.Client, msg notifyMessage) error {
+	body := &bytes.Buffer{}
+	if err := WritePropertySet(body, msg.props); err != nil {
+		return err
+	}
+	var err error
+	for _, callback := range s.callbacks {
+		var req *http.Request
+		req, err = http.NewRequest(methodNotify, callback, bytes.NewReader(body.Bytes()))
+		if err != nil {
+			continue
+		}
+		req.Header["CONTENT-TYPE"] = []string{`text/xml; charset="utf-8"`}
+		req.Header["NT"] = []string{ntEvent}
+		req.Header["NTS"] = []string{ntsPropChange}
+		req.Header["SID"] = []string{s.sid}
+		req.Header["SEQ"] = []string{strconv.FormatUint(uint64(msg.seq), 10)}
+		var resp *http.Response
+		resp, err = client.Do(req)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return nil
+		}
+		err = fmt.Errorf("NOTIFY to %s got HTTP %s", callback, resp.Status)
+	}
+	return err
+}
+
+// parseCallbacks parses the URLs from a CALLBACK header value of the form
+// "<url1><url2>". Only HTTP URLs are returned.
+func parseCallbacks(header string) []string {
+	var callbacks []string
+	for _, part := range strings.Split(header, "<") {
+		i := strings.IndexByte(part, '>')
+		if i < 0 {
+			continue
+		}
+		callback := strings.TrimSpace(part[:i])
+		if strings.HasPrefix(callback, "http://") {
+			callbacks = append(callbacks, callback)
+		}
+	}
+	return callbacks
+}
+
+// newSID creates a random subscription identifier of the form "uuid:...".
+func newSID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("gena: error creating SID: %v", err)
+	}
+	// Version 4 (random) UUID.
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("uuid:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
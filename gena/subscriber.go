@@ -0,0 +1,490 @@
+package gena
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// minRenewInterval bounds how often a subscription will be renewed, even
+	// if the publisher grants a very short timeout.
+	minRenewInterval = 5 * time.Second
+	// renewRequestTimeout bounds each automatic renewal request.
+	renewRequestTimeout = 10 * time.Second
+	// eventBufferSize is the number of events buffered per subscription before
+	// NOTIFY requests start waiting for the receiver.
+	eventBufferSize = 16
+)
+
+// ErrUnsubscribed is reported by Subscription.Err once the subscription has
+// been cancelled with Unsubscribe or Subscriber.Close.
+var ErrUnsubscribed = errors.New("gena: unsubscribed")
+
+var _ http.Handler = new(Subscriber)
+
+// Subscriber subscribes to events from UPnP services, and runs the HTTP server
+// that receives the resulting NOTIFY requests.
+type Subscriber struct {
+	// HTTPClient is used for SUBSCRIBE, renewal and UNSUBSCRIBE requests. If
+	// nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+	// Timeout is the subscription duration requested from publishers.
+	// DefaultTimeout is used if zero. Publishers may grant a different
+	// duration.
+	Timeout time.Duration
+
+	listener net.Listener
+	server   *http.Server
+
+	lock   sync.Mutex
+	byPath map[string]*Subscription
+}
+
+// NewSubscriber creates a Subscriber that accepts event messages on the given
+// TCP address. An empty addr listens on an arbitrary port on all interfaces.
+func NewSubscriber(addr string) (*Subscriber, error) {
+	if addr == "" {
+		addr = ":0"
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("gena: error listening for events: %v", err)
+	}
+	sub := &Subscriber{
+		listener: l,
+		byPath:   make(map[string]*Subscription),
+	}
+	sub.server = &http.Server{Handler: sub}
+	go func() {
+		if err := sub.server.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Printf("gena: event server stopped: %v", err)
+		}
+	}()
+	return sub, nil
+}
+
+// Close cancels all subscriptions (without sending UNSUBSCRIBE requests) and
+// stops accepting event messages.
+func (sub *Subscriber) Close() error {
+	sub.lock.Lock()
+	subs := make([]*Subscription, 0, len(sub.byPath))
+	for _, s := range sub.byPath {
+		subs = append(subs, s)
+	}
+	sub.lock.Unlock()
+
+	for _, s := range subs {
+		s.finish(ErrUnsubscribed)
+	}
+	return sub.server.Close()
+}
+
+func (sub *Subscriber) httpClient() *http.Client {
+	if sub.HTTPClient != nil {
+		return sub.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (sub *Subscriber) timeout() time.Duration {
+	if sub.Timeout != 0 {
+		return sub.Timeout
+	}
+	return DefaultTimeout
+}
+
+// Subscribe subscribes to events from the service with the given event
+// subscription URL (typically Service.EventSubURL). localIP is the address of
+// this host that the publisher should send events to; if nil, it is chosen
+// based on the route to the publisher.
+func (sub *Subscriber) Subscribe(ctx context.Context, eventSubURL *url.URL, localIP net.IP) (*Subscription, error) {
+	if localIP == nil {
+		var err error
+		if localIP, err = localIPFor(eventSubURL); err != nil {
+			return nil, err
+		}
+	}
+	_, port, err := net.SplitHostPort(sub.listener.Addr().String())
+	if err != nil {
+		return nil, err
+	}
+	path, err := newCallbackPath()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Subscription{
+		sub:         sub,
+		eventSubURL: *eventSubURL,
+		callbackURL: "http://" + net.JoinHostPort(localIP.String(), port) + path,
+		path:        path,
+		events:      make(chan Event, eventBufferSize),
+		done:        make(chan struct{}),
+	}
+
+	// Register before subscribing, as the initial event message may arrive
+	// before the SUBSCRIBE response.
+	sub.lock.Lock()
+	sub.byPath[path] = s
+	sub.lock.Unlock()
+
+	if err := s.subscribe(ctx); err != nil {
+		sub.remove(s)
+		return nil, err
+	}
+	go s.renewLoop()
+	return s, nil
+}
+
+func (sub *Subscriber) remove(s *Subscription) {
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	if sub.byPath[s.path] == s {
+		delete(sub.byPath, s.path)
+	}
+}
+
+// ServeHTTP implements http.Handler, and accepts NOTIFY event messages for
+// subscriptions.
+func (sub *Subscriber) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != methodNotify {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	sub.lock.Lock()
+	s := sub.byPath[r.URL.Path]
+	sub.lock.Unlock()
+	if s == nil {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	w.WriteHeader(s.handleNotify(r))
+}
+
+// Subscription is an active event subscription to a single service. Events
+// are delivered on the channel returned by Events, and the subscription is
+// renewed automatically before it times out.
+type Subscription struct {
+	sub         *Subscriber
+	eventSubURL url.URL
+	callbackURL string
+	path        string
+	events      chan Event
+	done        chan struct{}
+
+	// notifyLock serializes event message handling, so that events are
+	// delivered in the order they are handled.
+	notifyLock sync.Mutex
+
+	lock    sync.Mutex
+	sid     string
+	timeout time.Duration
+	// resubscribing is set while a new subscription replaces sid, whose
+	// initial event message may arrive before its SID is known.
+	resubscribing bool
+	haveFirst     bool
+	expectSeq     uint32
+	closed        bool
+	err           error
+	deliveries    sync.WaitGroup
+}
+
+// SID returns the current subscription identifier. This changes if the
+// subscription has to be re-established after a failed renewal.
+func (s *Subscription) SID() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.sid
+}
+
+// Events returns the channel on which events are delivered. The channel is
+// closed when the subscription ends, after which Err reports why.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Err returns the reason that the subscription ended, or nil if it is still
+// active.
+func (s *Subscription) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.err
+}
+
+// Renew renews the subscription immediately. This is not normally required,
+// as subscriptions are renewed automatically.
+func (s *Subscription) Renew(ctx context.Context) error {
+	s.lock.Lock()
+	sid := s.sid
+	s.lock.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, methodSubscribe, s.eventSubURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header["SID"] = []string{sid}
+	req.Header["TIMEOUT"] = []string{formatTimeout(s.sub.timeout())}
+	return s.doSubscribe(req)
+}
+
+// Unsubscribe cancels the subscription with the publisher, and closes the
+// Events channel.
+func (s *Subscription) Unsubscribe(ctx context.Context) error {
+	s.lock.Lock()
+	sid := s.sid
+	s.lock.Unlock()
+	if !s.finish(ErrUnsubscribed) {
+		return s.Err()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, methodUnsubscribe, s.eventSubURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header["SID"] = []string{sid}
+	resp, err := s.sub.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("gena: error performing UNSUBSCRIBE request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("gena: UNSUBSCRIBE request got HTTP %s", resp.Status)
+	}
+	return nil
+}
+
+// subscribe sends an initial SUBSCRIBE request for the subscription.
+func (s *Subscription) subscribe(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, methodSubscribe, s.eventSubURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header["CALLBACK"] = []string{"<" + s.callbackURL + ">"}
+	req.Header["NT"] = []string{ntEvent}
+	req.Header["TIMEOUT"] = []string{formatTimeout(s.sub.timeout())}
+
+	s.lock.Lock()
+	s.haveFirst = false
+	s.resubscribing = s.sid != ""
+	s.lock.Unlock()
+	err = s.doSubscribe(req)
+	if err != nil {
+		s.lock.Lock()
+		s.resubscribing = false
+		s.lock.Unlock()
+	}
+	return err
+}
+
+// doSubscribe performs a SUBSCRIBE request and records the SID and TIMEOUT
+// from the response.
+func (s *Subscription) doSubscribe(req *http.Request) error {
+	resp, err := s.sub.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("gena: error performing SUBSCRIBE request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("gena: SUBSCRIBE request got HTTP %s", resp.Status)
+	}
+	sid := resp.Header.Get("SID")
+	if sid == "" {
+		return errors.New("gena: SUBSCRIBE response missing SID")
+	}
+	// Some publishers omit TIMEOUT, assume that they granted the request.
+	timeout := s.sub.timeout()
+	if t := resp.Header.Get("TIMEOUT"); t != "" {
+		if timeout, err = parseTimeout(t); err != nil {
+			return err
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.sid = sid
+	s.resubscribing = false
+	s.timeout = timeout
+	return nil
+}
+
+// renewLoop renews the subscription before it times out, until the
+// subscription ends. If renewal fails, a new subscription is attempted.
+func (s *Subscription) renewLoop() {
+	for {
+		s.lock.Lock()
+		timeout := s.timeout
+		s.lock.Unlock()
+		if timeout == 0 {
+			// Infinite subscription.
+			<-s.done
+			return
+		}
+
+		interval := timeout / 2
+		if interval < minRenewInterval {
+			interval = minRenewInterval
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-s.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), renewRequestTimeout)
+		err := s.Renew(ctx)
+		cancel()
+		if err != nil {
+			// The publisher may have forgotten the subscription (e.g. it
+			// rebooted), so try to subscribe afresh.
+			ctx, cancel := context.WithTimeout(context.Background(), renewRequestTimeout)
+			err = s.subscribe(ctx)
+			cancel()
+		}
+		if err != nil {
+			s.finish(fmt.Errorf("gena: failed to renew subscription: %v", err))
+			return
+		}
+	}
+}
+
+// finish ends the subscription with the given reason, and closes the events
+// channel once in-flight deliveries have completed. It returns false if the
+// subscription had already ended.
+func (s *Subscription) finish(reason error) bool {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return false
+	}
+	s.closed = true
+	s.err = reason
+	close(s.done)
+	s.lock.Unlock()
+
+	s.sub.remove(s)
+	s.deliveries.Wait()
+	close(s.events)
+	return true
+}
+
+// handleNotify processes a NOTIFY request for the subscription, and returns
+// the HTTP status code to respond with.
+func (s *Subscription) handleNotify(r *http.Request) int {
+	s.notifyLock.Lock()
+	defer s.notifyLock.Unlock()
+
+	if r.Header.Get("NT") != ntEvent || r.Header.Get("NTS") != ntsPropChange {
+		return http.StatusPreconditionFailed
+	}
+	sid := r.Header.Get("SID")
+	seq64, err := strconv.ParseUint(r.Header.Get("SEQ"), 10, 32)
+	if sid == "" || err != nil {
+		return http.StatusBadRequest
+	}
+	seq := uint32(seq64)
+	props, err := ParsePropertySet(r.Body)
+	if err != nil {
+		return http.StatusBadRequest
+	}
+
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return http.StatusPreconditionFailed
+	}
+	if s.sid != "" && s.sid != sid {
+		if !s.resubscribing || seq != 0 {
+			s.lock.Unlock()
+			return http.StatusPreconditionFailed
+		}
+		// The initial event message of the new subscription arrived before
+		// the SUBSCRIBE response.
+		s.sid = sid
+		s.resubscribing = false
+	}
+	var missed uint32
+	if s.haveFirst {
+		var stale bool
+		missed, stale = seqGap(s.expectSeq, seq)
+		if stale {
+			// Duplicate or reordered message that has already been superseded.
+			s.lock.Unlock()
+			return http.StatusOK
+		}
+	}
+	s.haveFirst = true
+	s.expectSeq = nextSeq(seq)
+	s.deliveries.Add(1)
+	s.lock.Unlock()
+	defer s.deliveries.Done()
+
+	select {
+	case s.events <- Event{
+		SID:        sid,
+		Seq:        seq,
+		Missed:     missed,
+		Properties: props,
+	}:
+	case <-s.done:
+	}
+	return http.StatusOK
+}
+
+// seqGap returns the number of event keys skipped between the expected key
+// and the received key. stale is true if the received key is older than the
+// expected key.
+func seqGap(expected, got uint32) (missed uint32, stale bool) {
+	switch {
+	case got >= expected:
+		return got - expected, false
+	case got == 0:
+		// Publisher restarted the sequence for the subscription.
+		return 0, false
+	case expected-got < 1<<31:
+		return 0, true
+	default:
+		// Sequence wrapped around, skipping 0.
+		return maxSeq - expected + got, false
+	}
+}
+
+// newCallbackPath creates a random URL path that identifies a subscription.
+func newCallbackPath() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("gena: error creating callback path: %v", err)
+	}
+	return "/" + hex.EncodeToString(b[:]), nil
+}
+
+// localIPFor returns the local address that would be used to reach the host in
+// the given URL.
+func localIPFor(u *url.URL) (net.IP, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "80")
+	}
+	// Dialing UDP sends no packets, but selects a route and local address.
+	conn, err := net.Dial("udp", host)
+	if err != nil {
+		return nil, fmt.Errorf("gena: error finding local address for %q: %v", u.Host, err)
+	}
+	defer conn.Close()
+	addr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return nil, fmt.Errorf("gena: unexpected local address type %T", conn.LocalAddr())
+	}
+	return addr.IP, nil
+}
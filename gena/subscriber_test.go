@@ -0,0 +1,252 @@
+package gena
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakePublisher accepts SUBSCRIBE and UNSUBSCRIBE requests, and records the
+// callback URL for sending events.
+type fakePublisher struct {
+	lock         sync.Mutex
+	callback     string
+	unsubscribed bool
+}
+
+func (fp *fakePublisher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fp.lock.Lock()
+	defer fp.lock.Unlock()
+	switch r.Method {
+	case methodSubscribe:
+		if cb := r.Header.Get("CALLBACK"); cb != "" {
+			fp.callback = strings.Trim(cb, "<>")
+		}
+		w.Header()["SID"] = []string{"uuid:fake-sid"}
+		w.Header()["TIMEOUT"] = []string{"Second-1800"}
+	case methodUnsubscribe:
+		fp.unsubscribed = true
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (fp *fakePublisher) notify(t *testing.T, seq uint32, props []Property) {
+	t.Helper()
+	fp.lock.Lock()
+	callback := fp.callback
+	fp.lock.Unlock()
+
+	body := &bytes.Buffer{}
+	if err := WritePropertySet(body, props); err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(methodNotify, callback, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header["NT"] = []string{ntEvent}
+	req.Header["NTS"] = []string{ntsPropChange}
+	req.Header["SID"] = []string{"uuid:fake-sid"}
+	req.Header["SEQ"] = []string{strconv.FormatUint(uint64(seq), 10)}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("NOTIFY got HTTP %s", resp.Status)
+	}
+}
+
+func TestSubscription(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	pub := &fakePublisher{}
+	ts := httptest.NewServer(pub)
+	t.Cleanup(ts.Close)
+	eventURL, err := url.Parse(ts.URL + "/event")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := NewSubscriber("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sub.Close() })
+
+	s, err := sub.Subscribe(ctx, eventURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.SID(), "uuid:fake-sid"; got != want {
+		t.Errorf("got SID %q, want %q", got, want)
+	}
+
+	pub.notify(t, 0, []Property{{Name: "Volume", Value: "10"}, {Name: "Mute", Value: "0"}})
+	pub.notify(t, 1, []Property{{Name: "LastChange", Value: `<Event a="1">&</Event>`}})
+	pub.notify(t, 4, []Property{{Name: "Volume", Value: "11"}})
+
+	wantEvents := []Event{
+		{SID: "uuid:fake-sid", Seq: 0, Properties: []Property{{"Volume", "10"}, {"Mute", "0"}}},
+		{SID: "uuid:fake-sid", Seq: 1, Properties: []Property{{"LastChange", `<Event a="1">&</Event>`}}},
+		{SID: "uuid:fake-sid", Seq: 4, Missed: 2, Properties: []Property{{"Volume", "11"}}},
+	}
+	for i, want := range wantEvents {
+		got := <-s.Events()
+		if got.SID != want.SID || got.Seq != want.Seq || got.Missed != want.Missed ||
+			len(got.Properties) != len(want.Properties) {
+			t.Errorf("event %d: got %+v, want %+v", i, got, want)
+			continue
+		}
+		for j := range want.Properties {
+			if got.Properties[j] != want.Properties[j] {
+				t.Errorf("event %d property %d: got %+v, want %+v", i, j, got.Properties[j], want.Properties[j])
+			}
+		}
+	}
+
+	if err := s.Unsubscribe(ctx); err != nil {
+		t.Errorf("Unsubscribe: got error %v, want success", err)
+	}
+	if _, ok := <-s.Events(); ok {
+		t.Error("got event after Unsubscribe, want closed channel")
+	}
+	if err := s.Err(); err != ErrUnsubscribed {
+		t.Errorf("got Err() = %v, want %v", err, ErrUnsubscribed)
+	}
+	pub.lock.Lock()
+	defer pub.lock.Unlock()
+	if !pub.unsubscribed {
+		t.Error("publisher did not receive UNSUBSCRIBE")
+	}
+}
+
+func TestSeqGap(t *testing.T) {
+	tests := []struct {
+		expected, got uint32
+		wantMissed    uint32
+		wantStale     bool
+	}{
+		{expected: 5, got: 5, wantMissed: 0},
+		{expected: 5, got: 8, wantMissed: 3},
+		{expected: 5, got: 3, wantStale: true},
+		{expected: 5, got: 0, wantMissed: 0},
+		{expected: maxSeq, got: 1, wantMissed: 1},
+		{expected: maxSeq - 1, got: 2, wantMissed: 3},
+	}
+	for _, test := range tests {
+		missed, stale := seqGap(test.expected, test.got)
+		if missed != test.wantMissed || stale != test.wantStale {
+			t.Errorf("seqGap(%d, %d) = %d, %t; want %d, %t",
+				test.expected, test.got, missed, stale, test.wantMissed, test.wantStale)
+		}
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{s: "Second-1800", want: 1800 * time.Second},
+		{s: "second-60", want: 60 * time.Second},
+		{s: "Second-infinite", want: 0},
+		{s: "infinite", want: 0},
+		{s: "1800", wantErr: true},
+		{s: "Second-abc", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseTimeout(test.s)
+		if gotErr := err != nil; gotErr != test.wantErr || got != test.want {
+			t.Errorf("parseTimeout(%q) = %v, %v; want %v, error=%t",
+				test.s, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+// resubscribePublisher sends the initial event message of each new
+// subscription before responding to its SUBSCRIBE request, with a new SID for
+// each.
+type resubscribePublisher struct {
+	t    *testing.T
+	lock sync.Mutex
+	subs int
+}
+
+func (rp *resubscribePublisher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rp.lock.Lock()
+	rp.subs++
+	sid := "uuid:sid-" + strconv.Itoa(rp.subs)
+	rp.lock.Unlock()
+
+	body := &bytes.Buffer{}
+	if err := WritePropertySet(body, []Property{{Name: "Volume", Value: "10"}}); err != nil {
+		rp.t.Error(err)
+		return
+	}
+	req, err := http.NewRequest(methodNotify, strings.Trim(r.Header.Get("CALLBACK"), "<>"), body)
+	if err != nil {
+		rp.t.Error(err)
+		return
+	}
+	req.Header["NT"] = []string{ntEvent}
+	req.Header["NTS"] = []string{ntsPropChange}
+	req.Header["SID"] = []string{sid}
+	req.Header["SEQ"] = []string{"0"}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		rp.t.Error(err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		rp.t.Errorf("initial NOTIFY for %s got HTTP %s", sid, resp.Status)
+	}
+	w.Header()["SID"] = []string{sid}
+	w.Header()["TIMEOUT"] = []string{"Second-1800"}
+}
+
+func TestSubscriptionResubscribe(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	ts := httptest.NewServer(&resubscribePublisher{t: t})
+	t.Cleanup(ts.Close)
+	eventURL, err := url.Parse(ts.URL + "/event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := NewSubscriber("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sub.Close() })
+
+	s, err := sub.Subscribe(ctx, eventURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// As after a failed renewal.
+	if err := s.subscribe(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.SID(), "uuid:sid-2"; got != want {
+		t.Errorf("got SID %q, want %q", got, want)
+	}
+	for _, wantSID := range []string{"uuid:sid-1", "uuid:sid-2"} {
+		if got := <-s.Events(); got.SID != wantSID || got.Seq != 0 {
+			t.Errorf("got event %+v, want the initial event for %s", got, wantSID)
+		}
+	}
+}
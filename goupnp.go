@@ -16,14 +16,16 @@ package goupnp
 
 import (
 	"context"
-	"encoding/xml"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/huin/goupnp/controlpoint"
 	"github.com/huin/goupnp/httpu"
 	"github.com/huin/goupnp/ssdp"
 )
@@ -52,13 +54,19 @@ func (err ContextError) Error() string {
 	return fmt.Sprintf("%s: %v", err.Context, err.Err)
 }
 
+// Unwrap returns the wrapped error.
+func (err ContextError) Unwrap() error {
+	return err.Err
+}
+
 // MaybeRootDevice contains either a RootDevice or an error.
 type MaybeRootDevice struct {
 	// Identifier of the device. Note that this in combination with Location
 	// uniquely identifies a result from DiscoverDevices.
 	USN string
 
-	// Set iff Err == nil.
+	// Set iff Err == nil, unless descriptions were not fetched (see
+	// DiscoveryOptions.SkipFetch).
 	Root *RootDevice
 
 	// The location the device was discovered at. This can be used with
@@ -69,10 +77,61 @@ type MaybeRootDevice struct {
 	// The address from which the device was discovered (if known - otherwise nil).
 	LocalAddr net.IP
 
+	// The search response that the device was discovered from, with its
+	// SERVER, ST, CACHE-CONTROL max-age, BOOTID.UPNP.ORG and other headers.
+	Response *ssdp.SearchResponse
+
 	// Any error encountered probing a discovered device.
 	Err error
 }
 
+// Defaults for DiscoveryOptions.
+const (
+	DefaultSearchDuration       = 2 * time.Second
+	DefaultSearchSends          = 3
+	DefaultMaxConcurrentFetches = 4
+)
+
+// DiscoveryOptions configures DiscoverDevicesWithOptions. The zero value
+// gives the behaviour of DiscoverDevicesCtx.
+type DiscoveryOptions struct {
+	// SearchDuration is how long to wait for search responses,
+	// DefaultSearchDuration if zero.
+	SearchDuration time.Duration
+	// MX is the maximum time in seconds that devices may wait before
+	// responding, the whole seconds of SearchDuration if zero (at least 1).
+	MX int
+	// NumSends is the number of search requests to send,
+	// DefaultSearchSends if zero.
+	NumSends int
+	// Interfaces limits searching to the named network interfaces, all
+	// multicast-capable interfaces if empty.
+	Interfaces []string
+	// LocalAddrs limits searching to the given local addresses, all
+	// addresses of the searched interfaces if empty.
+	LocalAddrs []net.IP
+	// Identity identifies the control point in searches, and in fetches of
+	// device descriptions unless Fetch.Identity is set.
+	Identity *controlpoint.Identity
+	// Fetch configures the fetching of device descriptions.
+	Fetch FetchConfig
+	// MaxConcurrentFetches limits the number of device descriptions fetched
+	// at once, DefaultMaxConcurrentFetches if zero.
+	MaxConcurrentFetches int
+	// SkipFetch disables fetching device descriptions, so that results only
+	// have USN, Location, LocalAddr and Response set.
+	SkipFetch bool
+	// LocationPolicy validates the locations of search responses before
+	// their descriptions are fetched. Results with rejected locations are not
+	// fetched, and have an *ssdp.LocationError as their Err. If nil, the
+	// strictest policy (the zero ssdp.LocationPolicy) is used, so that a
+	// hostile device cannot have arbitrary URLs fetched. Set a more
+	// permissive policy, e.g. with AllowOtherHosts or AllowPublicAddrs, for
+	// devices that need it. Unlike here, ssdp.Searcher and ssdp.Registry do
+	// not check locations unless given a policy, as they do not fetch them.
+	LocationPolicy *ssdp.LocationPolicy
+}
+
 // DiscoverDevicesCtx attempts to find targets of the given type. This is
 // typically the entry-point for this package. searchTarget is typically a URN
 // in the form "urn:schemas-upnp-org:device:..." or
@@ -80,40 +139,265 @@ type MaybeRootDevice struct {
 // while attempting to send the query. An error or RootDevice is returned for
 // each discovered RootDevice.
 func DiscoverDevicesCtx(ctx context.Context, searchTarget string) ([]MaybeRootDevice, error) {
-	hc, hcCleanup, err := httpuClient()
+	return DiscoverDevicesWithOptions(ctx, searchTarget, &DiscoveryOptions{})
+}
+
+// DiscoverDevicesWithOptions is like DiscoverDevicesCtx, but configured by
+// opts rather than using package defaults. It collects the results of
+// DiscoverDevicesStream, in the order that they become available.
+func DiscoverDevicesWithOptions(ctx context.Context, searchTarget string, opts *DiscoveryOptions) ([]MaybeRootDevice, error) {
+	var results []MaybeRootDevice
+	err := DiscoverDevicesStream(ctx, searchTarget, opts, func(maybe MaybeRootDevice) {
+		results = append(results, maybe)
+	})
 	if err != nil {
 		return nil, err
 	}
+	return results, nil
+}
+
+// DiscoverDevicesStream is like DiscoverDevicesWithOptions, but calls handler
+// with each result as soon as it is available, rather than returning them
+// once all are. A result is available once its search response is received,
+// or if descriptions are fetched, once its description has been. Fetching
+// starts as soon as the first response from each location is received.
+// handler is not called concurrently, nor after DiscoverDevicesStream
+// returns. Cancel the context to end the search early.
+func DiscoverDevicesStream(ctx context.Context, searchTarget string, opts *DiscoveryOptions, handler func(MaybeRootDevice)) error {
+	hc, hcCleanup, err := httpuClient(opts.searchesFrom)
+	if err != nil {
+		return err
+	}
 	defer hcCleanup()
 
-	searchCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	searchCtx, cancel, mx, numSends := opts.searchParams(ctx)
 	defer cancel()
-	responses, err := ssdp.RawSearch(searchCtx, hc, string(searchTarget), 3)
+	searcher := &ssdp.Searcher{Identity: opts.Identity}
+	return opts.stream(ctx, func(handle func(*http.Response)) error {
+		return searcher.RawSearchStream(searchCtx, hc, string(searchTarget), mx, numSends, handle)
+	}, handler)
+}
+
+// stream calls handler with the result for each search response that search
+// passes to its handle function, once the result is available. It returns
+// once search has returned and all results have been handled.
+func (opts *DiscoveryOptions) stream(
+	ctx context.Context,
+	search func(handle func(*http.Response)) error,
+	handler func(MaybeRootDevice),
+) error {
+	var handlerLock sync.Mutex
+	handle := func(maybe MaybeRootDevice) {
+		handlerLock.Lock()
+		defer handlerLock.Unlock()
+		handler(maybe)
+	}
+
+	f := opts.newFetcher()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	return search(func(response *http.Response) {
+		maybe := opts.newMaybeRootDevice(response)
+		if maybe.Err != nil || opts.SkipFetch {
+			handle(maybe)
+			return
+		}
+		fr := f.fetch(ctx, maybe.Location)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-fr.done
+			maybe.Root, maybe.Err = fr.root, fr.err
+			handle(maybe)
+		}()
+	})
+}
+
+// searchParams returns the context for the search, and the MX and number of
+// sends to search with.
+func (opts *DiscoveryOptions) searchParams(ctx context.Context) (context.Context, context.CancelFunc, int, int) {
+	searchDuration := opts.SearchDuration
+	if searchDuration <= 0 {
+		searchDuration = DefaultSearchDuration
+	}
+	mx := opts.MX
+	if mx <= 0 {
+		mx = int(searchDuration / time.Second)
+		if mx < 1 {
+			mx = 1
+		}
+	}
+	numSends := opts.NumSends
+	if numSends <= 0 {
+		numSends = DefaultSearchSends
+	}
+	searchCtx, cancel := context.WithTimeout(ctx, searchDuration)
+	return searchCtx, cancel, mx, numSends
+}
+
+// newMaybeRootDevice creates the result for a search response, without
+// fetching its description. Err is set if the location is missing or
+// rejected by the location policy.
+func (opts *DiscoveryOptions) newMaybeRootDevice(response *http.Response) MaybeRootDevice {
+	var maybe MaybeRootDevice
+	maybe.USN = response.Header.Get("USN")
+	maybe.Response = ssdp.NewSearchResponse(response)
+	if i := response.Header.Get(httpu.LocalAddressHeader); len(i) > 0 {
+		// Strip any IPv6 zone, which net.IP cannot represent.
+		if zone := strings.LastIndexByte(i, '%'); zone >= 0 {
+			i = i[:zone]
+		}
+		maybe.LocalAddr = net.ParseIP(i)
+	}
+	loc, err := response.Location()
 	if err != nil {
-		return nil, err
+		maybe.Err = ContextError{"unexpected bad location from search", err}
+		return maybe
+	}
+	maybe.Location = loc
+	policy := opts.LocationPolicy
+	if policy == nil {
+		policy = &ssdp.LocationPolicy{}
 	}
+	maybe.Err = policy.Check(loc, response.Header.Get(httpu.RemoteAddressHeader))
+	return maybe
+}
 
-	results := make([]MaybeRootDevice, len(responses))
-	for i, response := range responses {
-		maybe := &results[i]
-		maybe.USN = response.Header.Get("USN")
-		loc, err := response.Location()
-		if err != nil {
-			maybe.Err = ContextError{"unexpected bad location from search", err}
-			continue
+// fetcher fetches each root device description once, with a limited number
+// of fetches at a time.
+type fetcher struct {
+	cfg   *FetchConfig
+	slots chan struct{}
+
+	lock  sync.Mutex
+	byLoc map[string]*fetchResult
+}
+
+// fetchResult is the result of fetching a root device description. root and
+// err are set once done is closed.
+type fetchResult struct {
+	done chan struct{}
+	root *RootDevice
+	err  error
+}
+
+func (opts *DiscoveryOptions) newFetcher() *fetcher {
+	maxFetches := opts.MaxConcurrentFetches
+	if maxFetches <= 0 {
+		maxFetches = DefaultMaxConcurrentFetches
+	}
+	cfg := opts.Fetch
+	if cfg.Identity == nil {
+		cfg.Identity = opts.Identity
+	}
+	return &fetcher{
+		cfg:   &cfg,
+		slots: make(chan struct{}, maxFetches),
+		byLoc: make(map[string]*fetchResult),
+	}
+}
+
+// fetch returns the result of fetching the description at loc, starting the
+// fetch if it has not been already.
+func (f *fetcher) fetch(ctx context.Context, loc *url.URL) *fetchResult {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if fr, ok := f.byLoc[loc.String()]; ok {
+		return fr
+	}
+	fr := &fetchResult{done: make(chan struct{})}
+	f.byLoc[loc.String()] = fr
+	go func() {
+		defer close(fr.done)
+		select {
+		case f.slots <- struct{}{}:
+			defer func() { <-f.slots }()
+		case <-ctx.Done():
+			fr.err = ctx.Err()
+			return
 		}
-		maybe.Location = loc
-		if root, err := DeviceByURLCtx(ctx, loc); err != nil {
-			maybe.Err = err
-		} else {
-			maybe.Root = root
+		fr.root, fr.err = f.cfg.DeviceByURL(ctx, loc)
+	}()
+	return fr
+}
+
+// DiscoveredRootDevice groups the results of discovery for a single root
+// device.
+type DiscoveredRootDevice struct {
+	// The USNs that the root device, and its embedded devices and services,
+	// responded to the search with.
+	USNs []string
+
+	// Set iff Err == nil, unless descriptions were not fetched.
+	Root *RootDevice
+
+	// The location of the root device description. If the device responded
+	// with multiple locations, this is the first.
+	Location *url.URL
+
+	// The address from which the device was discovered (if known - otherwise
+	// nil).
+	LocalAddr net.IP
+
+	// Any error encountered probing the device.
+	Err error
+}
+
+// GroupByRootDevice groups discovery results by root device, in the order
+// that each root device first appears in results. Results are grouped by the
+// UDN of their root device, or when it is unknown, by their location.
+// Results without a location are not grouped with any other.
+func GroupByRootDevice(results []MaybeRootDevice) []DiscoveredRootDevice {
+	var groups []DiscoveredRootDevice
+	indexByKey := make(map[string]int)
+	for _, maybe := range results {
+		var key string
+		switch {
+		case maybe.Root != nil:
+			key = "udn:" + maybe.Root.Device.UDN
+		case maybe.Location != nil:
+			key = "loc:" + maybe.Location.String()
 		}
-		if i := response.Header.Get(httpu.LocalAddressHeader); len(i) > 0 {
-			maybe.LocalAddr = net.ParseIP(i)
+		if i, ok := indexByKey[key]; ok && key != "" {
+			groups[i].USNs = append(groups[i].USNs, maybe.USN)
+			continue
 		}
+		indexByKey[key] = len(groups)
+		groups = append(groups, DiscoveredRootDevice{
+			USNs:      []string{maybe.USN},
+			Root:      maybe.Root,
+			Location:  maybe.Location,
+			LocalAddr: maybe.LocalAddr,
+			Err:       maybe.Err,
+		})
 	}
+	return groups
+}
 
-	return results, nil
+// searchesFrom reports whether to search from the local address ip of iface.
+func (opts *DiscoveryOptions) searchesFrom(iface *net.Interface, ip net.IP) bool {
+	if len(opts.Interfaces) > 0 && !containsString(opts.Interfaces, iface.Name) {
+		return false
+	}
+	if len(opts.LocalAddrs) == 0 {
+		return true
+	}
+	for _, addr := range opts.LocalAddrs {
+		if addr.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
 }
 
 // DiscoverDevices is the legacy version of DiscoverDevicesCtx, but uses
@@ -122,12 +406,22 @@ func DiscoverDevices(searchTarget string) ([]MaybeRootDevice, error) {
 	return DiscoverDevicesCtx(context.Background(), searchTarget)
 }
 
+// DeviceByURLCtx fetches the root device description at loc, using the
+// default FetchConfig.
 func DeviceByURLCtx(ctx context.Context, loc *url.URL) (*RootDevice, error) {
+	return (&FetchConfig{}).DeviceByURL(ctx, loc)
+}
+
+// DeviceByURL fetches the root device description at loc.
+func (cfg *FetchConfig) DeviceByURL(ctx context.Context, loc *url.URL) (*RootDevice, error) {
 	locStr := loc.String()
 	root := new(RootDevice)
-	if err := requestXml(ctx, locStr, DeviceXMLNamespace, root); err != nil {
+	if err := cfg.requestXml(ctx, locStr, DeviceXMLNamespace, root); err != nil {
 		return nil, ContextError{fmt.Sprintf("error requesting root device details from %q", locStr), err}
 	}
+	if err := cfg.checkDeviceCounts(root); err != nil {
+		return nil, ContextError{fmt.Sprintf("error in root device details from %q", locStr), err}
+	}
 	var urlBaseStr string
 	if root.URLBaseStr != "" {
 		urlBaseStr = root.URLBaseStr
@@ -148,36 +442,11 @@ func DeviceByURL(loc *url.URL) (*RootDevice, error) {
 
 // CharsetReaderDefault specifies the charset reader used while decoding the output
 // from a UPnP server. It can be modified in an init function to allow for non-utf8 encodings,
-// but should not be changed after requesting clients.
+// but should not be changed after requesting clients. If nil, NewCharsetReader is used.
+//
+// Deprecated: set FetchConfig.CharsetReader instead.
 var CharsetReaderDefault func(charset string, input io.Reader) (io.Reader, error)
 
 // HTTPClient specifies the http.Client object used when fetching the XML from the UPnP server.
 // HTTPClient defaults the http.DefaultClient.  This may be overridden by the importing application.
 var HTTPClientDefault = http.DefaultClient
-
-func requestXml(ctx context.Context, url string, defaultSpace string, doc interface{}) error {
-	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return err
-	}
-
-	resp, err := HTTPClientDefault.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("goupnp: got response status %s from %q",
-			resp.Status, url)
-	}
-
-	decoder := xml.NewDecoder(resp.Body)
-	decoder.DefaultSpace = defaultSpace
-	decoder.CharsetReader = CharsetReaderDefault
-
-	return decoder.Decode(doc)
-}
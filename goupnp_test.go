@@ -0,0 +1,143 @@
+package goupnp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/huin/goupnp/httpu"
+	"github.com/huin/goupnp/ssdp"
+)
+
+// streamResults returns the results that opts.stream gives for the search
+// responses.
+func streamResults(t *testing.T, opts *DiscoveryOptions, responses []*http.Response) []MaybeRootDevice {
+	t.Helper()
+	var results []MaybeRootDevice
+	err := opts.stream(context.Background(), func(handle func(*http.Response)) error {
+		for _, response := range responses {
+			handle(response)
+		}
+		return nil
+	}, func(maybe MaybeRootDevice) {
+		results = append(results, maybe)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(responses) {
+		t.Fatalf("got %d results, want %d", len(results), len(responses))
+	}
+	return results
+}
+
+func TestDiscoveryResultsFetchOnce(t *testing.T) {
+	var lock sync.Mutex
+	fetches := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		fetches[r.URL.Path]++
+		lock.Unlock()
+		if r.URL.Path == "/missing.xml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(testDescription))
+	}))
+	defer ts.Close()
+
+	response := func(usn, path string) *http.Response {
+		header := http.Header{}
+		header.Set("USN", usn)
+		header.Set("Location", ts.URL+path)
+		header.Set(httpu.RemoteAddressHeader, "127.0.0.1:1900")
+		return &http.Response{StatusCode: 200, Header: header}
+	}
+	responses := []*http.Response{
+		response("uuid:1::upnp:rootdevice", "/desc.xml"),
+		response("uuid:1", "/desc.xml"),
+		response("uuid:1::urn:schemas-upnp-org:device:Basic:1", "/desc.xml"),
+		response("uuid:2", "/missing.xml"),
+		response("uuid:2::upnp:rootdevice", "/missing.xml"),
+	}
+
+	opts := &DiscoveryOptions{MaxConcurrentFetches: 2}
+	results := streamResults(t, opts, responses)
+	// Results are in the order that they become available.
+	byUSN := make(map[string]MaybeRootDevice)
+	for _, maybe := range results {
+		byUSN[maybe.USN] = maybe
+	}
+	if r := byUSN["uuid:1::upnp:rootdevice"].Response; r == nil || r.USN != "uuid:1::upnp:rootdevice" || r.Location.String() != ts.URL+"/desc.xml" {
+		t.Errorf("got search response %+v, want the parsed response", r)
+	}
+	for path, n := range fetches {
+		if n != 1 {
+			t.Errorf("got %d fetches of %s, want 1", n, path)
+		}
+	}
+	root := byUSN["uuid:1::upnp:rootdevice"].Root
+	if root == nil || byUSN["uuid:1"].Root != root || byUSN["uuid:1::urn:schemas-upnp-org:device:Basic:1"].Root != root {
+		t.Errorf("got roots %p, %p, %p, want the same root device",
+			root, byUSN["uuid:1"].Root, byUSN["uuid:1::urn:schemas-upnp-org:device:Basic:1"].Root)
+	}
+	if byUSN["uuid:2"].Err == nil || byUSN["uuid:2::upnp:rootdevice"].Err == nil {
+		t.Errorf("got errors %v, %v, want errors for missing description",
+			byUSN["uuid:2"].Err, byUSN["uuid:2::upnp:rootdevice"].Err)
+	}
+
+	groups := GroupByRootDevice(results)
+	if len(groups) != 2 {
+		t.Fatalf("got %d groups, want 2", len(groups))
+	}
+	if groups[0].Err != nil {
+		groups[0], groups[1] = groups[1], groups[0]
+	}
+	if got := len(groups[0].USNs); got != 3 || groups[0].Root != root {
+		t.Errorf("got first group %+v, want 3 USNs of the found root device", groups[0])
+	}
+	if got := len(groups[1].USNs); got != 2 || groups[1].Err == nil {
+		t.Errorf("got second group %+v, want 2 USNs with an error", groups[1])
+	}
+}
+
+func TestDiscoveryResultsLocationPolicy(t *testing.T) {
+	var lock sync.Mutex
+	var fetches int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		fetches++
+		lock.Unlock()
+		w.Write([]byte(testDescription))
+	}))
+	defer ts.Close()
+
+	header := http.Header{}
+	header.Set("USN", "uuid:1::upnp:rootdevice")
+	header.Set("Location", ts.URL+"/desc.xml")
+	// A peer other than the device's host sent the response.
+	header.Set(httpu.RemoteAddressHeader, "192.168.1.5:1900")
+	responses := []*http.Response{{StatusCode: 200, Header: header}}
+
+	// The strictest policy is used by default.
+	for _, opts := range []*DiscoveryOptions{{}, {LocationPolicy: &ssdp.LocationPolicy{}}} {
+		results := streamResults(t, opts, responses)
+		var locErr *ssdp.LocationError
+		if !errors.As(results[0].Err, &locErr) || locErr.Reason != ssdp.RejectedHost {
+			t.Errorf("policy %v: got error %v, want location rejected for its host",
+				opts.LocationPolicy, results[0].Err)
+		}
+	}
+	if fetches != 0 {
+		t.Errorf("got %d fetches of rejected location, want 0", fetches)
+	}
+
+	opts := &DiscoveryOptions{LocationPolicy: &ssdp.LocationPolicy{AllowOtherHosts: true}}
+	results := streamResults(t, opts, responses)
+	if results[0].Err != nil || results[0].Root == nil {
+		t.Errorf("got %+v with permissive policy, want the fetched root device", results[0])
+	}
+}
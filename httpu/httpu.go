@@ -6,9 +6,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 )
@@ -48,15 +48,38 @@ type ClientInterfaceCtx interface {
 	) ([]*http.Response, error)
 }
 
+// ClientInterfaceStream is an optional interface of clients, to receive
+// responses as they arrive.
+type ClientInterfaceStream interface {
+	// StreamWithContext performs a request as DoWithContext does, but calls
+	// handler with each response as it is received rather than returning
+	// them. handler is not called concurrently, nor after StreamWithContext
+	// returns.
+	StreamWithContext(
+		req *http.Request,
+		numSends int,
+		handler func(*http.Response),
+	) error
+}
+
 // HTTPUClient is a client for dealing with HTTPU (HTTP over UDP). Its typical
 // function is for HTTPMU, and particularly SSDP.
+//
+// Requests may be made concurrently. They share the client's socket, and
+// responses are passed to each in-flight request with the same ST header,
+// or to all requests with an ST of "ssdp:all" or none. Identical requests
+// to the same destination that overlap in time are only sent once.
 type HTTPUClient struct {
-	connLock sync.Mutex // Protects use of conn.
-	conn     net.PacketConn
+	conn net.PacketConn
+
+	mu       sync.Mutex
+	searches map[string]*search // In-flight requests, by searchKey.
+	reading  bool               // Whether readResponses is running.
 }
 
 var _ ClientInterface = &HTTPUClient{}
 var _ ClientInterfaceCtx = &HTTPUClient{}
+var _ ClientInterfaceStream = &HTTPUClient{}
 
 // NewHTTPUClient creates a new HTTPUClient, opening up a new UDP socket for the
 // purpose.
@@ -69,13 +92,24 @@ func NewHTTPUClient() (*HTTPUClient, error) {
 }
 
 // NewHTTPUClientAddr creates a new HTTPUClient which will broadcast packets
-// from the specified address, opening up a new UDP socket for the purpose
+// from the specified address, opening up a new UDP socket for the purpose. An
+// IPv6 link-local address must include its zone, e.g. "fe80::1%eth0".
+//
+// A client created with a specific address only sends requests to
+// destinations of the same address family, and for IPv6, of the same scope
+// (link-local or not). Requests to other destinations succeed without any
+// responses, so that a request can be sent through a MultiClient of clients
+// for every local address.
 func NewHTTPUClientAddr(addr string) (*HTTPUClient, error) {
-	ip := net.ParseIP(addr)
+	host, zone := addr, ""
+	if i := strings.LastIndexByte(addr, '%'); i >= 0 {
+		host, zone = addr[:i], addr[i+1:]
+	}
+	ip := net.ParseIP(host)
 	if ip == nil {
 		return nil, errors.New("Invalid listening address")
 	}
-	conn, err := net.ListenPacket("udp", ip.String()+":0")
+	conn, err := net.ListenPacket("udp", (&net.UDPAddr{IP: ip, Zone: zone}).String())
 	if err != nil {
 		return nil, err
 	}
@@ -85,15 +119,10 @@ func NewHTTPUClientAddr(addr string) (*HTTPUClient, error) {
 // Close shuts down the client. The client will no longer be useful following
 // this.
 func (httpu *HTTPUClient) Close() error {
-	httpu.connLock.Lock()
-	defer httpu.connLock.Unlock()
 	return httpu.conn.Close()
 }
 
 // Do implements ClientInterface.Do.
-//
-// Note that at present only one concurrent connection will happen per
-// HTTPUClient.
 func (httpu *HTTPUClient) Do(
 	req *http.Request,
 	timeout time.Duration,
@@ -118,8 +147,30 @@ func (httpu *HTTPUClient) DoWithContext(
 	req *http.Request,
 	numSends int,
 ) ([]*http.Response, error) {
-	httpu.connLock.Lock()
-	defer httpu.connLock.Unlock()
+	var responses []*http.Response
+	err := httpu.StreamWithContext(req, numSends, func(response *http.Response) {
+		responses = append(responses, response)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return responses, nil
+}
+
+// StreamWithContext implements ClientInterfaceStream.StreamWithContext.
+func (httpu *HTTPUClient) StreamWithContext(
+	req *http.Request,
+	numSends int,
+	handler func(*http.Response),
+) error {
+	destAddr, err := net.ResolveUDPAddr("udp", req.Host)
+	if err != nil {
+		return err
+	}
+	destAddr, ok := httpu.destination(destAddr)
+	if !ok {
+		return nil
+	}
 
 	// Create the request. This is a subset of what http.Request.Write does
 	// deliberately to avoid creating extra fields which may confuse some
@@ -130,89 +181,127 @@ func (httpu *HTTPUClient) DoWithContext(
 		method = "GET"
 	}
 	if _, err := fmt.Fprintf(&requestBuf, "%s %s HTTP/1.1\r\n", method, req.URL.RequestURI()); err != nil {
-		return nil, err
+		return err
 	}
 	if err := req.Header.Write(&requestBuf); err != nil {
-		return nil, err
+		return err
 	}
 	if _, err := requestBuf.Write([]byte{'\r', '\n'}); err != nil {
-		return nil, err
-	}
-
-	destAddr, err := net.ResolveUDPAddr("udp", req.Host)
-	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// Handle context deadline/timeout
 	ctx := req.Context()
-	deadline, ok := ctx.Deadline()
-	if ok {
-		if err = httpu.conn.SetDeadline(deadline); err != nil {
-			return nil, err
-		}
-	}
+	s, sub, created := httpu.subscribe(destAddr, requestBuf.Bytes(), headerValue(req.Header, "ST"))
+	defer httpu.unsubscribe(s, sub)
 
-	// Handle context cancelation
-	done := make(chan struct{})
-	defer close(done)
-	go func() {
+	if created {
+		s.sendErr = httpu.send(requestBuf.Bytes(), destAddr, numSends)
+		close(s.sent)
+	} else {
+		// Coalesced with an identical request, which sends it.
 		select {
+		case <-s.sent:
 		case <-ctx.Done():
-			// if context is cancelled, stop any connections by setting time in the past.
-			httpu.conn.SetDeadline(time.Now().Add(-time.Second))
-		case <-done:
-		}
-	}()
-
-	// Send request.
-	for i := 0; i < numSends; i++ {
-		if n, err := httpu.conn.WriteTo(requestBuf.Bytes(), destAddr); err != nil {
-			return nil, err
-		} else if n < len(requestBuf.Bytes()) {
-			return nil, fmt.Errorf("httpu: wrote %d bytes rather than full %d in request",
-				n, len(requestBuf.Bytes()))
+			return nil
 		}
-		time.Sleep(5 * time.Millisecond)
+	}
+	if s.sendErr != nil {
+		return s.sendErr
 	}
 
-	// Await responses until timeout.
-	var responses []*http.Response
-	responseBytes := make([]byte, 2048)
+	// Await responses until the context is done.
 	for {
-		// 2048 bytes should be sufficient for most networks.
-		n, _, err := httpu.conn.ReadFrom(responseBytes)
-		if err != nil {
-			if err, ok := err.(net.Error); ok {
-				if err.Timeout() {
-					break
-				}
-				if err.Temporary() {
-					// Sleep in case this is a persistent error to avoid pegging CPU until deadline.
-					time.Sleep(10 * time.Millisecond)
-					continue
-				}
-			}
-			return nil, err
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sub.notify:
 		}
+		packets, err := sub.take()
+		for _, p := range packets {
+			response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(p.data)), req)
+			if err != nil {
+				// Already logged by readResponses.
+				continue
+			}
+
+			// These headers are only ever set by the client.
+			response.Header.Del(LocalAddressHeader)
+			response.Header.Del(RemoteAddressHeader)
+			// Set the related local address used to discover the device.
+			if a, ok := httpu.conn.LocalAddr().(*net.UDPAddr); ok {
+				response.Header.Add(LocalAddressHeader, localAddress(a))
+			}
+			response.Header.Add(RemoteAddressHeader, p.from.String())
 
-		// Parse response.
-		response, err := http.ReadResponse(bufio.NewReader(bytes.NewBuffer(responseBytes[:n])), req)
+			handler(response)
+		}
 		if err != nil {
-			log.Printf("httpu: error while parsing response: %v", err)
-			continue
+			return err
 		}
+	}
+}
 
-		// Set the related local address used to discover the device.
-		if a, ok := httpu.conn.LocalAddr().(*net.UDPAddr); ok {
-			response.Header.Add(LocalAddressHeader, a.IP.String())
+// send sends the request numSends times.
+func (httpu *HTTPUClient) send(request []byte, destAddr *net.UDPAddr, numSends int) error {
+	for i := 0; i < numSends; i++ {
+		if n, err := httpu.conn.WriteTo(request, destAddr); err != nil {
+			return err
+		} else if n < len(request) {
+			return fmt.Errorf("httpu: wrote %d bytes rather than full %d in request",
+				n, len(request))
 		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return nil
+}
 
-		responses = append(responses, response)
+// destination returns the address to send a request for dest to, and false
+// if the client does not send to dest. See NewHTTPUClientAddr. Link-local
+// IPv6 destinations without a zone are sent in the zone of the client's
+// address. Clients not bound to a specific address have no zone to send IPv6
+// multicast in, and leave that to clients bound to each IPv6 address.
+func (httpu *HTTPUClient) destination(dest *net.UDPAddr) (*net.UDPAddr, bool) {
+	local, ok := httpu.conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return dest, true
+	}
+	destIs4 := dest.IP.To4() != nil
+	switch {
+	case local.IP.IsUnspecified():
+		return dest, destIs4 || dest.Zone != "" || !dest.IP.IsMulticast()
+	case local.IP.To4() != nil:
+		return dest, destIs4
+	case destIs4:
+		return dest, false
 	}
+	localIsLinkLocal := local.IP.IsLinkLocalUnicast()
+	destIsLinkLocal := dest.IP.IsLinkLocalUnicast() || dest.IP.IsLinkLocalMulticast()
+	if localIsLinkLocal != destIsLinkLocal {
+		return dest, false
+	}
+	if !destIsLinkLocal {
+		return dest, true
+	}
+	if dest.Zone == "" {
+		return &net.UDPAddr{IP: dest.IP, Port: dest.Port, Zone: local.Zone}, true
+	}
+	return dest, dest.Zone == local.Zone
+}
 
-	// Timeout reached - return discovered responses.
-	return responses, nil
+// localAddress formats the IP address of a, including its zone if any.
+func localAddress(a *net.UDPAddr) string {
+	if a.Zone != "" {
+		return a.IP.String() + "%" + a.Zone
+	}
+	return a.IP.String()
 }
 
+// LocalAddressHeader is added to each response, with the local IP address
+// that the response was received on, and to requests received by a Server on
+// specific interfaces (see InterfaceHeader). IPv6 link-local addresses include
+// their zone, e.g. "fe80::1%eth0".
 const LocalAddressHeader = "goupnp-local-address"
+
+// RemoteAddressHeader is added to each response, with the address that the
+// response was received from, e.g. "192.168.1.1:1900".
+const RemoteAddressHeader = "goupnp-remote-address"
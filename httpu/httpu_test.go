@@ -0,0 +1,119 @@
+package httpu
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResponder responds to each request that it receives with a response
+// with the request's ST, and counts the requests for each ST.
+type fakeResponder struct {
+	conn net.PacketConn
+
+	lock     sync.Mutex
+	requests map[string]int
+}
+
+func newFakeResponder(t *testing.T) *fakeResponder {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeResponder{conn: conn, requests: make(map[string]int)}
+	go r.serve()
+	return r
+}
+
+func (r *fakeResponder) serve() {
+	buf := make([]byte, 2048)
+	for {
+		n, from, err := r.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(buf[:n])))
+		if err != nil {
+			continue
+		}
+		st := req.Header.Get("ST")
+		r.lock.Lock()
+		r.requests[st]++
+		r.lock.Unlock()
+		response := fmt.Sprintf("HTTP/1.1 200 OK\r\nST: %s\r\n\r\n", st)
+		r.conn.WriteTo([]byte(response), from)
+	}
+}
+
+func (r *fakeResponder) numRequests(st string) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.requests[st]
+}
+
+func TestHTTPUClientConcurrentRequests(t *testing.T) {
+	responder := newFakeResponder(t)
+	defer responder.conn.Close()
+	client, err := NewHTTPUClientAddr("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	const window = 300 * time.Millisecond
+	search := func(st string) ([]*http.Response, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), window)
+		defer cancel()
+		req := &http.Request{
+			Method: "M-SEARCH",
+			Host:   responder.conn.LocalAddr().String(),
+			URL:    &url.URL{Opaque: "*"},
+			Header: http.Header{"ST": []string{st}},
+		}
+		return client.DoWithContext(req.WithContext(ctx), 1)
+	}
+
+	sts := []string{"urn:a", "urn:b", "urn:a", "urn:a"}
+	results := make([][]*http.Response, len(sts))
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i, st := range sts {
+		wg.Add(1)
+		go func(i int, st string) {
+			defer wg.Done()
+			var err error
+			if results[i], err = search(st); err != nil {
+				t.Errorf("search %d for %s: %v", i, st, err)
+			}
+		}(i, st)
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed > 2*window {
+		t.Errorf("searches took %v, want them to run concurrently", elapsed)
+	}
+
+	for i, st := range sts {
+		if len(results[i]) != 1 {
+			t.Errorf("search %d for %s: got %d responses, want 1", i, st, len(results[i]))
+			continue
+		}
+		if got := results[i][0].Header.Get("ST"); got != st {
+			t.Errorf("search %d for %s: got response for %s", i, st, got)
+		}
+	}
+	if got := responder.numRequests("urn:a"); got != 1 {
+		t.Errorf("got %d requests for urn:a, want the overlapping searches sent once", got)
+	}
+
+	// The reader stops when there are no searches, and starts again.
+	if responses, err := search("urn:b"); err != nil || len(responses) != 1 {
+		t.Errorf("search after others finished: got %d responses, %v, want 1", len(responses), err)
+	}
+}
@@ -0,0 +1,305 @@
+package httpu
+
+import (
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultInterfacePollInterval is the default interval at which a Server with
+// AllInterfaces set checks for interfaces coming and going.
+const DefaultInterfacePollInterval = 30 * time.Second
+
+// InterfaceHeader is set on requests received by a Server that listens on
+// specific interfaces, to the name of the interface that the request was
+// received on. LocalAddressHeader is also set, to the local address on that
+// interface that the request was sent to, or from the same network as the
+// sender if it was multicast.
+const InterfaceHeader = "goupnp-interface"
+
+// listenAndServeInterfaces listens for multicast to addr on srv.Interfaces,
+// or all interfaces if srv.AllInterfaces is set, with a listener for each
+// interface.
+func (srv *Server) listenAndServeInterfaces(addr *net.UDPAddr) error {
+	table := newInterfaceTable(nil)
+	conns := make(map[int]net.PacketConn)
+	// Interfaces that could not be listened on, to avoid repeatedly logging.
+	failed := make(map[int]bool)
+	done := srv.doneChan()
+	type exit struct {
+		index int
+		conn  net.PacketConn
+		err   error
+	}
+	exited := make(chan exit)
+
+	var poll <-chan time.Time
+	if srv.AllInterfaces {
+		interval := srv.InterfacePollInterval
+		if interval <= 0 {
+			interval = DefaultInterfacePollInterval
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		ifaces, err := srv.multicastInterfaces(addr)
+		if err != nil {
+			if len(conns) == 0 {
+				return err
+			}
+			log.Printf("httpu: failed to list interfaces: %v", err)
+		} else {
+			table.set(ifaces)
+			wanted := make(map[int]bool)
+			var lastErr error
+			for i := range ifaces {
+				iface := &ifaces[i]
+				wanted[iface.Index] = true
+				if conns[iface.Index] != nil {
+					continue
+				}
+				conn, err := net.ListenMulticastUDP("udp", iface, addr)
+				if err != nil {
+					if !failed[iface.Index] {
+						log.Printf("httpu: failed to listen on interface %s: %v", iface.Name, err)
+					}
+					failed[iface.Index] = true
+					lastErr = err
+					continue
+				}
+				delete(failed, iface.Index)
+				if !srv.trackConn(conn, true) {
+					conn.Close()
+					return ErrServerClosed
+				}
+				conns[iface.Index] = conn
+				go func(iface *net.Interface, conn net.PacketConn) {
+					err := srv.serve(conn, iface, table)
+					select {
+					case exited <- exit{iface.Index, conn, err}:
+					case <-done:
+					}
+				}(iface, conn)
+			}
+			for index, conn := range conns {
+				if !wanted[index] {
+					srv.trackConn(conn, false)
+					delete(conns, index)
+				}
+			}
+			if len(conns) == 0 && lastErr != nil && poll == nil {
+				return lastErr
+			}
+		}
+
+	wait:
+		for {
+			select {
+			case <-poll:
+				break wait
+			case e := <-exited:
+				// The listener failed, e.g. because its interface went down.
+				// It is listened on again when next found to be up.
+				if conns[e.index] == e.conn {
+					delete(conns, e.index)
+				}
+				if len(conns) == 0 && poll == nil {
+					return e.err
+				}
+			case <-done:
+				return ErrServerClosed
+			}
+		}
+	}
+}
+
+// multicastInterfaces returns the interfaces to listen on for multicast to
+// addr. With AllInterfaces, these are the interfaces that are up, support
+// multicast and have an address of the same family as addr.
+func (srv *Server) multicastInterfaces(addr *net.UDPAddr) ([]net.Interface, error) {
+	if !srv.AllInterfaces {
+		return srv.Interfaces, nil
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var result []net.Interface
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagMulticast != 0 &&
+			hasAddrOfFamily(&iface, addr.IP.To4() != nil) {
+			result = append(result, iface)
+		}
+	}
+	return result, nil
+}
+
+// claimWindow is how long a message from a sender that is not on the
+// network of any interface is attributed to the listener that first received
+// it.
+const claimWindow = time.Second
+
+// interfaceTable has the addresses of the interfaces that a Server listens
+// on, to find which interface a message was received on.
+type interfaceTable struct {
+	mu     sync.RWMutex
+	ifaces []interfaceAddrs
+
+	claimMu   sync.Mutex
+	claims    map[string]messageClaim
+	lastPrune time.Time
+}
+
+// messageClaim records the listener that first received a message.
+type messageClaim struct {
+	index int // Interface index of the listener.
+	at    time.Time
+}
+
+type interfaceAddrs struct {
+	iface net.Interface
+	nets  []*net.IPNet
+}
+
+func newInterfaceTable(ifaces []net.Interface) *interfaceTable {
+	table := &interfaceTable{}
+	table.set(ifaces)
+	return table
+}
+
+// set replaces the interfaces in the table.
+func (table *interfaceTable) set(ifaces []net.Interface) {
+	entries := make([]interfaceAddrs, 0, len(ifaces))
+	for _, iface := range ifaces {
+		entry := interfaceAddrs{iface: iface}
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, addr := range addrs {
+				if ipNet, ok := addr.(*net.IPNet); ok {
+					entry.nets = append(entry.nets, ipNet)
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+	table.mu.Lock()
+	table.ifaces = entries
+	table.mu.Unlock()
+}
+
+// localAddr returns the local address on iface that a message from peer was
+// received on, or "" if unknown. It returns false if the message was received
+// on another of the interfaces in the table instead, which happens as some
+// operating systems deliver multicast to every listener of the group,
+// regardless of the interface that the listener joined it on. If peer is not
+// on the network of any of the interfaces, the message data is attributed to
+// the first listener to receive it.
+func (table *interfaceTable) localAddr(iface *net.Interface, peer net.Addr, data []byte) (string, bool) {
+	udpAddr, ok := peer.(*net.UDPAddr)
+	if !ok {
+		return "", true
+	}
+	table.mu.RLock()
+	defer table.mu.RUnlock()
+
+	// The first interface in the table that the sender is on received it.
+	var own, owner *interfaceAddrs
+	for i := range table.ifaces {
+		entry := &table.ifaces[i]
+		if entry.iface.Index == iface.Index {
+			own = entry
+		}
+		if owner != nil {
+			continue
+		}
+		if udpAddr.Zone != "" && isZoneOf(udpAddr.Zone, &entry.iface) ||
+			udpAddr.Zone == "" && containsIP(entry.nets, udpAddr.IP) {
+			owner = entry
+		}
+	}
+	if owner != nil && owner != own {
+		return "", false
+	}
+	if own == nil {
+		return "", true
+	}
+	if owner == nil && !table.claim(iface.Index, peer.String()+"\x00"+string(data)) {
+		return "", false
+	}
+
+	for _, ipNet := range own.nets {
+		if udpAddr.Zone != "" {
+			if ipNet.IP.IsLinkLocalUnicast() && ipNet.IP.To4() == nil {
+				return ipNet.IP.String() + "%" + own.iface.Name, true
+			}
+		} else if ipNet.Contains(udpAddr.IP) {
+			return ipNet.IP.String(), true
+		}
+	}
+	// The sender is not on the interface's networks, so use any local address
+	// of the same family.
+	for _, ipNet := range own.nets {
+		if (ipNet.IP.To4() != nil) == (udpAddr.IP.To4() != nil) && !ipNet.IP.IsLinkLocalUnicast() {
+			return ipNet.IP.String(), true
+		}
+	}
+	return "", true
+}
+
+// claim reports whether the listener on the interface with the index is the
+// first to receive the message with the key within claimWindow. Repeats of
+// the message to the same listener, such as retransmissions, are also
+// claimed by it.
+func (table *interfaceTable) claim(index int, key string) bool {
+	table.claimMu.Lock()
+	defer table.claimMu.Unlock()
+	now := time.Now()
+	if now.Sub(table.lastPrune) > claimWindow {
+		for k, c := range table.claims {
+			if now.Sub(c.at) > claimWindow {
+				delete(table.claims, k)
+			}
+		}
+		table.lastPrune = now
+	}
+	if c, ok := table.claims[key]; ok && c.index != index && now.Sub(c.at) <= claimWindow {
+		return false
+	}
+	if table.claims == nil {
+		table.claims = make(map[string]messageClaim)
+	}
+	table.claims[key] = messageClaim{index: index, at: now}
+	return true
+}
+
+// hasAddrOfFamily reports whether the interface has an IPv4 address if ipv4 is
+// true, or an IPv6 address otherwise.
+func hasAddrOfFamily(iface *net.Interface, ipv4 bool) bool {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && (ipNet.IP.To4() != nil) == ipv4 {
+			return true
+		}
+	}
+	return false
+}
+
+func isZoneOf(zone string, iface *net.Interface) bool {
+	return zone == iface.Name || zone == strconv.Itoa(iface.Index)
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package httpu
+
+import (
+	"net"
+	"testing"
+)
+
+func TestInterfaceTableLocalAddr(t *testing.T) {
+	mustCIDR := func(s string) *net.IPNet {
+		ip, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ipNet.IP = ip
+		return ipNet
+	}
+	eth0 := net.Interface{Index: 2, Name: "eth0"}
+	eth1 := net.Interface{Index: 3, Name: "eth1"}
+	table := &interfaceTable{ifaces: []interfaceAddrs{
+		{iface: eth0, nets: []*net.IPNet{mustCIDR("192.168.1.2/24"), mustCIDR("fe80::2/64")}},
+		{iface: eth1, nets: []*net.IPNet{mustCIDR("10.0.0.2/8"), mustCIDR("fe80::3/64")}},
+	}}
+
+	tests := []struct {
+		name  string
+		iface net.Interface
+		peer  *net.UDPAddr
+		want  string
+		ok    bool
+	}{
+		{"IPv4 on own subnet", eth0, &net.UDPAddr{IP: net.ParseIP("192.168.1.1")}, "192.168.1.2", true},
+		{"IPv4 on other interface", eth1, &net.UDPAddr{IP: net.ParseIP("192.168.1.1")}, "", false},
+		{"IPv4 off subnet", eth1, &net.UDPAddr{IP: net.ParseIP("172.16.0.1")}, "10.0.0.2", true},
+		{"IPv6 link-local by zone", eth1, &net.UDPAddr{IP: net.ParseIP("fe80::1"), Zone: "eth1"}, "fe80::3%eth1", true},
+		{"IPv6 zone of other interface", eth0, &net.UDPAddr{IP: net.ParseIP("fe80::1"), Zone: "3"}, "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := table.localAddr(&test.iface, test.peer, []byte(test.name))
+			if got != test.want || ok != test.ok {
+				t.Errorf("got (%q, %t), want (%q, %t)", got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
+
+func TestInterfaceTableClaimsOffNetworkMessages(t *testing.T) {
+	eth0 := net.Interface{Index: 2, Name: "eth0"}
+	eth1 := net.Interface{Index: 3, Name: "eth1"}
+	_, net0, _ := net.ParseCIDR("192.168.1.0/24")
+	_, net1, _ := net.ParseCIDR("10.0.0.0/8")
+	table := &interfaceTable{ifaces: []interfaceAddrs{
+		{iface: eth0, nets: []*net.IPNet{net0}},
+		{iface: eth1, nets: []*net.IPNet{net1}},
+	}}
+	peer := &net.UDPAddr{IP: net.ParseIP("172.16.0.1"), Port: 1900}
+	msg := []byte("NOTIFY * HTTP/1.1\r\n\r\n")
+
+	steps := []struct {
+		name  string
+		iface net.Interface
+		data  []byte
+		ok    bool
+	}{
+		{"first listener", eth1, msg, true},
+		{"other listener", eth0, msg, false},
+		{"first listener again", eth1, msg, true},
+		{"other message", eth0, []byte("M-SEARCH * HTTP/1.1\r\n\r\n"), true},
+	}
+	for _, step := range steps {
+		if _, ok := table.localAddr(&step.iface, peer, step.data); ok != step.ok {
+			t.Errorf("%s: got %t, want %t", step.name, ok, step.ok)
+		}
+	}
+}
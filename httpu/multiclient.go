@@ -2,6 +2,7 @@ package httpu
 
 import (
 	"net/http"
+	"sync"
 	"time"
 
 	"golang.org/x/sync/errgroup"
@@ -76,6 +77,7 @@ type MultiClientCtx struct {
 }
 
 var _ ClientInterfaceCtx = &MultiClientCtx{}
+var _ ClientInterfaceStream = &MultiClientCtx{}
 
 // NewMultiClient creates a new MultiClient that delegates to all the given
 // clients.
@@ -130,3 +132,40 @@ func (mc *MultiClientCtx) sendRequestsCtx(
 	}
 	return tasks.Wait()
 }
+
+// StreamWithContext implements ClientInterfaceStream.StreamWithContext.
+// Delegates that do not implement ClientInterfaceStream pass on their
+// responses once their DoWithContext returns.
+func (mc *MultiClientCtx) StreamWithContext(
+	req *http.Request,
+	numSends int,
+	handler func(*http.Response),
+) error {
+	tasks, ctx := errgroup.WithContext(req.Context())
+	req = req.WithContext(ctx) // so we cancel if the errgroup errors
+
+	var handlerLock sync.Mutex
+	handle := func(response *http.Response) {
+		handlerLock.Lock()
+		defer handlerLock.Unlock()
+		handler(response)
+	}
+
+	for _, d := range mc.delegates {
+		d := d // copy for closure
+		tasks.Go(func() error {
+			if ds, ok := d.(ClientInterfaceStream); ok {
+				return ds.StreamWithContext(req, numSends, handle)
+			}
+			responses, err := d.DoWithContext(req, numSends)
+			if err != nil {
+				return err
+			}
+			for _, response := range responses {
+				handle(response)
+			}
+			return nil
+		})
+	}
+	return tasks.Wait()
+}
@@ -0,0 +1,224 @@
+package httpu
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/huin/goupnp/urn"
+)
+
+// search is an in-flight request made by one or more concurrent calls to
+// HTTPUClient.StreamWithContext.
+type search struct {
+	key  string
+	st   string
+	dest *net.UDPAddr
+
+	// sent is closed once the request has been sent, with any error in
+	// sendErr.
+	sent    chan struct{}
+	sendErr error
+
+	// The following are protected by the client's mu.
+
+	// Responses received so far, for subscribers that join later.
+	packets []packet
+	subs    map[*subscriber]struct{}
+}
+
+// packet is a received response.
+type packet struct {
+	data []byte
+	from net.Addr
+}
+
+// matches reports whether a response with the ST header st from the address
+// is for the search, including responses with later versions of a searched
+// for type. Responses to unicast requests must come from the host that the
+// request was sent to.
+func (s *search) matches(st string, from net.Addr) bool {
+	if s.st != "" && s.st != "ssdp:all" && !urn.Match(st, s.st) {
+		return false
+	}
+	if s.dest.IP.IsMulticast() {
+		return true
+	}
+	fromUDP, ok := from.(*net.UDPAddr)
+	return ok && fromUDP.IP.Equal(s.dest.IP)
+}
+
+// subscriber queues the responses for a call to StreamWithContext, so that
+// a slow handler does not hold up the responses to other calls.
+type subscriber struct {
+	notify chan struct{} // Signalled when packets or err are added.
+
+	mu      sync.Mutex
+	packets []packet
+	err     error
+}
+
+func newSubscriber() *subscriber {
+	return &subscriber{notify: make(chan struct{}, 1)}
+}
+
+func (sub *subscriber) push(packets ...packet) {
+	sub.mu.Lock()
+	sub.packets = append(sub.packets, packets...)
+	sub.mu.Unlock()
+	sub.signal()
+}
+
+func (sub *subscriber) fail(err error) {
+	sub.mu.Lock()
+	sub.err = err
+	sub.mu.Unlock()
+	sub.signal()
+}
+
+func (sub *subscriber) signal() {
+	select {
+	case sub.notify <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the queued packets, and the error that ended the responses,
+// if any.
+func (sub *subscriber) take() ([]packet, error) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	packets := sub.packets
+	sub.packets = nil
+	return packets, sub.err
+}
+
+// subscribe returns the in-flight search for the request to dest, with a new
+// subscriber to it. If there is no such search, one is created, and created
+// is true - the caller must then send the request and close s.sent.
+func (httpu *HTTPUClient) subscribe(dest *net.UDPAddr, request []byte, st string) (s *search, sub *subscriber, created bool) {
+	key := dest.String() + "\x00" + string(request)
+	sub = newSubscriber()
+
+	httpu.mu.Lock()
+	defer httpu.mu.Unlock()
+	if s = httpu.searches[key]; s == nil {
+		s = &search{
+			key:  key,
+			st:   st,
+			dest: dest,
+			sent: make(chan struct{}),
+			subs: make(map[*subscriber]struct{}),
+		}
+		if httpu.searches == nil {
+			httpu.searches = make(map[string]*search)
+		}
+		httpu.searches[key] = s
+		created = true
+	} else if len(s.packets) > 0 {
+		sub.push(s.packets...)
+	}
+	s.subs[sub] = struct{}{}
+
+	if !httpu.reading {
+		httpu.reading = true
+		// Clear any deadline set to stop a previous reader.
+		httpu.conn.SetReadDeadline(time.Time{})
+		go httpu.readResponses()
+	}
+	return s, sub, created
+}
+
+// unsubscribe removes sub from s, ending the search if it was the last
+// subscriber, and stopping the reader if it was the last search.
+func (httpu *HTTPUClient) unsubscribe(s *search, sub *subscriber) {
+	httpu.mu.Lock()
+	defer httpu.mu.Unlock()
+	delete(s.subs, sub)
+	if len(s.subs) > 0 {
+		return
+	}
+	delete(httpu.searches, s.key)
+	if len(httpu.searches) == 0 && httpu.reading {
+		// Wake the reader, which stops if there are still no searches.
+		httpu.conn.SetReadDeadline(time.Now().Add(-time.Second))
+	}
+}
+
+// readResponses reads responses from the client's socket and passes them to
+// the subscribers of the searches that they match, until there are no
+// searches or reading fails.
+func (httpu *HTTPUClient) readResponses() {
+	// 2048 bytes should be sufficient for most networks.
+	buf := make([]byte, 2048)
+	for {
+		n, from, err := httpu.conn.ReadFrom(buf)
+		if err != nil {
+			if err, ok := err.(net.Error); ok {
+				if err.Timeout() {
+					httpu.mu.Lock()
+					if len(httpu.searches) == 0 {
+						httpu.reading = false
+						httpu.mu.Unlock()
+						return
+					}
+					httpu.conn.SetReadDeadline(time.Time{})
+					httpu.mu.Unlock()
+					continue
+				}
+				if err.Temporary() {
+					// Sleep in case this is a persistent error to avoid pegging CPU.
+					time.Sleep(10 * time.Millisecond)
+					continue
+				}
+			}
+			httpu.mu.Lock()
+			httpu.reading = false
+			for _, s := range httpu.searches {
+				for sub := range s.subs {
+					sub.fail(err)
+				}
+			}
+			httpu.mu.Unlock()
+			return
+		}
+
+		data := make([]byte, n)
+		copy(data, buf[:n])
+		response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil)
+		if err != nil {
+			log.Printf("httpu: error while parsing response: %v", err)
+			continue
+		}
+		st := response.Header.Get("ST")
+
+		httpu.mu.Lock()
+		for _, s := range httpu.searches {
+			if !s.matches(st, from) {
+				continue
+			}
+			p := packet{data: data, from: from}
+			s.packets = append(s.packets, p)
+			for sub := range s.subs {
+				sub.push(p)
+			}
+		}
+		httpu.mu.Unlock()
+	}
+}
+
+// headerValue returns the value of the header key, which may be set in h
+// with its canonical key, or as given, as SSDP requests often are.
+func headerValue(h http.Header, key string) string {
+	if v := h.Get(key); v != "" {
+		return v
+	}
+	if vs := h[key]; len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
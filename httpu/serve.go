@@ -3,17 +3,27 @@ package httpu
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"log"
 	"net"
 	"net/http"
 	"regexp"
 	"sync"
+	"time"
 )
 
 const (
 	DefaultMaxMessageBytes = 2048
+	// DefaultMaxConcurrentHandlers is the default limit on the number of
+	// messages that a Server handles at once.
+	DefaultMaxConcurrentHandlers = 64
 )
 
+// ErrServerClosed is returned by the Server's Serve and ListenAndServe
+// methods after a call to Shutdown or Close.
+var ErrServerClosed = errors.New("httpu: Server closed")
+
 var (
 	trailingWhitespaceRx = regexp.MustCompile(" +\r\n")
 	crlf                 = []byte("\r\n")
@@ -41,17 +51,44 @@ type Server struct {
 	Interface       *net.Interface // Network interface to listen on for multicast, nil for default multicast interface
 	Handler         Handler        // handler to invoke
 	MaxMessageBytes int            // maximum number of bytes to read from a packet, DefaultMaxMessageBytes if 0
+	// MaxConcurrentHandlers limits the number of messages handled at once,
+	// DefaultMaxConcurrentHandlers if 0. Reading further messages waits until
+	// a handler returns.
+	MaxConcurrentHandlers int
+
+	// Interfaces, if not empty, are the network interfaces to listen on for
+	// multicast, instead of Interface.
+	Interfaces []net.Interface
+	// AllInterfaces listens for multicast on all multicast-capable network
+	// interfaces that are up, instead of Interface or Interfaces. Interfaces
+	// coming and going are found by checking every InterfacePollInterval
+	// (DefaultInterfacePollInterval if 0).
+	AllInterfaces         bool
+	InterfacePollInterval time.Duration
+
+	mu           sync.Mutex
+	conns        map[net.PacketConn]struct{}
+	inShutdown   bool
+	done         chan struct{} // closed on Shutdown or Close
+	handlers     sync.WaitGroup
+	handlerSlots chan struct{}
+	bufPool      *sync.Pool
 }
 
 // ListenAndServe listens on the UDP network address srv.Addr. If srv.Multicast
 // is true, then a multicast UDP listener will be used on srv.Interface (or
-// default interface if nil).
+// default interface if nil), or on each of srv.Interfaces or all interfaces
+// if srv.AllInterfaces is set.
 func (srv *Server) ListenAndServe() error {
 	var err error
 
 	var addr *net.UDPAddr
 	if addr, err = net.ResolveUDPAddr("udp", srv.Addr); err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	if srv.Multicast && (len(srv.Interfaces) > 0 || srv.AllInterfaces) {
+		return srv.listenAndServeInterfaces(addr)
 	}
 
 	var conn net.PacketConn
@@ -69,25 +106,67 @@ func (srv *Server) ListenAndServe() error {
 }
 
 // Serve messages received on the given packet listener to the srv.Handler.
+// Serve closes l when it returns, and returns ErrServerClosed after a call to
+// Shutdown or Close. If srv.Interface is set, l is assumed to receive messages
+// on it, and requests are given InterfaceHeader and LocalAddressHeader.
 func (srv *Server) Serve(l net.PacketConn) error {
-	maxMessageBytes := DefaultMaxMessageBytes
-	if srv.MaxMessageBytes != 0 {
-		maxMessageBytes = srv.MaxMessageBytes
+	if srv.Interface == nil {
+		return srv.serve(l, nil, nil)
 	}
+	return srv.serve(l, srv.Interface, newInterfaceTable([]net.Interface{*srv.Interface}))
+}
 
-	bufPool := &sync.Pool{
-		New: func() interface{} {
-			return make([]byte, maxMessageBytes)
-		},
+// serve serves messages received on l. If iface is not nil, l receives
+// messages on it, and table has the addresses of the interfaces that the
+// server listens on.
+func (srv *Server) serve(l net.PacketConn, iface *net.Interface, table *interfaceTable) error {
+	if !srv.trackConn(l, true) {
+		l.Close()
+		return ErrServerClosed
 	}
+	defer srv.trackConn(l, false)
+
+	handlerSlots, bufPool := srv.handlerResources()
 	for {
 		buf := bufPool.Get().([]byte)
 		n, peerAddr, err := l.ReadFrom(buf)
 		if err != nil {
+			if srv.shuttingDown() {
+				return ErrServerClosed
+			}
 			return err
 		}
+		var localAddr string
+		if iface != nil {
+			var ok bool
+			if localAddr, ok = table.localAddr(iface, peerAddr, buf[:n]); !ok {
+				// Served by the listener on another interface.
+				bufPool.Put(buf)
+				continue
+			}
+		}
+		select {
+		case handlerSlots <- struct{}{}:
+		case <-srv.doneChan():
+			bufPool.Put(buf)
+			return ErrServerClosed
+		}
+		// Adding to handlers must not race with Shutdown waiting for them.
+		srv.mu.Lock()
+		if srv.inShutdown {
+			srv.mu.Unlock()
+			<-handlerSlots
+			bufPool.Put(buf)
+			return ErrServerClosed
+		}
+		srv.handlers.Add(1)
+		srv.mu.Unlock()
 		go func() {
-			defer bufPool.Put(buf)
+			defer func() {
+				bufPool.Put(buf)
+				<-handlerSlots
+				srv.handlers.Done()
+			}()
 			// At least one router's UPnP implementation has added a trailing space
 			// after "HTTP/1.1" - trim it.
 			reqBuf := trailingWhitespaceRx.ReplaceAllLiteral(buf[:n], crlf)
@@ -98,12 +177,128 @@ func (srv *Server) Serve(l net.PacketConn) error {
 				return
 			}
 			req.RemoteAddr = peerAddr.String()
+			// These headers are only ever set by the server.
+			req.Header.Del(InterfaceHeader)
+			req.Header.Del(LocalAddressHeader)
+			if iface != nil {
+				req.Header.Set(InterfaceHeader, iface.Name)
+				if localAddr != "" {
+					req.Header.Set(LocalAddressHeader, localAddr)
+				}
+			}
 			srv.Handler.ServeMessage(req)
 			// No need to call req.Body.Close - underlying reader is bytes.Buffer.
 		}()
 	}
 }
 
+// handlerResources returns the handler slots and message buffers shared by
+// all of the server's listeners.
+func (srv *Server) handlerResources() (chan struct{}, *sync.Pool) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.handlerSlots == nil {
+		maxHandlers := DefaultMaxConcurrentHandlers
+		if srv.MaxConcurrentHandlers > 0 {
+			maxHandlers = srv.MaxConcurrentHandlers
+		}
+		srv.handlerSlots = make(chan struct{}, maxHandlers)
+		maxMessageBytes := DefaultMaxMessageBytes
+		if srv.MaxMessageBytes != 0 {
+			maxMessageBytes = srv.MaxMessageBytes
+		}
+		srv.bufPool = &sync.Pool{
+			New: func() interface{} {
+				return make([]byte, maxMessageBytes)
+			},
+		}
+	}
+	return srv.handlerSlots, srv.bufPool
+}
+
+// Shutdown stops the server from receiving messages, by closing its
+// listeners, and then waits for in-flight handlers to return or for the
+// context to be done, returning the context's error in the latter case.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	srv.closeConns()
+	done := make(chan struct{})
+	go func() {
+		srv.handlers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops the server from receiving messages, by closing its listeners.
+// Unlike Shutdown, it does not wait for in-flight handlers.
+func (srv *Server) Close() error {
+	return srv.closeConns()
+}
+
+func (srv *Server) closeConns() error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if !srv.inShutdown {
+		srv.inShutdown = true
+		close(srv.doneChanLocked())
+	}
+	var err error
+	for conn := range srv.conns {
+		if closeErr := conn.Close(); err == nil {
+			err = closeErr
+		}
+		delete(srv.conns, conn)
+	}
+	return err
+}
+
+func (srv *Server) doneChan() <-chan struct{} {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.doneChanLocked()
+}
+
+func (srv *Server) doneChanLocked() chan struct{} {
+	if srv.done == nil {
+		srv.done = make(chan struct{})
+	}
+	return srv.done
+}
+
+func (srv *Server) shuttingDown() bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.inShutdown
+}
+
+// trackConn adds or removes a listener to close on Shutdown or Close. It
+// returns false if a listener cannot be added, because the server is shutting
+// down. Removing a listener closes it.
+func (srv *Server) trackConn(conn net.PacketConn, add bool) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if add {
+		if srv.inShutdown {
+			return false
+		}
+		if srv.conns == nil {
+			srv.conns = make(map[net.PacketConn]struct{})
+		}
+		srv.conns[conn] = struct{}{}
+		return true
+	}
+	if _, ok := srv.conns[conn]; ok {
+		delete(srv.conns, conn)
+		conn.Close()
+	}
+	return true
+}
+
 // Serve messages received on the given packet listener to the given handler.
 func Serve(l net.PacketConn, handler Handler) error {
 	srv := Server{
@@ -0,0 +1,121 @@
+package httpu
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServerShutdown(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	srv := &Server{
+		MaxConcurrentHandlers: 1,
+		Handler: HandlerFunc(func(r *http.Request) {
+			started <- struct{}{}
+			<-release
+		}),
+	}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(conn) }()
+
+	client, err := net.Dial("udp4", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := client.Write([]byte("NOTIFY * HTTP/1.1\r\nHOST: 127.0.0.1\r\n\r\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-started
+	select {
+	case <-started:
+		t.Fatal("second handler started while first was running, want MaxConcurrentHandlers=1")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown with running handler: got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if err := <-served; err != ErrServerClosed {
+		t.Errorf("Serve: got %v, want %v", err, ErrServerClosed)
+	}
+
+	close(release)
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown after handlers returned: got %v, want success", err)
+	}
+	if err := srv.Serve(conn); err != ErrServerClosed {
+		t.Errorf("Serve after Shutdown: got %v, want %v", err, ErrServerClosed)
+	}
+}
+
+func TestServerShutdownWhileReceiving(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var running, started int32
+		srv := &Server{
+			Handler: HandlerFunc(func(r *http.Request) {
+				atomic.AddInt32(&started, 1)
+				atomic.AddInt32(&running, 1)
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&running, -1)
+			}),
+		}
+		served := make(chan error, 1)
+		go func() { served <- srv.Serve(conn) }()
+
+		client, err := net.Dial("udp4", conn.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		stop := make(chan struct{})
+		sent := make(chan struct{})
+		go func() {
+			defer close(sent)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				client.Write([]byte("NOTIFY * HTTP/1.1\r\nHOST: 127.0.0.1\r\n\r\n"))
+			}
+		}()
+		for atomic.LoadInt32(&started) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		if err := srv.Shutdown(context.Background()); err != nil {
+			t.Fatalf("Shutdown: got %v, want success", err)
+		}
+		if n := atomic.LoadInt32(&running); n != 0 {
+			t.Errorf("got %d handlers running after Shutdown returned, want 0", n)
+		}
+		startedAtShutdown := atomic.LoadInt32(&started)
+		time.Sleep(5 * time.Millisecond)
+		if n := atomic.LoadInt32(&started); n != startedAtShutdown {
+			t.Errorf("got %d handlers started after Shutdown returned, want 0", n-startedAtShutdown)
+		}
+		close(stop)
+		<-sent
+		client.Close()
+		if err := <-served; err != ErrServerClosed {
+			t.Errorf("Serve: got %v, want %v", err, ErrServerClosed)
+		}
+	}
+}
@@ -8,16 +8,21 @@ import (
 )
 
 // httpuClient creates a HTTPU client that multiplexes to all multicast-capable
-// IPv4 addresses on the host. Returns a function to clean up once the client is
-// no longer required.
-func httpuClient() (httpu.ClientInterfaceCtx, func(), error) {
-	addrs, err := localIPv4MCastAddrs()
+// IPv4 addresses on the host, and an IPv6 link-local and other address per
+// multicast-capable interface. Returns a function to clean up once the client
+// is no longer required. Only addresses that filter accepts are used.
+func httpuClient(filter addrFilter) (httpu.ClientInterfaceCtx, func(), error) {
+	addrs, err := localIPv4MCastAddrs(filter)
 	if err != nil {
 		return nil, nil, ctxError(err, "requesting host IPv4 addresses")
 	}
+	addrs6, err := localIPv6MCastAddrs(filter)
+	if err != nil {
+		return nil, nil, ctxError(err, "requesting host IPv6 addresses")
+	}
 
-	closers := make([]io.Closer, 0, len(addrs))
-	delegates := make([]httpu.ClientInterfaceCtx, 0, len(addrs))
+	closers := make([]io.Closer, 0, len(addrs)+len(addrs6))
+	delegates := make([]httpu.ClientInterfaceCtx, 0, len(addrs)+len(addrs6))
 	for _, addr := range addrs {
 		c, err := httpu.NewHTTPUClientAddr(addr)
 		if err != nil {
@@ -27,6 +32,16 @@ func httpuClient() (httpu.ClientInterfaceCtx, func(), error) {
 		closers = append(closers, c)
 		delegates = append(delegates, c)
 	}
+	for _, addr := range addrs6 {
+		c, err := httpu.NewHTTPUClientAddr(addr)
+		if err != nil {
+			// IPv6 addresses may not be usable yet (e.g. during duplicate
+			// address detection); discovery continues without them.
+			continue
+		}
+		closers = append(closers, c)
+		delegates = append(delegates, c)
+	}
 
 	closer := func() {
 		for _, c := range closers {
@@ -37,9 +52,12 @@ func httpuClient() (httpu.ClientInterfaceCtx, func(), error) {
 	return httpu.NewMultiClientCtx(delegates), closer, nil
 }
 
-// localIPv2MCastAddrs returns the set of IPv4 addresses on multicast-able
+// addrFilter reports whether to use the local address ip of iface.
+type addrFilter func(iface *net.Interface, ip net.IP) bool
+
+// localIPv4MCastAddrs returns the set of IPv4 addresses on multicast-able
 // network interfaces.
-func localIPv4MCastAddrs() ([]string, error) {
+func localIPv4MCastAddrs(filter addrFilter) ([]string, error) {
 	ifaces, err := net.Interfaces()
 	if err != nil {
 		return nil, ctxError(err, "requesting host interfaces")
@@ -67,9 +85,63 @@ func localIPv4MCastAddrs() ([]string, error) {
 				// Not IPv4.
 				continue
 			}
+			if !filter(&iface, addr.IP) {
+				continue
+			}
 			addrs = append(addrs, addr.IP.String())
 		}
 	}
 
 	return addrs, nil
 }
+
+// localIPv6MCastAddrs returns the first link-local IPv6 address (with its zone)
+// and the first other IPv6 address of each multicast-able network interface,
+// to search the link-local and site-local SSDP multicast groups from.
+func localIPv6MCastAddrs(filter addrFilter) ([]string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, ctxError(err, "requesting host interfaces")
+	}
+
+	var addrs []string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagMulticast == 0 || iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagUp == 0 {
+			// Does not support multicast or is a loopback address.
+			continue
+		}
+		ifaceAddrs, err := iface.Addrs()
+		if err != nil {
+			return nil, ctxErrorf(err,
+				"finding addresses on interface %s", iface.Name)
+		}
+		var linkLocal, other string
+		for _, netAddr := range ifaceAddrs {
+			addr, ok := netAddr.(*net.IPNet)
+			if !ok || addr.IP.To4() != nil {
+				// Not an IPv6 address.
+				continue
+			}
+			if !filter(&iface, addr.IP) {
+				continue
+			}
+			switch {
+			case addr.IP.IsLinkLocalUnicast():
+				if linkLocal == "" {
+					linkLocal = addr.IP.String() + "%" + iface.Name
+				}
+			case addr.IP.IsGlobalUnicast():
+				if other == "" {
+					other = addr.IP.String()
+				}
+			}
+		}
+		for _, addr := range []string{linkLocal, other} {
+			if addr != "" {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+
+	return addrs, nil
+}
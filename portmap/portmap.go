@@ -0,0 +1,523 @@
+// Package portmap maintains port mappings on NAT routers that implement the
+// UPnP Internet Gateway Device standard, version 1 or 2.
+//
+// NOTE: the interface for this is experimental and may change, or go away
+// entirely.
+package portmap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/huin/goupnp"
+	"github.com/huin/goupnp/dcps/internetgateway1"
+	"github.com/huin/goupnp/dcps/internetgateway2"
+	"github.com/huin/goupnp/soap"
+)
+
+const (
+	// DefaultLease is the lease duration requested for mappings if none is
+	// specified.
+	DefaultLease = time.Hour
+	// MaxLease is the longest lease duration requested, which is the most
+	// that IGD v2 routers allow.
+	MaxLease = 7 * 24 * time.Hour
+	// DefaultCheckInterval is how often a mapping is checked for having been
+	// lost, if no interval is specified.
+	DefaultCheckInterval = time.Minute
+
+	// opTimeout limits each request to the router.
+	opTimeout = 10 * time.Second
+	// maxAddAttempts limits the number of external ports tried when adding a
+	// mapping conflicts with existing mappings.
+	maxAddAttempts = 8
+)
+
+// UPnP error codes returned by WAN connection services, as described by the
+// WANIPConnection:2 service specification.
+const (
+	errorCodeInvalidAction                = 401
+	errorCodeOptionalActionNotImplemented = 602
+	errorCodeNoSuchEntryInArray           = 714
+	errorCodeConflictInMappingEntry       = 718
+	errorCodeSamePortValuesRequired       = 724
+	errorCodeOnlyPermanentLeasesSupported = 725
+)
+
+// Client is the subset of the WAN connection service clients that is used to
+// maintain port mappings. It is implemented by the WANIPConnection1,
+// WANIPConnection2 and WANPPPConnection1 clients in the internetgateway1 and
+// internetgateway2 packages.
+type Client interface {
+	GetServiceClient() *goupnp.ServiceClient
+	AddPortMappingCtx(
+		ctx context.Context,
+		NewRemoteHost string,
+		NewExternalPort uint16,
+		NewProtocol string,
+		NewInternalPort uint16,
+		NewInternalClient string,
+		NewEnabled bool,
+		NewPortMappingDescription string,
+		NewLeaseDuration uint32,
+	) (err error)
+	DeletePortMappingCtx(
+		ctx context.Context,
+		NewRemoteHost string,
+		NewExternalPort uint16,
+		NewProtocol string,
+	) (err error)
+	GetExternalIPAddressCtx(ctx context.Context) (NewExternalIPAddress string, err error)
+	GetSpecificPortMappingEntryCtx(
+		ctx context.Context,
+		NewRemoteHost string,
+		NewExternalPort uint16,
+		NewProtocol string,
+	) (NewInternalPort uint16, NewInternalClient string, NewEnabled bool, NewPortMappingDescription string, NewLeaseDuration uint32, err error)
+}
+
+// anyPortClient is implemented by WANIPConnection2 clients, where the router
+// picks a free external port.
+type anyPortClient interface {
+	AddAnyPortMappingCtx(
+		ctx context.Context,
+		NewRemoteHost string,
+		NewExternalPort uint16,
+		NewProtocol string,
+		NewInternalPort uint16,
+		NewInternalClient string,
+		NewEnabled bool,
+		NewPortMappingDescription string,
+		NewLeaseDuration uint32,
+	) (NewReservedPort uint16, err error)
+}
+
+var (
+	_ Client        = &internetgateway1.WANIPConnection1{}
+	_ Client        = &internetgateway1.WANPPPConnection1{}
+	_ Client        = &internetgateway2.WANIPConnection1{}
+	_ Client        = &internetgateway2.WANIPConnection2{}
+	_ Client        = &internetgateway2.WANPPPConnection1{}
+	_ anyPortClient = &internetgateway2.WANIPConnection2{}
+)
+
+// FindClient discovers WAN connection services on the network, and picks the
+// best one. WANIPConnection:2 is preferred, as it supports AddAnyPortMapping,
+// followed by WANIPConnection:1 and WANPPPConnection:1. Services that report
+// an external IP address are preferred over those that do not, which are
+// typically not connected.
+func FindClient(ctx context.Context) (Client, error) {
+	tasks, taskCtx := errgroup.WithContext(ctx)
+	var ip2Clients []*internetgateway2.WANIPConnection2
+	tasks.Go(func() error {
+		var err error
+		ip2Clients, _, err = internetgateway2.NewWANIPConnection2ClientsCtx(taskCtx)
+		return err
+	})
+	var ip1Clients []*internetgateway2.WANIPConnection1
+	tasks.Go(func() error {
+		var err error
+		ip1Clients, _, err = internetgateway2.NewWANIPConnection1ClientsCtx(taskCtx)
+		return err
+	})
+	var ppp1Clients []*internetgateway2.WANPPPConnection1
+	tasks.Go(func() error {
+		var err error
+		ppp1Clients, _, err = internetgateway2.NewWANPPPConnection1ClientsCtx(taskCtx)
+		return err
+	})
+	if err := tasks.Wait(); err != nil {
+		return nil, err
+	}
+
+	var candidates []Client
+	for _, c := range ip2Clients {
+		candidates = append(candidates, c)
+	}
+	for _, c := range ip1Clients {
+		candidates = append(candidates, c)
+	}
+	for _, c := range ppp1Clients {
+		candidates = append(candidates, c)
+	}
+	return pickClient(ctx, candidates)
+}
+
+// pickClient returns the first of the candidates that reports an external IP
+// address, or the first candidate if none do.
+func pickClient(ctx context.Context, candidates []Client) (Client, error) {
+	if len(candidates) == 0 {
+		return nil, errors.New("portmap: no WAN connection services found")
+	}
+	for _, c := range candidates {
+		opCtx, cancel := context.WithTimeout(ctx, opTimeout)
+		ip, err := c.GetExternalIPAddressCtx(opCtx)
+		cancel()
+		if err == nil && net.ParseIP(ip) != nil {
+			return c, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return candidates[0], nil
+}
+
+// Config describes a port mapping to maintain.
+type Config struct {
+	// Protocol is "TCP" or "UDP".
+	Protocol string
+	// InternalPort is the port on the internal client to forward to.
+	InternalPort uint16
+	// ExternalPort is the preferred external port. InternalPort is preferred
+	// if zero. Another port is used if it is not available.
+	ExternalPort uint16
+	// InternalClient is the LAN address to forward to. If nil, the local
+	// address that the router is reached from is used.
+	InternalClient net.IP
+	// Description is the informational description of the mapping.
+	Description string
+	// Lease is the requested lease duration, DefaultLease if zero. It is
+	// rounded down to whole seconds, and limited to between a second and
+	// MaxLease. Mappings are renewed at half of the lease. If the router only
+	// supports permanent leases, a permanent mapping is added instead.
+	Lease time.Duration
+	// CheckInterval is how often the mapping is checked for having been lost,
+	// e.g. by a router reboot, DefaultCheckInterval if zero. Lost mappings are
+	// added again.
+	CheckInterval time.Duration
+}
+
+// Mapper maintains a single port mapping on a router, until it is closed.
+type Mapper struct {
+	client         Client
+	config         Config
+	internalClient string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	lock         sync.Mutex
+	externalIP   net.IP
+	externalPort uint16
+	leaseSecs    uint32
+	err          error
+	closed       bool
+	stopped      chan struct{}
+}
+
+// Map discovers a router with FindClient, and adds the port mapping to it.
+func Map(ctx context.Context, config Config) (*Mapper, error) {
+	client, err := FindClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewMapper(ctx, client, config)
+}
+
+// NewMapper adds the port mapping with the client, and maintains it in the
+// background until Close is called.
+func NewMapper(ctx context.Context, client Client, config Config) (*Mapper, error) {
+	if config.Protocol != "TCP" && config.Protocol != "UDP" {
+		return nil, fmt.Errorf("portmap: unsupported protocol %q", config.Protocol)
+	}
+	if config.InternalPort == 0 {
+		return nil, errors.New("portmap: missing internal port")
+	}
+	switch {
+	case config.Lease <= 0:
+		config.Lease = DefaultLease
+	case config.Lease < time.Second:
+		// Less would request a permanent lease.
+		config.Lease = time.Second
+	case config.Lease > MaxLease:
+		config.Lease = MaxLease
+	}
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = DefaultCheckInterval
+	}
+	internalClient := config.InternalClient
+	if internalClient == nil {
+		var err error
+		if internalClient, err = localAddrFor(client.GetServiceClient()); err != nil {
+			return nil, err
+		}
+	}
+
+	m := &Mapper{
+		client:         client,
+		config:         config,
+		internalClient: internalClient.String(),
+		leaseSecs:      uint32(config.Lease / time.Second),
+		stopped:        make(chan struct{}),
+	}
+	if err := m.add(ctx, config.ExternalPort); err != nil {
+		return nil, err
+	}
+	if err := m.updateExternalIP(ctx); err != nil {
+		m.delete(ctx)
+		return nil, err
+	}
+
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	go m.maintain()
+	return m, nil
+}
+
+// localAddrFor returns the local address that the service was discovered
+// from, or otherwise that is used to reach it.
+func localAddrFor(sc *goupnp.ServiceClient) (net.IP, error) {
+	if ip := sc.LocalAddr(); ip != nil {
+		return ip, nil
+	}
+	host := sc.SOAPClient.EndpointURL.Hostname()
+	// No packets are sent, this just selects a route.
+	conn, err := net.Dial("udp4", net.JoinHostPort(host, "1900"))
+	if err != nil {
+		return nil, fmt.Errorf("portmap: error determining local address to reach %q: %v", host, err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+// ExternalIP returns the external IP address of the router.
+func (m *Mapper) ExternalIP() net.IP {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.externalIP
+}
+
+// ExternalPort returns the external port that is mapped.
+func (m *Mapper) ExternalPort() uint16 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.externalPort
+}
+
+// Err returns the error from the most recent attempt to renew or check the
+// mapping, or nil if it succeeded.
+func (m *Mapper) Err() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.err
+}
+
+// Close stops maintaining the mapping, and deletes it from the router.
+func (m *Mapper) Close() error {
+	m.lock.Lock()
+	if m.closed {
+		m.lock.Unlock()
+		return nil
+	}
+	m.closed = true
+	m.lock.Unlock()
+
+	m.cancel()
+	<-m.stopped
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	return m.delete(ctx)
+}
+
+// maintain renews the mapping before its lease expires, and periodically
+// checks that it still exists, until Close is called.
+func (m *Mapper) maintain() {
+	defer close(m.stopped)
+	checkAt := time.Now().Add(m.config.CheckInterval)
+	renewAt := m.renewTime(2)
+	for {
+		// Wait for whichever of the renewal and the check is due first.
+		next := checkAt
+		if !renewAt.IsZero() && renewAt.Before(next) {
+			next = renewAt
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-m.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		var err error
+		renewing := !renewAt.IsZero() && !time.Now().Before(renewAt)
+		if renewing {
+			err = m.renew()
+		} else {
+			err = m.check()
+		}
+		switch {
+		case err == nil:
+			renewAt = m.renewTime(2)
+		case renewing:
+			// Retry well before the lease expires.
+			renewAt = m.renewTime(8)
+		}
+		checkAt = time.Now().Add(m.config.CheckInterval)
+		m.lock.Lock()
+		m.err = err
+		m.lock.Unlock()
+	}
+}
+
+// renewTime returns when the mapping should next be renewed, after 1/divisor
+// of the lease, or the zero time if the lease is permanent.
+func (m *Mapper) renewTime(divisor time.Duration) time.Time {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.leaseSecs == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(m.leaseSecs) * time.Second / divisor)
+}
+
+// renew adds the mapping again with the same external port, which extends its
+// lease. If the port has been taken in the meantime, another is used.
+func (m *Mapper) renew() error {
+	ctx, cancel := context.WithTimeout(m.ctx, opTimeout)
+	defer cancel()
+	if err := m.add(ctx, m.ExternalPort()); err != nil {
+		return err
+	}
+	return m.updateExternalIP(ctx)
+}
+
+// check adds the mapping again if it no longer exists on the router, as
+// happens when it reboots.
+func (m *Mapper) check() error {
+	ctx, cancel := context.WithTimeout(m.ctx, opTimeout)
+	defer cancel()
+	internalPort, internalClient, enabled, _, _, err := m.client.GetSpecificPortMappingEntryCtx(
+		ctx, "", m.ExternalPort(), m.config.Protocol)
+	lost := upnpErrorCode(err) == errorCodeNoSuchEntryInArray
+	if err != nil && !lost {
+		return err
+	}
+	if lost || internalPort != m.config.InternalPort || internalClient != m.internalClient || !enabled {
+		if err := m.add(ctx, m.ExternalPort()); err != nil {
+			return err
+		}
+	}
+	return m.updateExternalIP(ctx)
+}
+
+// add adds the mapping, preferring the given external port.
+func (m *Mapper) add(ctx context.Context, preferredPort uint16) error {
+	if preferredPort == 0 {
+		preferredPort = m.config.InternalPort
+	}
+	m.lock.Lock()
+	leaseSecs := m.leaseSecs
+	m.lock.Unlock()
+
+	if c, ok := m.client.(anyPortClient); ok {
+		port, err := m.addAny(ctx, c, preferredPort, &leaseSecs)
+		switch code := upnpErrorCode(err); {
+		case err == nil:
+			m.setMapping(port, leaseSecs)
+			return nil
+		case code == errorCodeInvalidAction || code == errorCodeOptionalActionNotImplemented:
+			// Fall back to AddPortMapping.
+		default:
+			return fmt.Errorf("portmap: error adding port mapping: %w", err)
+		}
+	}
+
+	port := preferredPort
+	var err error
+	for attempt := 0; attempt < maxAddAttempts; {
+		err = m.client.AddPortMappingCtx(ctx, "", port, m.config.Protocol,
+			m.config.InternalPort, m.internalClient, true, m.config.Description, leaseSecs)
+		switch upnpErrorCode(err) {
+		case 0:
+			if err != nil {
+				return fmt.Errorf("portmap: error adding port mapping: %w", err)
+			}
+			m.setMapping(port, leaseSecs)
+			return nil
+		case errorCodeOnlyPermanentLeasesSupported:
+			if leaseSecs == 0 {
+				return fmt.Errorf("portmap: error adding port mapping: %w", err)
+			}
+			leaseSecs = 0
+		case errorCodeSamePortValuesRequired:
+			if port == m.config.InternalPort {
+				return fmt.Errorf("portmap: error adding port mapping: %w", err)
+			}
+			port = m.config.InternalPort
+			attempt++
+		case errorCodeConflictInMappingEntry:
+			port = randomPort()
+			attempt++
+		default:
+			return fmt.Errorf("portmap: error adding port mapping: %w", err)
+		}
+	}
+	return fmt.Errorf("portmap: no free external port found after %d attempts: %w", maxAddAttempts, err)
+}
+
+// addAny adds the mapping with AddAnyPortMapping, where the router picks
+// another external port if the preferred one is not available. leaseSecs is
+// set to zero if the router only supports permanent leases.
+func (m *Mapper) addAny(ctx context.Context, c anyPortClient, preferredPort uint16, leaseSecs *uint32) (uint16, error) {
+	port, err := c.AddAnyPortMappingCtx(ctx, "", preferredPort, m.config.Protocol,
+		m.config.InternalPort, m.internalClient, true, m.config.Description, *leaseSecs)
+	if upnpErrorCode(err) == errorCodeOnlyPermanentLeasesSupported && *leaseSecs != 0 {
+		*leaseSecs = 0
+		port, err = c.AddAnyPortMappingCtx(ctx, "", preferredPort, m.config.Protocol,
+			m.config.InternalPort, m.internalClient, true, m.config.Description, 0)
+	}
+	return port, err
+}
+
+func (m *Mapper) setMapping(externalPort uint16, leaseSecs uint32) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.externalPort = externalPort
+	m.leaseSecs = leaseSecs
+}
+
+func (m *Mapper) updateExternalIP(ctx context.Context) error {
+	ipStr, err := m.client.GetExternalIPAddressCtx(ctx)
+	if err != nil {
+		return fmt.Errorf("portmap: error getting external IP address: %w", err)
+	}
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return fmt.Errorf("portmap: router returned bad external IP address %q", ipStr)
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.externalIP = ip
+	return nil
+}
+
+func (m *Mapper) delete(ctx context.Context) error {
+	err := m.client.DeletePortMappingCtx(ctx, "", m.ExternalPort(), m.config.Protocol)
+	if err != nil && upnpErrorCode(err) != errorCodeNoSuchEntryInArray {
+		return fmt.Errorf("portmap: error deleting port mapping: %w", err)
+	}
+	return nil
+}
+
+// upnpErrorCode returns the UPnP error code from a SOAP fault, or 0 if err is
+// not a SOAP fault.
+func upnpErrorCode(err error) int {
+	var fault *soap.SOAPFaultError
+	if errors.As(err, &fault) {
+		return fault.Detail.UPnPError.Errorcode
+	}
+	return 0
+}
+
+// randomPort returns a random port outside of the well-known range.
+func randomPort() uint16 {
+	return uint16(1024 + rand.Intn(65536-1024))
+}
@@ -0,0 +1,266 @@
+package portmap
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/huin/goupnp"
+	"github.com/huin/goupnp/soap"
+)
+
+type fakeMapping struct {
+	internalPort   uint16
+	internalClient string
+	leaseSecs      uint32
+}
+
+// fakeRouter implements Client, with mappings keyed by protocol and external
+// port.
+type fakeRouter struct {
+	lock           sync.Mutex
+	mappings       map[uint16]fakeMapping
+	taken          map[uint16]bool
+	permanentOnly  bool
+	addCalls       int
+	deletedPorts   []uint16
+	externalIPAddr string
+}
+
+func newFakeRouter() *fakeRouter {
+	return &fakeRouter{
+		mappings:       make(map[uint16]fakeMapping),
+		taken:          make(map[uint16]bool),
+		externalIPAddr: "203.0.113.7",
+	}
+}
+
+func upnpError(code int) error {
+	err := &soap.SOAPFaultError{FaultCode: "s:Client", FaultString: "UPnPError"}
+	err.Detail.UPnPError.Errorcode = code
+	return err
+}
+
+func (r *fakeRouter) GetServiceClient() *goupnp.ServiceClient {
+	return &goupnp.ServiceClient{}
+}
+
+func (r *fakeRouter) AddPortMappingCtx(ctx context.Context, remoteHost string, externalPort uint16, protocol string,
+	internalPort uint16, internalClient string, enabled bool, description string, leaseSecs uint32) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.addCalls++
+	if r.permanentOnly && leaseSecs != 0 {
+		return upnpError(errorCodeOnlyPermanentLeasesSupported)
+	}
+	if r.taken[externalPort] {
+		return upnpError(errorCodeConflictInMappingEntry)
+	}
+	r.mappings[externalPort] = fakeMapping{internalPort, internalClient, leaseSecs}
+	return nil
+}
+
+func (r *fakeRouter) DeletePortMappingCtx(ctx context.Context, remoteHost string, externalPort uint16, protocol string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.mappings[externalPort]; !ok {
+		return upnpError(errorCodeNoSuchEntryInArray)
+	}
+	delete(r.mappings, externalPort)
+	r.deletedPorts = append(r.deletedPorts, externalPort)
+	return nil
+}
+
+func (r *fakeRouter) GetExternalIPAddressCtx(ctx context.Context) (string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.externalIPAddr, nil
+}
+
+func (r *fakeRouter) GetSpecificPortMappingEntryCtx(ctx context.Context, remoteHost string, externalPort uint16, protocol string) (
+	uint16, string, bool, string, uint32, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	m, ok := r.mappings[externalPort]
+	if !ok {
+		return 0, "", false, "", 0, upnpError(errorCodeNoSuchEntryInArray)
+	}
+	return m.internalPort, m.internalClient, true, "", m.leaseSecs, nil
+}
+
+// reboot loses all mappings.
+func (r *fakeRouter) reboot() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.mappings = make(map[uint16]fakeMapping)
+}
+
+func (r *fakeRouter) mapping(port uint16) (fakeMapping, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	m, ok := r.mappings[port]
+	return m, ok
+}
+
+// fakeRouter2 additionally implements AddAnyPortMapping.
+type fakeRouter2 struct {
+	*fakeRouter
+	anyCalls int
+}
+
+func (r *fakeRouter2) AddAnyPortMappingCtx(ctx context.Context, remoteHost string, externalPort uint16, protocol string,
+	internalPort uint16, internalClient string, enabled bool, description string, leaseSecs uint32) (uint16, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.anyCalls++
+	for r.taken[externalPort] {
+		externalPort++
+	}
+	r.mappings[externalPort] = fakeMapping{internalPort, internalClient, leaseSecs}
+	return externalPort, nil
+}
+
+var testConfig = Config{
+	Protocol:       "TCP",
+	InternalPort:   8080,
+	InternalClient: net.IPv4(192, 168, 1, 6),
+	Description:    "portmap test",
+	Lease:          time.Hour,
+}
+
+func TestMapperConflict(t *testing.T) {
+	router := newFakeRouter()
+	router.taken[8080] = true
+
+	m, err := NewMapper(context.Background(), router, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := m.ExternalPort()
+	if port == 8080 || port == 0 {
+		t.Errorf("got external port %d, want another port than the taken one", port)
+	}
+	if got, want := m.ExternalIP().String(), "203.0.113.7"; got != want {
+		t.Errorf("got external IP %s, want %s", got, want)
+	}
+	if got, ok := router.mapping(port); !ok || got.internalPort != 8080 || got.internalClient != "192.168.1.6" {
+		t.Errorf("got mapping %+v (exists=%t), want to 192.168.1.6:8080", got, ok)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Errorf("Close: got error %v, want success", err)
+	}
+	if _, ok := router.mapping(port); ok {
+		t.Error("mapping still exists after Close")
+	}
+}
+
+func TestMapperPermanentOnly(t *testing.T) {
+	router := newFakeRouter()
+	router.permanentOnly = true
+
+	m, err := NewMapper(context.Background(), router, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if got, ok := router.mapping(8080); !ok || got.leaseSecs != 0 {
+		t.Errorf("got mapping %+v (exists=%t), want permanent lease", got, ok)
+	}
+}
+
+func TestMapperAnyPort(t *testing.T) {
+	router := &fakeRouter2{fakeRouter: newFakeRouter()}
+	router.taken[8080] = true
+
+	m, err := NewMapper(context.Background(), router, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if got, want := m.ExternalPort(), uint16(8081); got != want {
+		t.Errorf("got external port %d, want %d", got, want)
+	}
+	if router.anyCalls != 1 || router.addCalls != 0 {
+		t.Errorf("got %d AddAnyPortMapping and %d AddPortMapping calls, want 1 and 0",
+			router.anyCalls, router.addCalls)
+	}
+}
+
+func TestMapperReboot(t *testing.T) {
+	router := newFakeRouter()
+	config := testConfig
+	config.CheckInterval = 10 * time.Millisecond
+
+	m, err := NewMapper(context.Background(), router, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	router.reboot()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := router.mapping(8080); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("mapping was not added again after reboot")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMapperRenewBeforeCheck(t *testing.T) {
+	router := newFakeRouter()
+	config := testConfig
+	// Renewal is due long before the first check.
+	config.Lease = time.Second
+	config.CheckInterval = time.Hour
+
+	m, err := NewMapper(context.Background(), router, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		router.lock.Lock()
+		addCalls := router.addCalls
+		router.lock.Unlock()
+		if addCalls >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("mapping was not renewed before its lease expired")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMapperLeaseLimits(t *testing.T) {
+	tests := []struct {
+		lease time.Duration
+		want  uint32
+	}{
+		{time.Millisecond, 1},
+		{time.Minute, 60},
+		{1 << 62, uint32(MaxLease / time.Second)},
+	}
+	for _, test := range tests {
+		router := newFakeRouter()
+		config := testConfig
+		config.Lease = test.lease
+		m, err := NewMapper(context.Background(), router, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := router.mapping(8080); got.leaseSecs != test.want {
+			t.Errorf("Lease %v: got lease of %d seconds, want %d", test.lease, got.leaseSecs, test.want)
+		}
+		m.Close()
+	}
+}
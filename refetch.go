@@ -0,0 +1,74 @@
+package goupnp
+
+import (
+	"context"
+
+	"github.com/huin/goupnp/ssdp"
+)
+
+// refetchBuffer is the number of device updates buffered by RefetchOnChange.
+const refetchBuffer = 64
+
+// RefetchOnChange fetches the root device description of each device in reg
+// that reboots or changes its configuration (see ssdp.EventDeviceRebooted and
+// ssdp.EventDeviceConfigChanged), and passes the result to handler, so that
+// cached RootDevice values and event subscriptions can be refreshed. A device
+// is fetched once for each change of its BOOTID and CONFIGID, even if both
+// change at once. cfg may be nil to use the default FetchConfig.
+//
+// RefetchOnChange runs until ctx is done, or the registry's subscription is
+// disconnected, and calls handler from the calling goroutine.
+func RefetchOnChange(
+	ctx context.Context,
+	reg *ssdp.Registry,
+	cfg *FetchConfig,
+	handler func(d *ssdp.Device, root *RootDevice, err error),
+) {
+	sub := reg.SubscribeDevices(refetchBuffer, ssdp.DropOldest)
+	defer sub.Cancel()
+	refetchUpdates(ctx, sub, cfg, handler)
+}
+
+// refetchUpdates implements RefetchOnChange for the device updates from sub.
+func refetchUpdates(
+	ctx context.Context,
+	sub *ssdp.Subscription,
+	cfg *FetchConfig,
+	handler func(d *ssdp.Device, root *RootDevice, err error),
+) {
+	if cfg == nil {
+		cfg = &FetchConfig{}
+	}
+	type ids struct{ bootID, configID int32 }
+	fetched := make(map[string]ids)
+	for {
+		var u ssdp.Update
+		var ok bool
+		select {
+		case u, ok = <-sub.Updates():
+			if !ok {
+				// The subscription was cancelled or disconnected.
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+		switch u.EventType {
+		case ssdp.EventDeviceRebooted, ssdp.EventDeviceConfigChanged:
+		case ssdp.EventDeviceOffline:
+			delete(fetched, u.USN)
+			continue
+		default:
+			continue
+		}
+		d := u.Device
+		current := ids{d.BootID, d.ConfigID}
+		if last, ok := fetched[d.UDN]; ok && last == current {
+			continue
+		}
+		fetched[d.UDN] = current
+		loc := d.Location
+		root, err := cfg.DeviceByURL(ctx, &loc)
+		handler(d, root, err)
+	}
+}
@@ -0,0 +1,88 @@
+package goupnp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/huin/goupnp/ssdp"
+)
+
+func TestRefetchOnChange(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testDescription))
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reg := ssdp.NewRegistry()
+	type result struct {
+		d    *ssdp.Device
+		root *RootDevice
+		err  error
+	}
+	results := make(chan result, 10)
+	sub := reg.SubscribeDevices(10, ssdp.DropNewest)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		refetchUpdates(ctx, sub, nil, func(d *ssdp.Device, root *RootDevice, err error) {
+			results <- result{d, root, err}
+		})
+	}()
+	reg.ServeMessage(newAlive("uuid:1", ts.URL, "1", "1"))
+	// Both BOOTID and CONFIGID change, but the device is fetched once.
+	reg.ServeMessage(newAlive("uuid:1", ts.URL, "2", "2"))
+	reg.ServeMessage(newAlive("uuid:1", ts.URL, "2", "2"))
+
+	select {
+	case r := <-results:
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		if r.d.UDN != "uuid:1" || r.root.Device.FriendlyName != "Test device" {
+			t.Errorf("got device %q with %+v, want uuid:1 with the test description", r.d.UDN, r.root.Device)
+		}
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for refetch")
+	}
+	cancel()
+	<-done
+	if len(results) != 0 {
+		t.Errorf("got %d extra refetches, want none", len(results))
+	}
+}
+
+func newAlive(usn, location, bootID, configID string) *http.Request {
+	header := http.Header{}
+	header.Set("NTS", "ssdp:alive")
+	header.Set("USN", usn)
+	header.Set("LOCATION", location)
+	header.Set("CACHE-CONTROL", "max-age=1800")
+	header.Set("BOOTID.UPNP.ORG", bootID)
+	header.Set("CONFIGID.UPNP.ORG", configID)
+	return &http.Request{Method: "NOTIFY", RemoteAddr: "127.0.0.1:1900", Header: header}
+}
+
+func TestRefetchOnChangeCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	sub := ssdp.NewRegistry().SubscribeDevices(10, ssdp.DropNewest)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		refetchUpdates(ctx, sub, nil, func(d *ssdp.Device, root *RootDevice, err error) {
+			t.Errorf("got refetch of %v after cancel, want none", d)
+		})
+	}()
+	sub.Cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("refetchUpdates did not return after its subscription was cancelled")
+	}
+}
@@ -19,7 +19,7 @@ func cleanWhitespace(s *string) {
 // http://upnp.org/specs/arch/UPnP-arch-DeviceArchitecture-v1.1.pdf
 type SCPD struct {
 	XMLName        xml.Name        `xml:"scpd"`
-	ConfigId       string          `xml:"configId,attr"`
+	ConfigId       string          `xml:"configId,attr,omitempty"`
 	SpecVersion    SpecVersion     `xml:"specVersion"`
 	Actions        []Action        `xml:"actionList>action"`
 	StateVariables []StateVariable `xml:"serviceStateTable>stateVariable"`
@@ -111,7 +111,7 @@ type Argument struct {
 	Name                 string `xml:"name"`
 	Direction            string `xml:"direction"`            // in|out
 	RelatedStateVariable string `xml:"relatedStateVariable"` // ?
-	Retval               string `xml:"retval"`               // ?
+	Retval               string `xml:"retval,omitempty"`     // ?
 }
 
 func (arg *Argument) clean() {
@@ -131,10 +131,10 @@ func (arg *Argument) IsOutput() bool {
 
 type StateVariable struct {
 	Name              string             `xml:"name"`
-	SendEvents        string             `xml:"sendEvents,attr"` // yes|no
-	Multicast         string             `xml:"multicast,attr"`  // yes|no
+	SendEvents        string             `xml:"sendEvents,attr,omitempty"` // yes|no
+	Multicast         string             `xml:"multicast,attr,omitempty"`  // yes|no
 	DataType          DataType           `xml:"dataType"`
-	DefaultValue      string             `xml:"defaultValue"`
+	DefaultValue      string             `xml:"defaultValue,omitempty"`
 	AllowedValueRange *AllowedValueRange `xml:"allowedValueRange"`
 	AllowedValues     []string           `xml:"allowedValueList>allowedValue"`
 }
@@ -167,7 +167,7 @@ func (r *AllowedValueRange) clean() {
 
 type DataType struct {
 	Name string `xml:",chardata"`
-	Type string `xml:"type,attr"`
+	Type string `xml:"type,attr,omitempty"`
 }
 
 func (dt *DataType) clean() {
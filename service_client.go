@@ -6,6 +6,7 @@ import (
 	"net"
 	"net/url"
 
+	"github.com/huin/goupnp/gena"
 	"github.com/huin/goupnp/soap"
 )
 
@@ -73,7 +74,9 @@ func NewServiceClientsByURL(loc *url.URL, searchTarget string) ([]ServiceClient,
 }
 
 // NewServiceClientsFromDevice creates client(s) for the given service URN, in
-// a given root device. The loc parameter is simply assigned to the
+// a given root device. If it has no services of that type and version, they
+// are created for the services with the highest later version of the type,
+// which are backward compatible. The loc parameter is simply assigned to the
 // Location attribute of the returned ServiceClient(s).
 func NewServiceClientsFromRootDevice(rootDevice *RootDevice, loc *url.URL, searchTarget string) ([]ServiceClient, error) {
 	return newServiceClientsFromRootDevice(rootDevice, loc, searchTarget, nil)
@@ -87,6 +90,10 @@ func newServiceClientsFromRootDevice(
 ) ([]ServiceClient, error) {
 	device := &rootDevice.Device
 	srvs := device.FindService(searchTarget)
+	if len(srvs) == 0 {
+		// Later versions of the service are backward compatible.
+		srvs = device.FindHighestService(searchTarget)
+	}
 	if len(srvs) == 0 {
 		return nil, fmt.Errorf("goupnp: service %q not found within device %q (UDN=%q)",
 			searchTarget, device.FriendlyName, device.UDN)
@@ -116,3 +123,14 @@ func (client *ServiceClient) GetServiceClient() *ServiceClient {
 func (client *ServiceClient) LocalAddr() net.IP {
 	return client.localAddr
 }
+
+// Subscribe subscribes to state variable events from the service, which are
+// received by sub. The address the service was discovered from (if known) is
+// used as the address for the service to send events to.
+func (client *ServiceClient) Subscribe(ctx context.Context, sub *gena.Subscriber) (*gena.Subscription, error) {
+	if !client.Service.EventSubURL.Ok {
+		return nil, fmt.Errorf("goupnp: service %q has bad/missing event subscription URL",
+			client.Service.ServiceId)
+	}
+	return sub.Subscribe(ctx, &client.Service.EventSubURL.URL, client.localAddr)
+}
@@ -0,0 +1,315 @@
+package soap
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// argCodec converts between a Go value and its SOAP string encoding, using the
+// Marshal* and Unmarshal* functions.
+type argCodec struct {
+	goType    reflect.Type
+	marshal   func(v interface{}) (string, error)
+	unmarshal func(s string) (interface{}, error)
+}
+
+// argCodecs maps from a SOAP type (e.g "fixed.14.4") to its codec. This
+// mirrors TypeDataMap.
+var argCodecs = map[string]argCodec{
+	"ui1": {
+		reflect.TypeOf(uint8(0)),
+		func(v interface{}) (string, error) { return MarshalUi1(v.(uint8)) },
+		func(s string) (interface{}, error) { return UnmarshalUi1(s) },
+	},
+	"ui2": {
+		reflect.TypeOf(uint16(0)),
+		func(v interface{}) (string, error) { return MarshalUi2(v.(uint16)) },
+		func(s string) (interface{}, error) { return UnmarshalUi2(s) },
+	},
+	"ui4": {
+		reflect.TypeOf(uint32(0)),
+		func(v interface{}) (string, error) { return MarshalUi4(v.(uint32)) },
+		func(s string) (interface{}, error) { return UnmarshalUi4(s) },
+	},
+	"ui8": {
+		reflect.TypeOf(uint64(0)),
+		func(v interface{}) (string, error) { return MarshalUi8(v.(uint64)) },
+		func(s string) (interface{}, error) { return UnmarshalUi8(s) },
+	},
+	"i1": {
+		reflect.TypeOf(int8(0)),
+		func(v interface{}) (string, error) { return MarshalI1(v.(int8)) },
+		func(s string) (interface{}, error) { return UnmarshalI1(s) },
+	},
+	"i2": {
+		reflect.TypeOf(int16(0)),
+		func(v interface{}) (string, error) { return MarshalI2(v.(int16)) },
+		func(s string) (interface{}, error) { return UnmarshalI2(s) },
+	},
+	"i4": {
+		reflect.TypeOf(int32(0)),
+		func(v interface{}) (string, error) { return MarshalI4(v.(int32)) },
+		func(s string) (interface{}, error) { return UnmarshalI4(s) },
+	},
+	"int": {
+		reflect.TypeOf(int64(0)),
+		func(v interface{}) (string, error) { return MarshalInt(v.(int64)) },
+		func(s string) (interface{}, error) { return UnmarshalInt(s) },
+	},
+	"r4": {
+		reflect.TypeOf(float32(0)),
+		func(v interface{}) (string, error) { return MarshalR4(v.(float32)) },
+		func(s string) (interface{}, error) { return UnmarshalR4(s) },
+	},
+	"r8": {
+		reflect.TypeOf(float64(0)),
+		func(v interface{}) (string, error) { return MarshalR8(v.(float64)) },
+		func(s string) (interface{}, error) { return UnmarshalR8(s) },
+	},
+	"number": { // Alias for r8.
+		reflect.TypeOf(float64(0)),
+		func(v interface{}) (string, error) { return MarshalR8(v.(float64)) },
+		func(s string) (interface{}, error) { return UnmarshalR8(s) },
+	},
+	"fixed.14.4": {
+		reflect.TypeOf(float64(0)),
+		func(v interface{}) (string, error) { return MarshalFixed14_4(v.(float64)) },
+		func(s string) (interface{}, error) { return UnmarshalFixed14_4(s) },
+	},
+	"float": {
+		reflect.TypeOf(float64(0)),
+		func(v interface{}) (string, error) { return MarshalR8(v.(float64)) },
+		func(s string) (interface{}, error) { return UnmarshalR8(s) },
+	},
+	"char": {
+		reflect.TypeOf(rune(0)),
+		func(v interface{}) (string, error) { return MarshalChar(v.(rune)) },
+		func(s string) (interface{}, error) { return UnmarshalChar(s) },
+	},
+	"string": {
+		reflect.TypeOf(""),
+		func(v interface{}) (string, error) { return MarshalString(v.(string)) },
+		func(s string) (interface{}, error) { return UnmarshalString(s) },
+	},
+	"date": {
+		reflect.TypeOf(time.Time{}),
+		func(v interface{}) (string, error) { return MarshalDate(v.(time.Time)) },
+		func(s string) (interface{}, error) { return UnmarshalDate(s) },
+	},
+	"dateTime": {
+		reflect.TypeOf(time.Time{}),
+		func(v interface{}) (string, error) { return MarshalDateTime(v.(time.Time)) },
+		func(s string) (interface{}, error) { return UnmarshalDateTime(s) },
+	},
+	"dateTime.tz": {
+		reflect.TypeOf(time.Time{}),
+		func(v interface{}) (string, error) { return MarshalDateTimeTz(v.(time.Time)) },
+		func(s string) (interface{}, error) { return UnmarshalDateTimeTz(s) },
+	},
+	"time": {
+		reflect.TypeOf(TimeOfDay{}),
+		func(v interface{}) (string, error) { return MarshalTimeOfDay(v.(TimeOfDay)) },
+		func(s string) (interface{}, error) { return UnmarshalTimeOfDay(s) },
+	},
+	"time.tz": {
+		reflect.TypeOf(TimeOfDay{}),
+		func(v interface{}) (string, error) { return MarshalTimeOfDayTz(v.(TimeOfDay)) },
+		func(s string) (interface{}, error) { return UnmarshalTimeOfDayTz(s) },
+	},
+	"boolean": {
+		reflect.TypeOf(false),
+		func(v interface{}) (string, error) { return MarshalBoolean(v.(bool)) },
+		func(s string) (interface{}, error) { return UnmarshalBoolean(s) },
+	},
+	"bin.base64": {
+		reflect.TypeOf([]byte(nil)),
+		func(v interface{}) (string, error) { return MarshalBinBase64(v.([]byte)) },
+		func(s string) (interface{}, error) { return UnmarshalBinBase64(s) },
+	},
+	"bin.hex": {
+		reflect.TypeOf([]byte(nil)),
+		func(v interface{}) (string, error) { return MarshalBinHex(v.([]byte)) },
+		func(s string) (interface{}, error) { return UnmarshalBinHex(s) },
+	},
+	"uri": {
+		reflect.TypeOf((*url.URL)(nil)),
+		func(v interface{}) (string, error) { return MarshalURI(v.(*url.URL)) },
+		func(s string) (interface{}, error) { return UnmarshalURI(s) },
+	},
+}
+
+// defaultArgTypes maps from a Go type to the SOAP type used for it when the
+// field tag does not specify one. Note that rune is an alias for int32, so
+// "char" fields must be tagged explicitly.
+var defaultArgTypes = map[reflect.Type]string{
+	reflect.TypeOf(uint8(0)):        "ui1",
+	reflect.TypeOf(uint16(0)):       "ui2",
+	reflect.TypeOf(uint32(0)):       "ui4",
+	reflect.TypeOf(uint64(0)):       "ui8",
+	reflect.TypeOf(int8(0)):         "i1",
+	reflect.TypeOf(int16(0)):        "i2",
+	reflect.TypeOf(int32(0)):        "i4",
+	reflect.TypeOf(int64(0)):        "int",
+	reflect.TypeOf(float32(0)):      "r4",
+	reflect.TypeOf(float64(0)):      "r8",
+	reflect.TypeOf(""):              "string",
+	reflect.TypeOf(time.Time{}):     "dateTime",
+	reflect.TypeOf(TimeOfDay{}):     "time",
+	reflect.TypeOf(false):           "boolean",
+	reflect.TypeOf([]byte(nil)):     "bin.base64",
+	reflect.TypeOf((*url.URL)(nil)): "uri",
+}
+
+// Arg is a single named argument of a SOAP action, in its string encoding.
+type Arg struct {
+	Name  string
+	Value string
+}
+
+// argField describes how a struct field is encoded as an argument.
+type argField struct {
+	index int
+	name  string
+	codec argCodec
+}
+
+// argFields determines the argument encoding for each field of the struct
+// type t. Fields are tagged in the form `soap:"Name,type"`, where both parts
+// are optional. Name defaults to the field name, and type is a SOAP type
+// (e.g. "ui2" or "dateTime.tz") which defaults based on the Go type of the
+// field.
+func argFields(t reflect.Type) ([]argField, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("goupnp: SOAP args are not a struct but of type %v", t)
+	}
+	fields := make([]argField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// Unexported field.
+			continue
+		}
+		name := field.Name
+		var typeName string
+		if tag := field.Tag.Get("soap"); tag != "" {
+			parts := strings.SplitN(tag, ",", 2)
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			if len(parts) == 2 {
+				typeName = parts[1]
+			}
+		}
+		if typeName == "" {
+			var ok bool
+			if typeName, ok = defaultArgTypes[field.Type]; !ok {
+				// Allow for named types, e.g. `type Protocol string`.
+				for goType, tn := range defaultArgTypes {
+					if field.Type.Kind() == goType.Kind() && field.Type.ConvertibleTo(goType) {
+						typeName, ok = tn, true
+						break
+					}
+				}
+			}
+			if !ok {
+				return nil, fmt.Errorf("goupnp: SOAP arg %q has unsupported type %v", name, field.Type)
+			}
+		}
+		codec, ok := argCodecs[typeName]
+		if !ok {
+			return nil, fmt.Errorf("goupnp: SOAP arg %q has unknown SOAP type %q", name, typeName)
+		}
+		if !field.Type.ConvertibleTo(codec.goType) {
+			return nil, fmt.Errorf("goupnp: SOAP arg %q of type %v cannot hold SOAP type %q",
+				name, field.Type, typeName)
+		}
+		fields = append(fields, argField{index: i, name: name, codec: codec})
+	}
+	return fields, nil
+}
+
+// usesArgTags reports whether the struct type t, or the type that t points to,
+// has any field that is tagged with `soap:"..."` or is not a string.
+func usesArgTags(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if _, ok := field.Tag.Lookup("soap"); ok || field.Type.Kind() != reflect.String {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeArgs sets the fields of the struct pointed to by out from the named
+// arguments, using the Unmarshal* functions. See argFields for the struct tag
+// format. All fields must have a corresponding argument.
+func DecodeArgs(args []Arg, out interface{}) error {
+	return decodeArgs(args, out, true)
+}
+
+// decodeArgs is DecodeArgs, but fields without a corresponding argument are
+// left unchanged unless requireAll is set.
+func decodeArgs(args []Arg, out interface{}, requireAll bool) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("goupnp: SOAP args must be decoded into a non-nil pointer, got %T", out)
+	}
+	v = v.Elem()
+	fields, err := argFields(v.Type())
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]string, len(args))
+	for _, arg := range args {
+		byName[arg.Name] = arg.Value
+	}
+	for _, f := range fields {
+		s, ok := byName[f.name]
+		if !ok {
+			if !requireAll {
+				continue
+			}
+			return fmt.Errorf("goupnp: SOAP arg %q is missing", f.name)
+		}
+		value, err := f.codec.unmarshal(s)
+		if err != nil {
+			return fmt.Errorf("goupnp: SOAP arg %q has bad value: %v", f.name, err)
+		}
+		field := v.Field(f.index)
+		field.Set(reflect.ValueOf(value).Convert(field.Type()))
+	}
+	return nil
+}
+
+// EncodeArgs creates named arguments from the fields of the given struct (or
+// pointer to struct), using the Marshal* functions. See argFields for the
+// struct tag format.
+func EncodeArgs(in interface{}) ([]Arg, error) {
+	v := reflect.Indirect(reflect.ValueOf(in))
+	fields, err := argFields(v.Type())
+	if err != nil {
+		return nil, err
+	}
+	args := make([]Arg, 0, len(fields))
+	for _, f := range fields {
+		value := v.Field(f.index).Convert(f.codec.goType).Interface()
+		s, err := f.codec.marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("goupnp: SOAP arg %q has bad value: %v", f.name, err)
+		}
+		args = append(args, Arg{Name: f.name, Value: s})
+	}
+	return args, nil
+}
@@ -0,0 +1,326 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	controlXMLNamespace = "urn:schemas-upnp-org:control-1-0"
+
+	// maxRequestBytes limits the size of request bodies accepted by Server.
+	maxRequestBytes = 1 << 20
+)
+
+// UPnP error codes for SOAP faults, as described by section 3.2.2 "Action
+// Response" in
+// http://upnp.org/specs/arch/UPnP-arch-DeviceArchitecture-v1.1.pdf
+const (
+	ErrorCodeInvalidAction                = 401
+	ErrorCodeInvalidArgs                  = 402
+	ErrorCodeActionFailed                 = 501
+	ErrorCodeArgumentValueInvalid         = 600
+	ErrorCodeArgumentValueOutOfRange      = 601
+	ErrorCodeOptionalActionNotImplemented = 602
+	ErrorCodeOutOfMemory                  = 603
+	ErrorCodeHumanInterventionRequired    = 604
+	ErrorCodeStringArgumentTooLong        = 605
+)
+
+var errorDescriptions = map[int]string{
+	ErrorCodeInvalidAction:                "Invalid Action",
+	ErrorCodeInvalidArgs:                  "Invalid Args",
+	ErrorCodeActionFailed:                 "Action Failed",
+	ErrorCodeArgumentValueInvalid:         "Argument Value Invalid",
+	ErrorCodeArgumentValueOutOfRange:      "Argument Value Out of Range",
+	ErrorCodeOptionalActionNotImplemented: "Optional Action Not Implemented",
+	ErrorCodeOutOfMemory:                  "Out of Memory",
+	ErrorCodeHumanInterventionRequired:    "Human Intervention Required",
+	ErrorCodeStringArgumentTooLong:        "String Argument Too Long",
+}
+
+// UPnPError is an error that a Server reports to the client as a SOAP fault
+// with the given UPnP error code and description.
+type UPnPError struct {
+	Code        int
+	Description string
+}
+
+// NewUPnPError creates a UPnPError with the standard description for the
+// code, if there is one.
+func NewUPnPError(code int) *UPnPError {
+	return &UPnPError{Code: code, Description: errorDescriptions[code]}
+}
+
+func (err *UPnPError) Error() string {
+	return fmt.Sprintf("UPnP error %d: %s", err.Code, err.Description)
+}
+
+// ActionRequest is a SOAP action request received by a Server.
+type ActionRequest struct {
+	// HTTPRequest is the request that the action was received in. Its body
+	// has already been consumed.
+	HTTPRequest *http.Request
+	// ServiceType is the namespace of the action, e.g.
+	// "urn:schemas-upnp-org:service:WANIPConnection:1".
+	ServiceType string
+	// ActionName is the name of the action, e.g. "AddPortMapping".
+	ActionName string
+	// Args are the "in" arguments of the action, in the order received.
+	Args []Arg
+}
+
+// Context returns the context of the HTTP request.
+func (req *ActionRequest) Context() context.Context {
+	return req.HTTPRequest.Context()
+}
+
+// DecodeArgs decodes the "in" arguments into the struct pointed to by out. See
+// the package-level DecodeArgs for details. Decoding errors are returned as a
+// *UPnPError with ErrorCodeInvalidArgs.
+func (req *ActionRequest) DecodeArgs(out interface{}) error {
+	if err := DecodeArgs(req.Args, out); err != nil {
+		return &UPnPError{Code: ErrorCodeInvalidArgs, Description: err.Error()}
+	}
+	return nil
+}
+
+// ActionHandler handles SOAP actions received by a Server.
+type ActionHandler interface {
+	// ServeAction performs the action, and returns the "out" arguments. out may
+	// be nil if the action has no out arguments, a []Arg, or a struct (or
+	// pointer to struct) that is encoded with EncodeArgs. A returned
+	// *UPnPError is sent to the client as is, other errors are sent with
+	// ErrorCodeActionFailed.
+	ServeAction(req *ActionRequest) (out interface{}, err error)
+}
+
+// ActionHandlerFunc is a function-to-ActionHandler adapter.
+type ActionHandlerFunc func(req *ActionRequest) (interface{}, error)
+
+// ServeAction implements ActionHandler.
+func (f ActionHandlerFunc) ServeAction(req *ActionRequest) (interface{}, error) {
+	return f(req)
+}
+
+type serverActionKey struct {
+	serviceType string
+	actionName  string
+}
+
+var _ http.Handler = new(Server)
+
+// Server is an http.Handler that receives SOAP action requests, and dispatches
+// them to the ActionHandler registered for their service type and action name.
+type Server struct {
+	lock     sync.RWMutex
+	handlers map[serverActionKey]ActionHandler
+}
+
+// NewServer creates a Server with no registered actions.
+func NewServer() *Server {
+	return &Server{
+		handlers: make(map[serverActionKey]ActionHandler),
+	}
+}
+
+// Handle registers the handler for the given service type and action name,
+// replacing any existing handler.
+func (srv *Server) Handle(serviceType, actionName string, handler ActionHandler) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	srv.handlers[serverActionKey{serviceType, actionName}] = handler
+}
+
+// HandleFunc registers the handler function for the given service type and
+// action name, replacing any existing handler.
+func (srv *Server) HandleFunc(serviceType, actionName string, handler func(req *ActionRequest) (interface{}, error)) {
+	srv.Handle(serviceType, actionName, ActionHandlerFunc(handler))
+}
+
+// ServeHTTP implements http.Handler.
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, err := readActionRequest(r)
+	if err != nil {
+		writeFault(w, err)
+		return
+	}
+
+	srv.lock.RLock()
+	handler := srv.handlers[serverActionKey{req.ServiceType, req.ActionName}]
+	srv.lock.RUnlock()
+	if handler == nil {
+		writeFault(w, NewUPnPError(ErrorCodeInvalidAction))
+		return
+	}
+
+	out, err := handler.ServeAction(req)
+	if err != nil {
+		writeFault(w, err)
+		return
+	}
+	var outArgs []Arg
+	switch out := out.(type) {
+	case nil:
+	case []Arg:
+		outArgs = out
+	default:
+		if outArgs, err = EncodeArgs(out); err != nil {
+			writeFault(w, err)
+			return
+		}
+	}
+	writeResponse(w, req.ServiceType, req.ActionName+"Response", outArgs)
+}
+
+// readActionRequest parses the SOAPACTION header and envelope of a request.
+// Errors are returned as *UPnPError.
+func readActionRequest(r *http.Request) (*ActionRequest, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxRequestBytes+1))
+	if err != nil {
+		return nil, &UPnPError{Code: ErrorCodeActionFailed, Description: err.Error()}
+	}
+	if len(body) > maxRequestBytes {
+		return nil, &UPnPError{Code: ErrorCodeActionFailed, Description: "request too large"}
+	}
+
+	env := newSOAPEnvelope()
+	if err := xml.Unmarshal(body, env); err != nil {
+		return nil, &UPnPError{Code: ErrorCodeInvalidAction, Description: "malformed envelope: " + err.Error()}
+	}
+	actionName, args, err := decodeRawAction(env.Body.RawAction)
+	if err != nil {
+		return nil, &UPnPError{Code: ErrorCodeInvalidAction, Description: "malformed action: " + err.Error()}
+	}
+
+	if header := r.Header.Get("SOAPACTION"); header != "" {
+		headerNamespace, headerName, ok := parseSOAPAction(header)
+		if !ok || headerNamespace != actionName.Space || headerName != actionName.Local {
+			return nil, &UPnPError{
+				Code:        ErrorCodeInvalidAction,
+				Description: fmt.Sprintf("SOAPACTION %q does not match envelope", header),
+			}
+		}
+	}
+
+	return &ActionRequest{
+		HTTPRequest: r,
+		ServiceType: actionName.Space,
+		ActionName:  actionName.Local,
+		Args:        args,
+	}, nil
+}
+
+// parseSOAPAction splits a SOAPACTION header value of the form
+// `"namespace#name"` into its parts.
+func parseSOAPAction(header string) (namespace, name string, ok bool) {
+	header = strings.Trim(strings.TrimSpace(header), `"`)
+	i := strings.LastIndexByte(header, '#')
+	if i < 0 {
+		return "", "", false
+	}
+	return header[:i], header[i+1:], true
+}
+
+// decodeRawAction decodes the action element from inside a SOAP body.
+func decodeRawAction(raw []byte) (xml.Name, []Arg, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+	var start xml.StartElement
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return xml.Name{}, nil, err
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			start = se
+			break
+		}
+	}
+
+	var args []Arg
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return xml.Name{}, nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			var value struct {
+				Chardata string `xml:",chardata"`
+			}
+			if err := decoder.DecodeElement(&value, &tok); err != nil {
+				return xml.Name{}, nil, err
+			}
+			args = append(args, Arg{Name: tok.Name.Local, Value: value.Chardata})
+		case xml.EndElement:
+			return start.Name, args, nil
+		}
+	}
+}
+
+// writeResponse writes a SOAP response envelope with the given action and
+// arguments.
+func writeResponse(w http.ResponseWriter, actionNamespace, actionName string, args []Arg) {
+	buf := new(bytes.Buffer)
+	buf.WriteString(soapPrefix)
+	buf.WriteString(`<u:`)
+	xml.EscapeText(buf, []byte(actionName))
+	buf.WriteString(` xmlns:u="`)
+	xml.EscapeText(buf, []byte(actionNamespace))
+	buf.WriteString(`">`)
+	for _, arg := range args {
+		buf.WriteString(`<`)
+		xml.EscapeText(buf, []byte(arg.Name))
+		buf.WriteString(`>`)
+		buf.WriteString(escapeXMLText(arg.Value))
+		buf.WriteString(`</`)
+		xml.EscapeText(buf, []byte(arg.Name))
+		buf.WriteString(`>`)
+	}
+	buf.WriteString(`</u:`)
+	xml.EscapeText(buf, []byte(actionName))
+	buf.WriteString(`>`)
+	buf.WriteString(soapSuffix)
+	writeEnvelope(w, http.StatusOK, buf.Bytes())
+}
+
+// writeFault writes a SOAP fault envelope for the error.
+func writeFault(w http.ResponseWriter, err error) {
+	upnpErr, ok := err.(*UPnPError)
+	if !ok {
+		upnpErr = &UPnPError{Code: ErrorCodeActionFailed, Description: err.Error()}
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteString(soapPrefix)
+	buf.WriteString(`<s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail>`)
+	buf.WriteString(`<UPnPError xmlns="` + controlXMLNamespace + `"><errorCode>`)
+	buf.WriteString(strconv.Itoa(upnpErr.Code))
+	buf.WriteString(`</errorCode><errorDescription>`)
+	xml.EscapeText(buf, []byte(upnpErr.Description))
+	buf.WriteString(`</errorDescription></UPnPError></detail></s:Fault>`)
+	buf.WriteString(soapSuffix)
+	writeEnvelope(w, http.StatusInternalServerError, buf.Bytes())
+}
+
+func writeEnvelope(w http.ResponseWriter, status int, body []byte) {
+	header := w.Header()
+	header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	header["EXT"] = []string{""}
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,186 @@
+package soap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const testServiceType = "urn:schemas-upnp-org:service:Test:1"
+
+type addPortMappingIn struct {
+	NewExternalPort uint16
+	NewProtocol     string
+	NewEnabled      bool
+	NewLeaseTime    uint32 `soap:"NewLeaseDuration"`
+}
+
+type getStatusOut struct {
+	NewStatus string
+	NewUptime uint32
+}
+
+func newTestServer(t *testing.T) *SOAPClient {
+	srv := NewServer()
+	srv.HandleFunc(testServiceType, "AddPortMapping", func(req *ActionRequest) (interface{}, error) {
+		var in addPortMappingIn
+		if err := req.DecodeArgs(&in); err != nil {
+			return nil, err
+		}
+		want := addPortMappingIn{1234, "TCP", true, 3600}
+		if in != want {
+			t.Errorf("got in args %+v, want %+v", in, want)
+		}
+		if in.NewExternalPort == 1234 {
+			return nil, nil
+		}
+		return nil, &UPnPError{Code: 718, Description: "ConflictInMappingEntry"}
+	})
+	srv.HandleFunc(testServiceType, "GetStatus", func(req *ActionRequest) (interface{}, error) {
+		return &getStatusOut{NewStatus: "Connected & up", NewUptime: 42}, nil
+	})
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSOAPClient(*u)
+}
+
+func TestServerAction(t *testing.T) {
+	t.Parallel()
+	client := newTestServer(t)
+
+	in := struct {
+		NewExternalPort  string
+		NewProtocol      string
+		NewEnabled       string
+		NewLeaseDuration string
+	}{"1234", "TCP", "1", "3600"}
+	if err := client.PerformAction(testServiceType, "AddPortMapping", &in, nil); err != nil {
+		t.Errorf("AddPortMapping: got error %v, want success", err)
+	}
+
+	var out struct {
+		NewStatus string
+		NewUptime string
+	}
+	if err := client.PerformAction(testServiceType, "GetStatus", nil, &out); err != nil {
+		t.Fatalf("GetStatus: got error %v, want success", err)
+	}
+	if out.NewStatus != "Connected & up" || out.NewUptime != "42" {
+		t.Errorf("GetStatus: got %+v", out)
+	}
+}
+
+func TestClientServerTypedArgs(t *testing.T) {
+	t.Parallel()
+	client := newTestServer(t)
+
+	// The same structs as the server uses, including the name-and-type tag.
+	in := addPortMappingIn{1234, "TCP", true, 3600}
+	if err := client.PerformAction(testServiceType, "AddPortMapping", &in, nil); err != nil {
+		t.Errorf("AddPortMapping: got error %v, want success", err)
+	}
+
+	var out getStatusOut
+	if err := client.PerformAction(testServiceType, "GetStatus", nil, &out); err != nil {
+		t.Fatalf("GetStatus: got error %v, want success", err)
+	}
+	if want := (getStatusOut{NewStatus: "Connected & up", NewUptime: 42}); out != want {
+		t.Errorf("GetStatus: got %+v, want %+v", out, want)
+	}
+
+	// Arguments missing from responses leave fields unchanged.
+	outExtra := struct {
+		NewStatus  string `soap:",string"`
+		NewMissing int32
+	}{NewMissing: 7}
+	if err := client.PerformAction(testServiceType, "GetStatus", nil, &outExtra); err != nil {
+		t.Fatalf("GetStatus: got error %v, want success", err)
+	}
+	if outExtra.NewStatus != "Connected & up" || outExtra.NewMissing != 7 {
+		t.Errorf("GetStatus: got %+v", outExtra)
+	}
+}
+
+func TestServerFaults(t *testing.T) {
+	t.Parallel()
+	client := newTestServer(t)
+
+	tests := []struct {
+		name       string
+		actionName string
+		in         interface{}
+		wantCode   int
+	}{
+		{"unknown action", "Unknown", nil, ErrorCodeInvalidAction},
+		{"missing args", "AddPortMapping", nil, ErrorCodeInvalidArgs},
+		{"bad arg value", "AddPortMapping", &struct {
+			NewExternalPort  string
+			NewProtocol      string
+			NewEnabled       string
+			NewLeaseDuration string
+		}{"99999", "TCP", "1", "3600"}, ErrorCodeInvalidArgs},
+	}
+	for _, test := range tests {
+		err := client.PerformAction(testServiceType, test.actionName, test.in, nil)
+		fault, ok := err.(*SOAPFaultError)
+		if !ok {
+			t.Errorf("%s: got error %v, want *SOAPFaultError", test.name, err)
+			continue
+		}
+		if got := fault.Detail.UPnPError.Errorcode; got != test.wantCode {
+			t.Errorf("%s: got error code %d, want %d", test.name, got, test.wantCode)
+		}
+	}
+}
+
+func TestServerRejectsGet(t *testing.T) {
+	t.Parallel()
+	rec := httptest.NewRecorder()
+	NewServer().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/control", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got HTTP %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestArgsRoundTrip(t *testing.T) {
+	t.Parallel()
+	type protocol string
+	type allTypes struct {
+		A uint8
+		B int64
+		C float64 `soap:",fixed.14.4"`
+		D rune    `soap:"Char,char"`
+		E []byte  `soap:",bin.hex"`
+		F protocol
+		G TimeOfDay
+	}
+	in := allTypes{A: 1, B: -2, C: 3.5, D: 'x', E: []byte{0xab}, F: "UDP", G: TimeOfDay{FromMidnight: 3661e9}}
+	args, err := EncodeArgs(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantArgs := []Arg{
+		{"A", "1"}, {"B", "-2"}, {"C", "3.5000"}, {"Char", "x"}, {"E", "ab"}, {"F", "UDP"}, {"G", "01:01:01"},
+	}
+	if len(args) != len(wantArgs) {
+		t.Fatalf("got args %v, want %v", args, wantArgs)
+	}
+	for i := range args {
+		if args[i] != wantArgs[i] {
+			t.Errorf("arg %d: got %v, want %v", i, args[i], wantArgs[i])
+		}
+	}
+	var out allTypes
+	if err := DecodeArgs(args, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.A != in.A || out.B != in.B || out.C != in.C || out.D != in.D ||
+		string(out.E) != string(in.E) || out.F != in.F || out.G != in.G {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"net/url"
 	"reflect"
 	"regexp"
+
+	"github.com/huin/goupnp/controlpoint"
 )
 
 const (
@@ -23,6 +25,9 @@ const (
 type SOAPClient struct {
 	EndpointURL url.URL
 	HTTPClient  http.Client
+	// Identity identifies the control point in requests. If nil, only a
+	// User-Agent with controlpoint.DefaultProduct is sent.
+	Identity *controlpoint.Identity
 }
 
 func NewSOAPClient(endpointURL url.URL) *SOAPClient {
@@ -31,9 +36,12 @@ func NewSOAPClient(endpointURL url.URL) *SOAPClient {
 	}
 }
 
-// PerformSOAPAction makes a SOAP request, with the given action.
-// inAction and outAction must both be pointers to structs with string fields
-// only.
+// PerformActionCtx makes a SOAP request, with the given action. inAction and
+// outAction must both be pointers to structs, whose fields are encoded and
+// decoded as for EncodeArgs and DecodeArgs, so that the same structs can be
+// used with a Server. Fields are typically strings holding values from the
+// Marshal* functions, but may be of other types, with the SOAP type given in
+// the struct tag where the Go type does not determine it.
 func (client *SOAPClient) PerformActionCtx(ctx context.Context, actionNamespace, actionName string, inAction interface{}, outAction interface{}) error {
 	requestBytes, err := encodeRequestAction(actionNamespace, actionName, inAction)
 	if err != nil {
@@ -51,6 +59,7 @@ func (client *SOAPClient) PerformActionCtx(ctx context.Context, actionNamespace,
 		// Set ContentLength to avoid chunked encoding - some servers might not support it.
 		ContentLength: int64(len(requestBytes)),
 	}
+	client.Identity.SetRequestHeaders(req.Header)
 	req = req.WithContext(ctx)
 	response, err := client.HTTPClient.Do(req)
 	if err != nil {
@@ -74,7 +83,7 @@ func (client *SOAPClient) PerformActionCtx(ctx context.Context, actionNamespace,
 	}
 
 	if outAction != nil {
-		if err := xml.Unmarshal(responseEnv.Body.RawAction, outAction); err != nil {
+		if err := decodeResponseArgs(responseEnv.Body.RawAction, outAction); err != nil {
 			return fmt.Errorf("goupnp: error unmarshalling out action: %v, %v", err, responseEnv.Body.RawAction)
 		}
 	}
@@ -120,42 +129,41 @@ func encodeRequestAction(actionNamespace, actionName string, inAction interface{
 	return requestBuf.Bytes(), nil
 }
 
+// encodeRequestArgs writes the fields of inAction as SOAP arguments, using
+// the struct tag format of EncodeArgs.
 func encodeRequestArgs(w *bytes.Buffer, inAction interface{}) error {
-	in := reflect.Indirect(reflect.ValueOf(inAction))
-	if in.Kind() != reflect.Struct {
-		return fmt.Errorf("goupnp: SOAP inAction is not a struct but of type %v", in.Type())
+	args, err := EncodeArgs(inAction)
+	if err != nil {
+		return err
 	}
-	enc := xml.NewEncoder(w)
-	nFields := in.NumField()
-	inType := in.Type()
-	for i := 0; i < nFields; i++ {
-		field := inType.Field(i)
-		argName := field.Name
-		if nameOverride := field.Tag.Get("soap"); nameOverride != "" {
-			argName = nameOverride
-		}
-		value := in.Field(i)
-		if value.Kind() != reflect.String {
-			return fmt.Errorf("goupnp: SOAP arg %q is not of type string, but of type %v", argName, value.Type())
-		}
-		elem := xml.StartElement{Name: xml.Name{Space: "", Local: argName}, Attr: nil}
-		if err := enc.EncodeToken(elem); err != nil {
-			return fmt.Errorf("goupnp: error encoding start element for SOAP arg %q: %v", argName, err)
-		}
-		if err := enc.Flush(); err != nil {
-			return fmt.Errorf("goupnp: error flushing start element for SOAP arg %q: %v", argName, err)
-		}
-		if _, err := w.Write([]byte(escapeXMLText(value.Interface().(string)))); err != nil {
-			return fmt.Errorf("goupnp: error writing value for SOAP arg %q: %v", argName, err)
-		}
-		if err := enc.EncodeToken(elem.End()); err != nil {
-			return fmt.Errorf("goupnp: error encoding end element for SOAP arg %q: %v", argName, err)
-		}
+	for _, arg := range args {
+		w.WriteString(`<`)
+		xml.EscapeText(w, []byte(arg.Name))
+		w.WriteString(`>`)
+		w.WriteString(escapeXMLText(arg.Value))
+		w.WriteString(`</`)
+		xml.EscapeText(w, []byte(arg.Name))
+		w.WriteString(`>`)
 	}
-	enc.Flush()
 	return nil
 }
 
+// decodeResponseArgs sets the fields of outAction from the SOAP arguments in
+// the raw response action. Structs with only untagged string fields are
+// decoded with encoding/xml, so that xml struct tags are honoured as before.
+// Otherwise the struct tag format of DecodeArgs is used, except that fields
+// without an argument in the response are left unchanged.
+func decodeResponseArgs(raw []byte, outAction interface{}) error {
+	if !usesArgTags(reflect.TypeOf(outAction)) {
+		return xml.Unmarshal(raw, outAction)
+	}
+	_, args, err := decodeRawAction(raw)
+	if err != nil {
+		return err
+	}
+	return decodeArgs(args, outAction, false)
+}
+
 var xmlCharRx = regexp.MustCompile("[<>&]")
 
 // escapeXMLText is used by generated code to escape text in XML, but only
@@ -9,6 +9,8 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/huin/goupnp/controlpoint"
 )
 
 type capturingRoundTripper struct {
@@ -49,6 +51,7 @@ func TestActionInputs(t *testing.T) {
 		HTTPClient: http.Client{
 			Transport: rt,
 		},
+		Identity: &controlpoint.Identity{FriendlyName: "Test", UUID: "uuid:1"},
 	}
 
 	type In struct {
@@ -83,6 +86,13 @@ func TestActionInputs(t *testing.T) {
 		t.Errorf("Bad request body\nwant: %q\n got: %q", wantBody, gotBody)
 	}
 
+	if got, want := rt.capturedReq.Header.Get("User-Agent"), client.Identity.UserAgent(); got != want {
+		t.Errorf("Bad User-Agent\nwant: %q\n got: %q", want, got)
+	}
+	if got := rt.capturedReq.Header["CPFN.UPNP.ORG"]; len(got) != 1 || got[0] != "Test" {
+		t.Errorf("Bad CPFN.UPNP.ORG\nwant: %q\n got: %q", "Test", got)
+	}
+
 	wantOut := Out{"valueA", "valueB"}
 	if !reflect.DeepEqual(wantOut, gotOut) {
 		t.Errorf("Bad output\nwant: %+v\n got: %+v", wantOut, gotOut)
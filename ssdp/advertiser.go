@@ -0,0 +1,442 @@
+package ssdp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/huin/goupnp/httpu"
+	"github.com/huin/goupnp/urn"
+)
+
+const (
+	// DefaultMaxAge is the CACHE-CONTROL max-age used by an Advertiser if none
+	// is specified.
+	DefaultMaxAge = 1800 * time.Second
+	// DefaultMulticastTTL is the multicast TTL used by an Advertiser if none
+	// is specified, as per UDA 1.1.
+	DefaultMulticastTTL = 2
+	// maxMX is the largest MX value honoured when delaying search responses,
+	// as per UDA 1.1.
+	maxMX = 5
+)
+
+// ErrAdvertiserClosed is returned by Advertiser.ListenAndServe if Close was
+// called before it started serving.
+var ErrAdvertiserClosed = errors.New("ssdp: advertiser closed")
+
+// DefaultServer is the SERVER header value used by an Advertiser if none is
+// specified.
+var DefaultServer = runtime.GOOS + "/1.0 UPnP/1.1 goupnp/1.0"
+
+// Advertisement is a single notification type and unique service name pair
+// that is advertised by an Advertiser.
+type Advertisement struct {
+	// Notification Type, e.g. "upnp:rootdevice" or
+	// "urn:schemas-upnp-org:service:WANIPConnection:1".
+	NT string
+	// Unique Service Name, e.g. "uuid:device-UUID::upnp:rootdevice".
+	USN string
+}
+
+var _ httpu.Handler = new(Advertiser)
+
+// Advertiser announces a root device and its embedded devices and services
+// with SSDP, and answers searches for them.
+//
+// NOTE: the interface for this is experimental and may change, or go away
+// entirely.
+type Advertiser struct {
+	// Location is the URL of the root device description.
+	Location string
+	// Advertisements are the NT/USN pairs to announce.
+	Advertisements []Advertisement
+	// Server is the SERVER header value, DefaultServer if empty.
+	Server string
+	// MaxAge is the duration that announcements are valid for, DefaultMaxAge
+	// if zero. Announcements are repeated well before this expires.
+	MaxAge time.Duration
+	// BootID is the BOOTID.UPNP.ORG value. If zero, the time that serving
+	// starts is used. It must not be changed while serving, use Update
+	// instead.
+	BootID int32
+	// ConfigID is the CONFIGID.UPNP.ORG value.
+	ConfigID int32
+	// Interface is the network interface to multicast on, nil for the default
+	// multicast interface.
+	Interface *net.Interface
+	// MulticastTTL is the TTL of the multicast announcements,
+	// DefaultMulticastTTL if zero.
+	MulticastTTL int
+
+	lock       sync.Mutex
+	listenConn net.PacketConn
+	sendConn   net.PacketConn
+	done       chan struct{}
+	wg         sync.WaitGroup
+	closing    bool
+	// notifyAddr overrides the destination of announcements in tests.
+	notifyAddr string
+}
+
+// ListenAndServe announces the advertisements, and answers search requests
+// until Close is called. It returns ErrAdvertiserClosed without serving if
+// Close has already been called.
+func (adv *Advertiser) ListenAndServe() error {
+	adv.lock.Lock()
+	closing := adv.closing
+	adv.lock.Unlock()
+	if closing {
+		return ErrAdvertiserClosed
+	}
+
+	addr, err := net.ResolveUDPAddr("udp4", ssdpUDP4Addr)
+	if err != nil {
+		return err
+	}
+	listenConn, err := net.ListenMulticastUDP("udp4", adv.Interface, addr)
+	if err != nil {
+		return err
+	}
+	sendConn, err := adv.listenSend()
+	if err != nil {
+		listenConn.Close()
+		return err
+	}
+
+	adv.lock.Lock()
+	if adv.closing {
+		adv.lock.Unlock()
+		listenConn.Close()
+		sendConn.Close()
+		return ErrAdvertiserClosed
+	}
+	if adv.done != nil {
+		adv.lock.Unlock()
+		listenConn.Close()
+		sendConn.Close()
+		return errors.New("ssdp: advertiser is already serving")
+	}
+	if adv.BootID == 0 {
+		adv.BootID = int32(time.Now().Unix() & 0x7fffffff)
+	}
+	adv.listenConn = listenConn
+	adv.sendConn = sendConn
+	adv.done = make(chan struct{})
+	adv.lock.Unlock()
+
+	adv.wg.Add(1)
+	go adv.aliveLoop()
+
+	srv := &httpu.Server{
+		Addr:      ssdpUDP4Addr,
+		Multicast: true,
+		Interface: adv.Interface,
+		Handler:   adv,
+	}
+	err = srv.Serve(listenConn)
+
+	adv.lock.Lock()
+	defer adv.lock.Unlock()
+	if adv.closing {
+		return nil
+	}
+	return err
+}
+
+// listenSend creates the socket that announcements and search responses are
+// sent from.
+func (adv *Advertiser) listenSend() (net.PacketConn, error) {
+	laddr := &net.UDPAddr{}
+	if adv.Interface != nil {
+		// Bind to an address on the interface, so that multicast messages are
+		// sent from it.
+		addrs, err := adv.Interface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+				laddr.IP = ipNet.IP
+				break
+			}
+		}
+	}
+	conn, err := net.ListenUDP("udp4", laddr)
+	if err != nil {
+		return nil, err
+	}
+	if err := setMulticastTTL(conn, adv.multicastTTL()); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ssdp: setting multicast TTL: %w", err)
+	}
+	return conn, nil
+}
+
+// Close sends ssdp:byebye for all advertisements, and stops serving. If
+// ListenAndServe has not started serving yet, it will not.
+func (adv *Advertiser) Close() error {
+	adv.lock.Lock()
+	if adv.closing {
+		adv.lock.Unlock()
+		return nil
+	}
+	adv.closing = true
+	if adv.done == nil {
+		adv.lock.Unlock()
+		return nil
+	}
+	close(adv.done)
+	adv.lock.Unlock()
+
+	adv.wg.Wait()
+	err := adv.sendNotifies(ntsByebye, 0)
+	adv.listenConn.Close()
+	adv.sendConn.Close()
+	return err
+}
+
+// aliveLoop repeats ssdp:alive announcements at a random interval of between
+// a quarter and a half of the max age.
+func (adv *Advertiser) aliveLoop() {
+	defer adv.wg.Done()
+	maxAge := adv.maxAge()
+	for {
+		if err := adv.sendNotifies(ntsAlive, 0); err != nil {
+			log.Printf("ssdp: error sending alive announcement: %v", err)
+		}
+		interval := maxAge/4 + time.Duration(rand.Int63n(int64(maxAge/4)+1))
+		timer := time.NewTimer(interval)
+		select {
+		case <-adv.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Update announces that the BOOTID.UPNP.ORG value changes to nextBootID, for
+// example when the host's network interfaces change, by sending ssdp:update
+// for all advertisements. It then announces the advertisements again with the
+// new value.
+func (adv *Advertiser) Update(nextBootID int32) error {
+	adv.lock.Lock()
+	if adv.done == nil || adv.closing {
+		adv.lock.Unlock()
+		return errors.New("ssdp: advertiser is not serving")
+	}
+	adv.wg.Add(1)
+	adv.lock.Unlock()
+	defer adv.wg.Done()
+
+	if err := adv.sendNotifies(ntsUpdate, nextBootID); err != nil {
+		return err
+	}
+	adv.lock.Lock()
+	adv.BootID = nextBootID
+	adv.lock.Unlock()
+	return adv.sendNotifies(ntsAlive, 0)
+}
+
+func (adv *Advertiser) bootID() int32 {
+	adv.lock.Lock()
+	defer adv.lock.Unlock()
+	return adv.BootID
+}
+
+func (adv *Advertiser) multicastTTL() int {
+	if adv.MulticastTTL > 0 {
+		return adv.MulticastTTL
+	}
+	return DefaultMulticastTTL
+}
+
+func (adv *Advertiser) maxAge() time.Duration {
+	if adv.MaxAge > 0 {
+		return adv.MaxAge
+	}
+	return DefaultMaxAge
+}
+
+func (adv *Advertiser) server() string {
+	if adv.Server != "" {
+		return adv.Server
+	}
+	return DefaultServer
+}
+
+// sendNotifies multicasts a NOTIFY message with the given NTS value for each
+// advertisement. nextBootID is only used for ssdp:update.
+func (adv *Advertiser) sendNotifies(nts string, nextBootID int32) error {
+	dest := ssdpUDP4Addr
+	if adv.notifyAddr != "" {
+		dest = adv.notifyAddr
+	}
+	destAddr, err := net.ResolveUDPAddr("udp4", dest)
+	if err != nil {
+		return err
+	}
+	bootID := adv.bootID()
+	for _, ad := range adv.Advertisements {
+		header := http.Header{
+			"HOST":              []string{ssdpUDP4Addr},
+			"NT":                []string{ad.NT},
+			"NTS":               []string{nts},
+			"USN":               []string{ad.USN},
+			"BOOTID.UPNP.ORG":   []string{strconv.FormatInt(int64(bootID), 10)},
+			"CONFIGID.UPNP.ORG": []string{strconv.FormatInt(int64(adv.ConfigID), 10)},
+		}
+		switch nts {
+		case ntsAlive:
+			header["CACHE-CONTROL"] = []string{formatMaxAge(adv.maxAge())}
+			header["LOCATION"] = []string{adv.Location}
+			header["SERVER"] = []string{adv.server()}
+		case ntsUpdate:
+			header["LOCATION"] = []string{adv.Location}
+			header["NEXTBOOTID.UPNP.ORG"] = []string{strconv.FormatInt(int64(nextBootID), 10)}
+		}
+		if err := adv.send(methodNotify+" * HTTP/1.1", header, destAddr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeMessage implements httpu.Handler, and responds to SSDP M-SEARCH
+// requests that match any of the advertisements. Responses are sent after the
+// delay requested by MX, without holding up the handler.
+func (adv *Advertiser) ServeMessage(r *http.Request) {
+	if r.Method != methodSearch {
+		return
+	}
+	if r.Header.Get("MAN") != ssdpDiscover {
+		return
+	}
+	st := r.Header.Get("ST")
+	if st == "" {
+		return
+	}
+	peerAddr, err := net.ResolveUDPAddr("udp4", r.RemoteAddr)
+	if err != nil {
+		log.Printf("ssdp: bad search request address %q: %v", r.RemoteAddr, err)
+		return
+	}
+
+	var delay time.Duration
+	if mxStr := r.Header.Get("MX"); mxStr != "" {
+		mx, err := strconv.Atoi(mxStr)
+		if err != nil || mx < 1 {
+			// Multicast searches require a valid MX.
+			return
+		}
+		if mx > maxMX {
+			mx = maxMX
+		}
+		delay = time.Duration(rand.Int63n(int64(time.Duration(mx) * time.Second)))
+	}
+
+	var matches []Advertisement
+	for _, ad := range adv.Advertisements {
+		if m, ok := searchResponse(st, ad); ok {
+			matches = append(matches, m)
+		}
+	}
+	if len(matches) == 0 {
+		return
+	}
+
+	adv.lock.Lock()
+	if adv.closing {
+		adv.lock.Unlock()
+		return
+	}
+	adv.wg.Add(1)
+	adv.lock.Unlock()
+	go adv.respond(peerAddr, matches, delay)
+}
+
+// respond sends the search responses for the matching advertisements to
+// peerAddr after delay, unless the advertiser is closed first.
+func (adv *Advertiser) respond(peerAddr *net.UDPAddr, matches []Advertisement, delay time.Duration) {
+	defer adv.wg.Done()
+
+	timer := time.NewTimer(delay)
+	select {
+	case <-adv.done:
+		timer.Stop()
+		return
+	case <-timer.C:
+	}
+	bootID := adv.bootID()
+	for _, m := range matches {
+		header := http.Header{
+			"CACHE-CONTROL":     []string{formatMaxAge(adv.maxAge())},
+			"DATE":              []string{time.Now().UTC().Format(http.TimeFormat)},
+			"EXT":               []string{""},
+			"LOCATION":          []string{adv.Location},
+			"SERVER":            []string{adv.server()},
+			"ST":                []string{m.NT},
+			"USN":               []string{m.USN},
+			"BOOTID.UPNP.ORG":   []string{strconv.FormatInt(int64(bootID), 10)},
+			"CONFIGID.UPNP.ORG": []string{strconv.FormatInt(int64(adv.ConfigID), 10)},
+		}
+		if err := adv.send("HTTP/1.1 200 OK", header, peerAddr); err != nil {
+			log.Printf("ssdp: error responding to search from %s: %v", peerAddr, err)
+			return
+		}
+	}
+}
+
+// send writes a single HTTPU message.
+func (adv *Advertiser) send(startLine string, header http.Header, dest net.Addr) error {
+	var buf bytes.Buffer
+	buf.WriteString(startLine)
+	buf.WriteString("\r\n")
+	if err := header.Write(&buf); err != nil {
+		return err
+	}
+	buf.WriteString("\r\n")
+	if n, err := adv.sendConn.WriteTo(buf.Bytes(), dest); err != nil {
+		return err
+	} else if n < buf.Len() {
+		return fmt.Errorf("ssdp: wrote %d bytes rather than full %d in message", n, buf.Len())
+	}
+	return nil
+}
+
+func formatMaxAge(d time.Duration) string {
+	return "max-age=" + strconv.FormatInt(int64(d/time.Second), 10)
+}
+
+// searchResponse reports whether the advertisement matches the search target
+// st, and if so the ST and USN to respond with.
+func searchResponse(st string, ad Advertisement) (Advertisement, bool) {
+	if st == SSDPAll || st == ad.NT {
+		return ad, true
+	}
+	// Devices and services must respond to searches for earlier versions of
+	// their type, using the version from the search.
+	want, err := urn.Parse(st)
+	if err != nil {
+		return Advertisement{}, false
+	}
+	have, err := urn.Parse(ad.NT)
+	if err != nil || !have.Satisfies(want) {
+		return Advertisement{}, false
+	}
+	usn := ad.USN
+	if strings.HasSuffix(usn, "::"+ad.NT) {
+		usn = usn[:len(usn)-len(ad.NT)] + st
+	}
+	return Advertisement{NT: st, USN: usn}, true
+}
@@ -0,0 +1,329 @@
+package ssdp
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const (
+	testUDN      = "uuid:00000000-0000-0000-0000-000000000001"
+	testLocation = "http://192.0.2.1:1234/root.xml"
+)
+
+// newTestAdvertiser returns an Advertiser that sends its announcements to the
+// returned connection instead of multicasting them.
+func newTestAdvertiser(t *testing.T) (*Advertiser, *net.UDPConn) {
+	t.Helper()
+	recvConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { recvConn.Close() })
+	sendConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sendConn.Close() })
+
+	adv := &Advertiser{
+		Location: testLocation,
+		Advertisements: []Advertisement{
+			{NT: UPNPRootDevice, USN: testUDN + "::" + UPNPRootDevice},
+			{NT: testUDN, USN: testUDN},
+		},
+		BootID:     10,
+		ConfigID:   20,
+		sendConn:   sendConn,
+		done:       make(chan struct{}),
+		notifyAddr: recvConn.LocalAddr().String(),
+	}
+	return adv, recvConn
+}
+
+// readNotify reads the next NOTIFY message from conn.
+func readNotify(t *testing.T, conn *net.UDPConn, timeout time.Duration) *http.Request {
+	t.Helper()
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 2048)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("reading announcement: %v", err)
+	}
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(buf[:n])))
+	if err != nil {
+		t.Fatalf("parsing announcement %q: %v", buf[:n], err)
+	}
+	if req.Method != methodNotify {
+		t.Fatalf("got method %q, want %q", req.Method, methodNotify)
+	}
+	return req
+}
+
+func checkHeader(t *testing.T, req *http.Request, want map[string]string) {
+	t.Helper()
+	for name, value := range want {
+		got := req.Header.Get(name)
+		if name == "HOST" {
+			// http.ReadRequest moves the HOST header to Request.Host.
+			got = req.Host
+		}
+		if got != value {
+			t.Errorf("%s %s: got %s %q, want %q",
+				req.Header.Get("NTS"), req.Header.Get("NT"), name, got, value)
+		}
+	}
+	for _, name := range []string{"CACHE-CONTROL", "LOCATION", "SERVER", "NEXTBOOTID.UPNP.ORG"} {
+		if _, ok := want[name]; !ok && req.Header.Get(name) != "" {
+			t.Errorf("%s %s: got unexpected %s %q",
+				req.Header.Get("NTS"), req.Header.Get("NT"), name, req.Header.Get(name))
+		}
+	}
+}
+
+func TestAdvertiserNotifies(t *testing.T) {
+	adv, recvConn := newTestAdvertiser(t)
+	adv.MaxAge = 100 * time.Second
+	adv.Server = "test/1.0 UPnP/1.1 test/1.0"
+
+	if err := adv.sendNotifies(ntsAlive, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, ad := range adv.Advertisements {
+		checkHeader(t, readNotify(t, recvConn, time.Second), map[string]string{
+			"HOST":              ssdpUDP4Addr,
+			"NT":                ad.NT,
+			"NTS":               ntsAlive,
+			"USN":               ad.USN,
+			"CACHE-CONTROL":     "max-age=100",
+			"LOCATION":          testLocation,
+			"SERVER":            "test/1.0 UPnP/1.1 test/1.0",
+			"BOOTID.UPNP.ORG":   "10",
+			"CONFIGID.UPNP.ORG": "20",
+		})
+	}
+
+	if err := adv.sendNotifies(ntsByebye, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, ad := range adv.Advertisements {
+		checkHeader(t, readNotify(t, recvConn, time.Second), map[string]string{
+			"HOST":              ssdpUDP4Addr,
+			"NT":                ad.NT,
+			"NTS":               ntsByebye,
+			"USN":               ad.USN,
+			"BOOTID.UPNP.ORG":   "10",
+			"CONFIGID.UPNP.ORG": "20",
+		})
+	}
+}
+
+func TestAdvertiserUpdate(t *testing.T) {
+	adv, recvConn := newTestAdvertiser(t)
+
+	if err := adv.Update(11); err != nil {
+		t.Fatal(err)
+	}
+	for _, ad := range adv.Advertisements {
+		checkHeader(t, readNotify(t, recvConn, time.Second), map[string]string{
+			"HOST":                ssdpUDP4Addr,
+			"NT":                  ad.NT,
+			"NTS":                 ntsUpdate,
+			"USN":                 ad.USN,
+			"LOCATION":            testLocation,
+			"BOOTID.UPNP.ORG":     "10",
+			"NEXTBOOTID.UPNP.ORG": "11",
+			"CONFIGID.UPNP.ORG":   "20",
+		})
+	}
+	// The advertisements are then announced with the new BOOTID.
+	for _, ad := range adv.Advertisements {
+		req := readNotify(t, recvConn, time.Second)
+		if got := req.Header.Get("NTS"); got != ntsAlive {
+			t.Fatalf("%s: got NTS %q, want %q", ad.NT, got, ntsAlive)
+		}
+		if got := req.Header.Get("BOOTID.UPNP.ORG"); got != "11" {
+			t.Errorf("%s: got BOOTID %q, want %q", ad.NT, got, "11")
+		}
+	}
+	if got := adv.bootID(); got != 11 {
+		t.Errorf("got BootID %d, want 11", got)
+	}
+
+	adv.closing = true
+	if err := adv.Update(12); err == nil {
+		t.Error("Update succeeded after Close, want error")
+	}
+}
+
+func TestAdvertiserAliveInterval(t *testing.T) {
+	const maxAge = 400 * time.Millisecond
+	// Allow for scheduling delays.
+	const slack = 50 * time.Millisecond
+
+	adv, recvConn := newTestAdvertiser(t)
+	adv.Advertisements = adv.Advertisements[:1]
+	adv.MaxAge = maxAge
+
+	adv.wg.Add(1)
+	go adv.aliveLoop()
+	defer func() {
+		close(adv.done)
+		adv.wg.Wait()
+	}()
+
+	// The first announcement is sent immediately.
+	readNotify(t, recvConn, time.Second)
+	last := time.Now()
+	for i := 0; i < 4; i++ {
+		req := readNotify(t, recvConn, maxAge)
+		now := time.Now()
+		interval := now.Sub(last)
+		last = now
+		if got := req.Header.Get("NTS"); got != ntsAlive {
+			t.Errorf("got NTS %q, want %q", got, ntsAlive)
+		}
+		if interval < maxAge/4-slack || interval > maxAge/2+slack {
+			t.Errorf("got interval %v, want between %v and %v", interval, maxAge/4, maxAge/2)
+		}
+	}
+}
+
+func TestAdvertiserMulticastTTL(t *testing.T) {
+	tests := []struct {
+		ttl  int
+		want int
+	}{
+		{ttl: 0, want: DefaultMulticastTTL},
+		{ttl: 4, want: 4},
+	}
+	for _, test := range tests {
+		adv := &Advertiser{MulticastTTL: test.ttl}
+		conn, err := adv.listenSend()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok, err := multicastTTL(conn.(*net.UDPConn))
+		conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Skip("multicast TTL cannot be read on this platform")
+		}
+		if got != test.want {
+			t.Errorf("MulticastTTL %d: got TTL %d, want %d", test.ttl, got, test.want)
+		}
+	}
+}
+
+func TestSearchResponse(t *testing.T) {
+	const udn = "uuid:00000000-0000-0000-0000-000000000001"
+	const srvType = "urn:schemas-upnp-org:service:WANIPConnection:2"
+	ad := Advertisement{NT: srvType, USN: udn + "::" + srvType}
+
+	tests := []struct {
+		st     string
+		want   Advertisement
+		wantOk bool
+	}{
+		{st: SSDPAll, want: ad, wantOk: true},
+		{st: srvType, want: ad, wantOk: true},
+		{
+			st: "urn:schemas-upnp-org:service:WANIPConnection:1",
+			want: Advertisement{
+				NT:  "urn:schemas-upnp-org:service:WANIPConnection:1",
+				USN: udn + "::urn:schemas-upnp-org:service:WANIPConnection:1",
+			},
+			wantOk: true,
+		},
+		{st: "urn:schemas-upnp-org:service:WANIPConnection:3"},
+		{st: "urn:schemas-upnp-org:service:WANPPPConnection:1"},
+		{st: UPNPRootDevice},
+		{st: udn},
+	}
+	for _, test := range tests {
+		got, ok := searchResponse(test.st, ad)
+		if ok != test.wantOk || got != test.want {
+			t.Errorf("searchResponse(%q) = %+v, %t; want %+v, %t",
+				test.st, got, ok, test.want, test.wantOk)
+		}
+	}
+}
+
+func TestAdvertiserCloseBeforeServe(t *testing.T) {
+	adv := &Advertiser{Location: testLocation}
+	if err := adv.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := adv.ListenAndServe(); err != ErrAdvertiserClosed {
+		t.Errorf("ListenAndServe after Close: got %v, want %v", err, ErrAdvertiserClosed)
+	}
+	if err := adv.Update(1); err == nil {
+		t.Error("Update after Close: got success, want error")
+	}
+}
+
+func TestAdvertiserSearchResponse(t *testing.T) {
+	adv, recvConn := newTestAdvertiser(t)
+	adv.MaxAge = 100 * time.Second
+
+	req := &http.Request{
+		Method:     methodSearch,
+		RemoteAddr: recvConn.LocalAddr().String(),
+		Header: http.Header{
+			"Man": []string{ssdpDiscover},
+			"Mx":  []string{"1"},
+			"St":  []string{UPNPRootDevice},
+		},
+	}
+	start := time.Now()
+	adv.ServeMessage(req)
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("ServeMessage took %v, want it to return without waiting for MX", elapsed)
+	}
+
+	if err := recvConn.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 2048)
+	n, err := recvConn.Read(buf)
+	if err != nil {
+		t.Fatalf("reading search response: %v", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+	if err != nil {
+		t.Fatalf("parsing search response %q: %v", buf[:n], err)
+	}
+	for name, want := range map[string]string{
+		"ST":                UPNPRootDevice,
+		"USN":               testUDN + "::" + UPNPRootDevice,
+		"LOCATION":          testLocation,
+		"CACHE-CONTROL":     "max-age=100",
+		"BOOTID.UPNP.ORG":   "10",
+		"CONFIGID.UPNP.ORG": "20",
+	} {
+		if got := resp.Header.Get(name); got != want {
+			t.Errorf("got %s %q, want %q", name, got, want)
+		}
+	}
+
+	// Responses that are still waiting for their delay are dropped on close.
+	adv.ServeMessage(req)
+	adv.lock.Lock()
+	adv.closing = true
+	close(adv.done)
+	adv.lock.Unlock()
+	adv.wg.Wait()
+	if err := recvConn.SetReadDeadline(time.Now().Add(1100 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := recvConn.Read(buf); err == nil {
+		t.Errorf("got response %q after close, want none", buf[:n])
+	}
+}
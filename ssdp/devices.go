@@ -0,0 +1,198 @@
+package ssdp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SplitUSN splits a USN into the UDN of the device, and the type that it
+// advertises: "upnp:rootdevice", a device or service type, or "" for the USN
+// of the device itself. For example "uuid:1234::upnp:rootdevice" is split into
+// "uuid:1234" and "upnp:rootdevice".
+func SplitUSN(usn string) (udn, nt string) {
+	if i := strings.Index(usn, "::"); i >= 0 {
+		return usn[:i], usn[i+2:]
+	}
+	return usn, ""
+}
+
+// Device is the Registry's view of a device, combined from the entries with
+// the device's UDN. Once created, the Registry does not modify the Device
+// value - any changes are replaced with a new Device value.
+type Device struct {
+	// Unique Device Name, e.g. "uuid:...".
+	UDN string
+	// The types advertised by the device, sorted: "upnp:rootdevice" for root
+	// devices, and its device type and service types.
+	Types []string
+
+	// The following are from the entry with the most recent update.
+
+	// The address that the entry data was actually received from.
+	RemoteAddr string
+	// Location of the UPnP root device description.
+	Location url.URL
+	// BootID and ConfigID are -1 if not present.
+	BootID   int32
+	ConfigID int32
+	// The port to send unicast searches to, see CheckDevice.
+	SearchPort uint16
+	// When the last update was received for the device.
+	LastUpdate time.Time
+
+	// When the last of the device's entries is advised to expire.
+	CacheExpiry time.Time
+}
+
+// HasType reports whether the device advertises the type.
+func (d *Device) HasType(nt string) bool {
+	i := sort.SearchStrings(d.Types, nt)
+	return i < len(d.Types) && d.Types[i] == nt
+}
+
+// sameAs reports whether d and other are the same in the ways whose changes
+// are reported by EventDeviceChanged. BOOTID and CONFIGID changes are
+// reported by their own events.
+func (d *Device) sameAs(other *Device) bool {
+	if len(d.Types) != len(other.Types) {
+		return false
+	}
+	for i := range d.Types {
+		if d.Types[i] != other.Types[i] {
+			return false
+		}
+	}
+	return d.Location.String() == other.Location.String()
+}
+
+// GetDevice returns the device with the UDN, or nil if there are no entries
+// for it.
+func (reg *Registry) GetDevice(udn string) *Device {
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+	return reg.byUDN[udn]
+}
+
+// GetDevices returns the known devices, in no particular order.
+func (reg *Registry) GetDevices() []*Device {
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+	devices := make([]*Device, 0, len(reg.byUDN))
+	for _, d := range reg.byUDN {
+		devices = append(devices, d)
+	}
+	return devices
+}
+
+// CheckDevice re-checks that a known device is still present, by sending it a
+// unicast search for all of its types, as devices may not be heard from
+// where multicast is filtered. The device's entries for the types that it
+// responds with are refreshed as if announced with ssdp:alive, and entries
+// are added for types that it newly responds with. Entries for types that it
+// no longer responds with are left to expire. It reports whether the device
+// responded.
+func (reg *Registry) CheckDevice(ctx context.Context, httpu HTTPUClientCtx, udn string) (bool, error) {
+	d := reg.GetDevice(udn)
+	if d == nil {
+		return false, fmt.Errorf("ssdp: unknown device %q", udn)
+	}
+	host, _, err := net.SplitHostPort(d.RemoteAddr)
+	if err != nil {
+		return false, fmt.Errorf("ssdp: bad address %q for device %q: %v", d.RemoteAddr, udn, err)
+	}
+	responses, err := UnicastSearch(ctx, httpu, host, int(d.SearchPort), SSDPAll, 1)
+	if err != nil {
+		return false, err
+	}
+
+	var alive bool
+	for _, response := range responses {
+		if responseUDN, _ := SplitUSN(response.Header.Get("USN")); responseUDN != udn {
+			continue
+		}
+		entry, err := newEntry(response.Header, d.RemoteAddr, response.Header.Get("ST"), reg.now())
+		if err == nil {
+			err = reg.checkLocation(entry)
+		}
+		if err != nil {
+			log.Printf("ssdp: bad search response from device %q: %v", udn, err)
+			continue
+		}
+		alive = true
+		reg.storeEntry(entry, EventAlive)
+	}
+	return alive, nil
+}
+
+// refreshDeviceLocked rebuilds the device with the UDN from its entries, and
+// returns the device-level updates to send. reg.lock must be held.
+func (reg *Registry) refreshDeviceLocked(udn string) []Update {
+	old := reg.byUDN[udn]
+	d := reg.deviceFromEntriesLocked(udn)
+	switch {
+	case d == nil && old == nil:
+		return nil
+	case d == nil:
+		delete(reg.byUDN, udn)
+		return []Update{{USN: udn, EventType: EventDeviceOffline, Device: old}}
+	}
+	reg.byUDN[udn] = d
+	if old == nil {
+		return []Update{{USN: udn, EventType: EventDeviceOnline, Device: d}}
+	}
+	var updates []Update
+	if old.BootID >= 0 && d.BootID > old.BootID {
+		updates = append(updates, Update{USN: udn, EventType: EventDeviceRebooted, Device: d})
+	}
+	if old.ConfigID >= 0 && d.ConfigID >= 0 && d.ConfigID != old.ConfigID {
+		updates = append(updates, Update{USN: udn, EventType: EventDeviceConfigChanged, Device: d})
+	}
+	if !d.sameAs(old) {
+		updates = append(updates, Update{USN: udn, EventType: EventDeviceChanged, Device: d})
+	}
+	return updates
+}
+
+// deviceFromEntriesLocked creates the device with the UDN from its entries,
+// or returns nil if there are none. reg.lock must be held.
+func (reg *Registry) deviceFromEntriesLocked(udn string) *Device {
+	// As with GetService, the map is assumed to be small.
+	var d *Device
+	var latest *Entry
+	for usn, entry := range reg.byUSN {
+		entryUDN, nt := SplitUSN(usn)
+		if entryUDN != udn {
+			continue
+		}
+		if d == nil {
+			d = &Device{UDN: udn}
+		}
+		if nt != "" {
+			d.Types = append(d.Types, nt)
+		}
+		if latest == nil || entry.LastUpdate.After(latest.LastUpdate) ||
+			(entry.LastUpdate.Equal(latest.LastUpdate) && entry.BootID > latest.BootID) {
+			latest = entry
+		}
+		if entry.CacheExpiry.After(d.CacheExpiry) {
+			d.CacheExpiry = entry.CacheExpiry
+		}
+	}
+	if d == nil {
+		return nil
+	}
+	sort.Strings(d.Types)
+	d.RemoteAddr = latest.RemoteAddr
+	d.Location = latest.Location
+	d.BootID = latest.BootID
+	d.ConfigID = latest.ConfigID
+	d.SearchPort = latest.SearchPort
+	d.LastUpdate = latest.LastUpdate
+	return d
+}
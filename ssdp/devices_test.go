@@ -0,0 +1,318 @@
+package ssdp
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSplitUSN(t *testing.T) {
+	tests := []struct {
+		usn, udn, nt string
+	}{
+		{"uuid:1", "uuid:1", ""},
+		{"uuid:1::upnp:rootdevice", "uuid:1", "upnp:rootdevice"},
+		{"uuid:1::urn:schemas-upnp-org:service:Foo:1", "uuid:1", "urn:schemas-upnp-org:service:Foo:1"},
+	}
+	for _, test := range tests {
+		udn, nt := SplitUSN(test.usn)
+		if udn != test.udn || nt != test.nt {
+			t.Errorf("SplitUSN(%q) = %q, %q; want %q, %q", test.usn, udn, nt, test.udn, test.nt)
+		}
+	}
+}
+
+func TestRegistryDevices(t *testing.T) {
+	const deviceType = "urn:schemas-upnp-org:device:Basic:1"
+	reg := NewRegistry()
+	sub := reg.SubscribeDevices(10, DropNewest)
+	entries := reg.Subscribe(10, DropNewest)
+
+	wantUpdate := func(et EventType, types ...string) {
+		t.Helper()
+		select {
+		case u := <-sub.Updates():
+			if u.EventType != et || u.USN != "uuid:1" || u.Device == nil || u.Entry != nil {
+				t.Fatalf("got update %+v, want %v for uuid:1", u, et)
+			}
+			if !equalStrings(u.Device.Types, types) {
+				t.Errorf("got types %q, want %q", u.Device.Types, types)
+			}
+		default:
+			t.Fatalf("got no update, want %v", et)
+		}
+	}
+	wantNoUpdate := func() {
+		t.Helper()
+		select {
+		case u := <-sub.Updates():
+			t.Errorf("got update %+v, want none", u)
+		default:
+		}
+	}
+
+	reg.ServeMessage(newNotify(ntsAlive, "uuid:1::upnp:rootdevice", "upnp:rootdevice"))
+	wantUpdate(EventDeviceOnline, "upnp:rootdevice")
+	reg.ServeMessage(newNotify(ntsAlive, "uuid:1", "uuid:1"))
+	wantNoUpdate()
+	reg.ServeMessage(newNotify(ntsAlive, "uuid:1::"+deviceType, deviceType))
+	wantUpdate(EventDeviceChanged, "upnp:rootdevice", deviceType)
+	// Repeated announcements do not change the device.
+	reg.ServeMessage(newNotify(ntsAlive, "uuid:1::"+deviceType, deviceType))
+	wantNoUpdate()
+
+	if d := reg.GetDevice("uuid:1"); d == nil || !d.HasType(deviceType) || d.Location.Host != "192.168.1.1:80" {
+		t.Errorf("got device %+v, want uuid:1 with %s", d, deviceType)
+	}
+	if got := len(reg.GetDevices()); got != 1 {
+		t.Errorf("got %d devices, want 1", got)
+	}
+
+	for _, usn := range []string{"uuid:1::upnp:rootdevice", "uuid:1", "uuid:1::" + deviceType} {
+		reg.ServeMessage(newNotify(ntsByebye, usn, ""))
+	}
+	wantUpdate(EventDeviceChanged, deviceType)
+	wantUpdate(EventDeviceOffline, deviceType)
+	wantNoUpdate()
+	if d := reg.GetDevice("uuid:1"); d != nil {
+		t.Errorf("got device %+v after byebye, want nil", d)
+	}
+
+	// Entry subscriptions do not receive device-level updates.
+	for i := len(entries.Updates()); i > 0; i-- {
+		if u := <-entries.Updates(); u.EventType.isDeviceEvent() {
+			t.Errorf("entry subscription got %v", u.EventType)
+		}
+	}
+}
+
+func TestRegistryDeviceReboot(t *testing.T) {
+	reg := NewRegistry()
+	sub := reg.SubscribeDevices(10, DropNewest)
+	alive := func(usn string, bootID, configID string) {
+		r := newNotify(ntsAlive, usn, "")
+		r.Header.Set("BOOTID.UPNP.ORG", bootID)
+		r.Header.Set("CONFIGID.UPNP.ORG", configID)
+		reg.ServeMessage(r)
+	}
+	wantUpdates := func(want ...EventType) {
+		t.Helper()
+		var got []EventType
+		for i := len(sub.Updates()); i > 0; i-- {
+			got = append(got, (<-sub.Updates()).EventType)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("got updates %v, want %v", got, want)
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("got updates %v, want %v", got, want)
+			}
+		}
+	}
+
+	alive("uuid:1::upnp:rootdevice", "1", "10")
+	alive("uuid:1", "1", "10")
+	wantUpdates(EventDeviceOnline)
+
+	alive("uuid:1::upnp:rootdevice", "2", "10")
+	alive("uuid:1", "2", "10")
+	wantUpdates(EventDeviceRebooted)
+
+	alive("uuid:1::upnp:rootdevice", "3", "11")
+	wantUpdates(EventDeviceRebooted, EventDeviceConfigChanged)
+
+	r := newNotify(ntsUpdate, "uuid:1", "")
+	r.Header.Set("BOOTID.UPNP.ORG", "3")
+	r.Header.Set("NEXTBOOTID.UPNP.ORG", "4")
+	r.Header.Set("CONFIGID.UPNP.ORG", "11")
+	reg.ServeMessage(r)
+	wantUpdates(EventDeviceRebooted)
+}
+
+func TestRegistryDeviceUpdate(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	reg := NewRegistry()
+	reg.Now = func() time.Time { return now }
+	sub := reg.SubscribeDevices(10, DropNewest)
+
+	alive := newNotify(ntsAlive, "uuid:1::upnp:rootdevice", "upnp:rootdevice")
+	alive.Header.Set("BOOTID.UPNP.ORG", "1")
+	alive.Header.Set("CONFIGID.UPNP.ORG", "10")
+	reg.ServeMessage(alive)
+	if u := <-sub.Updates(); u.EventType != EventDeviceOnline {
+		t.Fatalf("got %v, want EventDeviceOnline", u.EventType)
+	}
+	wantExpiry := reg.GetDevice("uuid:1").CacheExpiry
+
+	// An update as per UDA, without CACHE-CONTROL, and announcing a new
+	// location that does not take effect until the next ssdp:alive.
+	now = now.Add(10 * time.Second)
+	update := &http.Request{
+		Method:     methodNotify,
+		RemoteAddr: "192.168.1.1:1900",
+		Header: http.Header{
+			"Host":                []string{ssdpUDP4Addr},
+			"Location":            []string{"http://192.168.1.1:8080/desc.xml"},
+			"Nt":                  []string{"upnp:rootdevice"},
+			"Nts":                 []string{ntsUpdate},
+			"Usn":                 []string{"uuid:1::upnp:rootdevice"},
+			"Bootid.upnp.org":     []string{"1"},
+			"Configid.upnp.org":   []string{"11"},
+			"Nextbootid.upnp.org": []string{"2"},
+		},
+	}
+	reg.ServeMessage(update)
+	for _, want := range []EventType{EventDeviceRebooted, EventDeviceConfigChanged} {
+		select {
+		case u := <-sub.Updates():
+			if u.EventType != want {
+				t.Fatalf("got %v, want %v", u.EventType, want)
+			}
+		default:
+			t.Fatalf("got no update, want %v", want)
+		}
+	}
+
+	d := reg.GetDevice("uuid:1")
+	if d.BootID != 2 || d.ConfigID != 11 {
+		t.Errorf("got BootID %d ConfigID %d, want 2 and 11", d.BootID, d.ConfigID)
+	}
+	if !d.CacheExpiry.Equal(wantExpiry) {
+		t.Errorf("got CacheExpiry %v, want %v", d.CacheExpiry, wantExpiry)
+	}
+	if got, want := d.Location.String(), "http://192.168.1.1:80/desc.xml"; got != want {
+		t.Errorf("got Location %q, want %q", got, want)
+	}
+
+	// Updates for unknown devices are ignored.
+	update.Header.Set("USN", "uuid:2::upnp:rootdevice")
+	reg.ServeMessage(update)
+	if d := reg.GetDevice("uuid:2"); d != nil {
+		t.Errorf("got device %+v for an update of an unknown device, want none", d)
+	}
+}
+
+func TestRegistryDeviceEventOrder(t *testing.T) {
+	const rounds = 200
+	reg := NewRegistry()
+	sub := reg.SubscribeDevices(8*rounds, DropNewest)
+
+	// Concurrent announcements and byebyes for the same device.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				reg.ServeMessage(newNotify(ntsAlive, "uuid:1", ""))
+				reg.ServeMessage(newNotify(ntsByebye, "uuid:1", ""))
+			}
+		}()
+	}
+	wg.Wait()
+	sub.Cancel()
+
+	online := false
+	for u := range sub.Updates() {
+		switch {
+		case u.EventType == EventDeviceOnline && !online:
+			online = true
+		case u.EventType == EventDeviceOffline && online:
+			online = false
+		default:
+			t.Fatalf("got %v while online=%t, want events in order", u.EventType, online)
+		}
+	}
+	if sub.Dropped() != 0 {
+		t.Errorf("got %d dropped updates, want 0", sub.Dropped())
+	}
+}
+
+// unicastHTTPUClient responds to searches with a response for each of the
+// USNs and STs in responses.
+type unicastHTTPUClient struct {
+	responses [][2]string
+	reqs      []*http.Request
+}
+
+func (c *unicastHTTPUClient) DoWithContext(req *http.Request, numSends int) ([]*http.Response, error) {
+	c.reqs = append(c.reqs, req)
+	var responses []*http.Response
+	for _, r := range c.responses {
+		header := http.Header{}
+		header.Set("USN", r[0])
+		header.Set("ST", r[1])
+		header.Set("Location", "http://192.168.1.1:80/desc.xml")
+		header.Set("Cache-Control", "max-age=60")
+		responses = append(responses, &http.Response{StatusCode: 200, Header: header})
+	}
+	return responses, nil
+}
+
+func TestRegistryCheckDevice(t *testing.T) {
+	const deviceType = "urn:schemas-upnp-org:device:Basic:1"
+	reg := NewRegistry()
+	req := newNotify(ntsAlive, "uuid:1::upnp:rootdevice", "upnp:rootdevice")
+	req.Header.Set("SEARCHPORT.UPNP.ORG", "50000")
+	reg.ServeMessage(req)
+	sub := reg.SubscribeDevices(10, DropNewest)
+
+	client := &unicastHTTPUClient{responses: [][2]string{
+		{"uuid:1::upnp:rootdevice", "upnp:rootdevice"},
+		{"uuid:1::" + deviceType, deviceType},
+		{"uuid:2::upnp:rootdevice", "upnp:rootdevice"},
+	}}
+	alive, err := reg.CheckDevice(context.Background(), client, "uuid:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !alive {
+		t.Error("got not alive, want alive")
+	}
+	if len(client.reqs) != 1 {
+		t.Fatalf("got %d requests, want 1", len(client.reqs))
+	}
+	r := client.reqs[0]
+	if r.Host != "192.168.1.1:50000" || r.Header["HOST"][0] != "192.168.1.1:50000" || r.Header["ST"][0] != SSDPAll {
+		t.Errorf("got request to %s with header %v, want search for all to the search port", r.Host, r.Header)
+	}
+	if _, ok := r.Header["MX"]; ok {
+		t.Error("got MX in unicast search, want none")
+	}
+	if _, ok := r.Header["USER-AGENT"]; !ok {
+		t.Error("got no USER-AGENT in search, want the default")
+	}
+
+	select {
+	case u := <-sub.Updates():
+		if u.EventType != EventDeviceChanged || !u.Device.HasType(deviceType) {
+			t.Errorf("got update %+v, want EventDeviceChanged with the new type", u)
+		}
+	default:
+		t.Error("got no update, want EventDeviceChanged")
+	}
+	if d := reg.GetDevice("uuid:2"); d != nil {
+		t.Errorf("got device %+v from response for another device, want none", d)
+	}
+
+	client.responses = nil
+	if alive, err := reg.CheckDevice(context.Background(), client, "uuid:1"); alive || err != nil {
+		t.Errorf("got %t, %v without responses, want not alive", alive, err)
+	}
+}
+
+func TestPrepareUnicastRequest(t *testing.T) {
+	req, err := prepareUnicastRequest(context.Background(), "fe80::1%eth0", 0, UPNPRootDevice, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Host != "[fe80::1%eth0]:1900" || req.Header["HOST"][0] != "[fe80::1]:1900" {
+		t.Errorf("got request to %s with HOST %q, want the zone only in the destination", req.Host, req.Header["HOST"])
+	}
+	if _, err := prepareUnicastRequest(context.Background(), "example.com", 0, UPNPRootDevice, nil); err == nil {
+		t.Error("got success for host name, want error")
+	}
+}
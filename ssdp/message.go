@@ -0,0 +1,435 @@
+package ssdp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/huin/goupnp/httpu"
+)
+
+// MessageType is the kind of an SSDP message.
+type MessageType int8
+
+const (
+	// MessageSearch is an M-SEARCH request.
+	MessageSearch = MessageType(iota + 1)
+	// MessageNotify is a NOTIFY request, announcing a device or service.
+	MessageNotify
+	// MessageResponse is a response to an M-SEARCH request.
+	MessageResponse
+)
+
+func (mt MessageType) String() string {
+	switch mt {
+	case MessageSearch:
+		return "MessageSearch"
+	case MessageNotify:
+		return "MessageNotify"
+	case MessageResponse:
+		return "MessageResponse"
+	default:
+		return fmt.Sprintf("MessageUnknown(%d)", int8(mt))
+	}
+}
+
+// Message is an SSDP message: an M-SEARCH or NOTIFY request, or a response to
+// a search. Fields not used by a type of message are left empty.
+//
+// NOTE: the interface for this is experimental and may change, or go away
+// entirely.
+type Message struct {
+	Type MessageType
+
+	// StatusCode is the status of a response, which is 200 for a successful
+	// search response.
+	StatusCode int
+
+	// HOST header, of requests.
+	Host string
+	// MAN and MX headers, of searches. MX is 0 if not present.
+	MAN string
+	MX  int
+	// Search target. The ST header of searches and responses.
+	ST string
+	// Notification type and sub type. The NT and NTS headers of notifies.
+	NT  string
+	NTS string
+	// Unique Service Name. The USN header of notifies and responses.
+	USN string
+	// Location of the UPnP root device description, nil if not present.
+	Location *url.URL
+	// Server's self-identifying string.
+	Server string
+	// MaxAge is the CACHE-CONTROL max-age, 0 if not present.
+	MaxAge time.Duration
+	// Ext is whether the EXT header is present, as it must be in responses.
+	Ext bool
+
+	// BOOTID.UPNP.ORG, CONFIGID.UPNP.ORG and SEARCHPORT.UPNP.ORG. Set to -1 if
+	// not present. As 0 is a valid BOOTID and CONFIGID, they must be set to -1
+	// to omit them when formatting. SEARCHPORT is only formatted if it is
+	// from 1 to 65535.
+	BootID     int32
+	ConfigID   int32
+	SearchPort int32
+
+	// Header has all of the headers of a parsed message. When formatting,
+	// it has any headers to send in addition to those from the above fields.
+	Header http.Header
+}
+
+// ParseMessage parses an SSDP message, checking that it has the headers
+// required for its type, and that their values are valid.
+func ParseMessage(data []byte) (*Message, error) {
+	return parseMessage(data, true)
+}
+
+// ParseMessageLenient parses an SSDP message like ParseMessage, but allows
+// missing headers and header values that are not valid, which are left
+// empty, as devices commonly get them wrong. It only fails if the message is
+// not HTTP-like.
+func ParseMessageLenient(data []byte) (*Message, error) {
+	return parseMessage(data, false)
+}
+
+func parseMessage(data []byte, strict bool) (*Message, error) {
+	if !strict && !bytes.Contains(data, []byte("\n\n")) && !bytes.Contains(data, []byte("\r\n\r\n")) {
+		// Tolerate a missing blank line at the end of the headers.
+		data = append(append([]byte(nil), data...), "\r\n\r\n"...)
+	}
+	r := bufio.NewReader(bytes.NewReader(data))
+	if bytes.HasPrefix(data, []byte("HTTP/")) {
+		response, err := http.ReadResponse(r, nil)
+		if err != nil {
+			return nil, fmt.Errorf("ssdp: error parsing response: %v", err)
+		}
+		return messageFromResponse(response, strict)
+	}
+	req, err := http.ReadRequest(r)
+	if err != nil {
+		return nil, fmt.Errorf("ssdp: error parsing request: %v", err)
+	}
+	return messageFromRequest(req, strict)
+}
+
+// messageFromRequest creates the message for an M-SEARCH or NOTIFY request.
+func messageFromRequest(req *http.Request, strict bool) (*Message, error) {
+	method := req.Method
+	if !strict {
+		method = strings.ToUpper(method)
+	}
+	m := &Message{Header: req.Header}
+	switch method {
+	case methodSearch:
+		m.Type = MessageSearch
+	case methodNotify:
+		m.Type = MessageNotify
+	default:
+		return nil, fmt.Errorf("ssdp: unknown method %q", req.Method)
+	}
+	host := req.Header.Get("HOST")
+	if host == "" {
+		host = req.Host
+	}
+	m.Host = host
+	if err := m.parseHeaders(strict); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// messageFromResponse creates the message for a search response.
+func messageFromResponse(response *http.Response, strict bool) (*Message, error) {
+	m := &Message{
+		Type:       MessageResponse,
+		StatusCode: response.StatusCode,
+		Header:     response.Header,
+	}
+	if strict && response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ssdp: got response status %q", response.Status)
+	}
+	if err := m.parseHeaders(strict); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parseHeaders sets the fields of m from m.Header. If strict is set, it
+// checks that the headers required by the type of message are present and
+// valid, and otherwise it ignores values that are not valid.
+func (m *Message) parseHeaders(strict bool) error {
+	h := m.Header
+	var errs []string
+	check := func(err error) {
+		if err != nil && strict {
+			// Errors from the shared header parsers have the package prefix.
+			errs = append(errs, strings.TrimPrefix(err.Error(), "ssdp: "))
+		}
+	}
+	require := func(name, value string) {
+		if value == "" {
+			check(fmt.Errorf("missing %s header", name))
+		}
+	}
+
+	m.MAN = h.Get("MAN")
+	m.ST = h.Get("ST")
+	m.NT = h.Get("NT")
+	m.NTS = h.Get("NTS")
+	m.USN = h.Get("USN")
+	m.Server = h.Get("SERVER")
+	m.Ext = hasHeader(h, "EXT")
+
+	if mx := h.Get("MX"); mx != "" {
+		v, err := strconv.Atoi(mx)
+		if err == nil && v < 1 {
+			err = fmt.Errorf("MX %d is less than 1", v)
+		}
+		if err != nil {
+			check(fmt.Errorf("bad MX: %v", err))
+		} else {
+			m.MX = v
+		}
+	}
+	if loc := h.Get("LOCATION"); loc != "" {
+		u, err := url.Parse(loc)
+		if err != nil {
+			check(fmt.Errorf("bad LOCATION: %v", err))
+		} else {
+			m.Location = u
+		}
+	}
+	if cc := h.Get("CACHE-CONTROL"); cc != "" {
+		maxAge, err := parseCacheControlMaxAge(cc)
+		if err != nil {
+			check(fmt.Errorf("bad CACHE-CONTROL: %v", err))
+		} else {
+			m.MaxAge = maxAge
+		}
+	}
+	for _, field := range []struct {
+		name string
+		v    *int32
+	}{
+		{"BOOTID.UPNP.ORG", &m.BootID},
+		{"CONFIGID.UPNP.ORG", &m.ConfigID},
+		{"SEARCHPORT.UPNP.ORG", &m.SearchPort},
+	} {
+		v, err := parseUpnpIntHeader(h, field.name, -1)
+		if err != nil {
+			check(err)
+			v = -1
+		}
+		*field.v = v
+	}
+	if m.SearchPort != -1 && (m.SearchPort < 1 || m.SearchPort > 65535) {
+		check(fmt.Errorf("search port %d is out of range", m.SearchPort))
+		m.SearchPort = -1
+	}
+
+	switch m.Type {
+	case MessageSearch:
+		require("HOST", m.Host)
+		if m.MAN != ssdpDiscover {
+			check(fmt.Errorf("MAN is %q rather than %s", m.MAN, ssdpDiscover))
+		}
+		require("ST", m.ST)
+		if m.MX == 0 && isMulticastHost(m.Host) {
+			check(errors.New("missing MX header in multicast search"))
+		}
+	case MessageNotify:
+		require("HOST", m.Host)
+		require("NT", m.NT)
+		require("USN", m.USN)
+		switch m.NTS {
+		case ntsAlive:
+			require("CACHE-CONTROL", h.Get("CACHE-CONTROL"))
+			require("LOCATION", h.Get("LOCATION"))
+		case ntsUpdate:
+			require("LOCATION", h.Get("LOCATION"))
+		case ntsByebye:
+		default:
+			check(fmt.Errorf("unknown NTS %q", m.NTS))
+		}
+	case MessageResponse:
+		require("CACHE-CONTROL", h.Get("CACHE-CONTROL"))
+		if !m.Ext {
+			check(errors.New("missing EXT header"))
+		}
+		require("LOCATION", h.Get("LOCATION"))
+		require("ST", m.ST)
+		require("USN", m.USN)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("ssdp: invalid %v: %s", m.Type, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// hasHeader reports whether the header is present, even if empty.
+func hasHeader(h http.Header, name string) bool {
+	for key := range h {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMulticastHost reports whether the host:port address has a multicast IP.
+func isMulticastHost(hostPort string) bool {
+	host, _, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		host = hostPort
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsMulticast()
+}
+
+// messageHeaders are the headers set from the fields of a Message.
+var messageHeaders = []string{
+	"HOST", "MAN", "MX", "ST", "NT", "NTS", "USN", "LOCATION", "SERVER",
+	"CACHE-CONTROL", "EXT", "BOOTID.UPNP.ORG", "CONFIGID.UPNP.ORG",
+	"SEARCHPORT.UPNP.ORG",
+}
+
+// Format formats the message to be sent. Headers are only included for
+// fields that are set, except that a search always has a MAN header, and a
+// response has an EXT header if Ext is set. BOOTID.UPNP.ORG and
+// CONFIGID.UPNP.ORG are included unless -1. Header names are upper case, as
+// some devices require.
+func (m *Message) Format() []byte {
+	var buf bytes.Buffer
+	switch m.Type {
+	case MessageSearch:
+		buf.WriteString(methodSearch + " * HTTP/1.1\r\n")
+	case MessageNotify:
+		buf.WriteString(methodNotify + " * HTTP/1.1\r\n")
+	default:
+		code := m.StatusCode
+		if code == 0 {
+			code = http.StatusOK
+		}
+		fmt.Fprintf(&buf, "HTTP/1.1 %03d %s\r\n", code, http.StatusText(code))
+	}
+
+	// Putting headers in here avoids them being title-cased.
+	header := http.Header{}
+	set := func(name, value string) {
+		if value != "" {
+			header[name] = []string{value}
+		}
+	}
+	setInt := func(name string, v int64, present bool) {
+		if present {
+			header[name] = []string{strconv.FormatInt(v, 10)}
+		}
+	}
+	set("HOST", m.Host)
+	if m.Type == MessageSearch {
+		man := m.MAN
+		if man == "" {
+			man = ssdpDiscover
+		}
+		set("MAN", man)
+	}
+	setInt("MX", int64(m.MX), m.MX > 0)
+	set("ST", m.ST)
+	set("NT", m.NT)
+	set("NTS", m.NTS)
+	set("USN", m.USN)
+	if m.Location != nil {
+		set("LOCATION", m.Location.String())
+	}
+	set("SERVER", m.Server)
+	if m.MaxAge > 0 {
+		set("CACHE-CONTROL", formatMaxAge(m.MaxAge))
+	}
+	if m.Ext {
+		header["EXT"] = []string{""}
+	}
+	setInt("BOOTID.UPNP.ORG", int64(m.BootID), m.BootID >= 0)
+	setInt("CONFIGID.UPNP.ORG", int64(m.ConfigID), m.ConfigID >= 0)
+	setInt("SEARCHPORT.UPNP.ORG", int64(m.SearchPort), m.SearchPort >= 1 && m.SearchPort <= 65535)
+	for name, values := range m.Header {
+		if !isMessageHeader(name) {
+			header[name] = values
+		}
+	}
+
+	// Writing to a bytes.Buffer does not fail.
+	header.Write(&buf)
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+func isMessageHeader(name string) bool {
+	for _, h := range messageHeaders {
+		if strings.EqualFold(name, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchResponse is a response to an SSDP search.
+//
+// NOTE: the interface for this is experimental and may change, or go away
+// entirely.
+type SearchResponse struct {
+	Message
+
+	// LocalAddr is the local address that the response was received on, if
+	// known. See httpu.LocalAddressHeader.
+	LocalAddr string
+}
+
+// NewSearchResponse creates the SearchResponse for a response returned by
+// RawSearch or another search function. As with ParseMessageLenient, header
+// values that are not valid are left empty.
+func NewSearchResponse(response *http.Response) *SearchResponse {
+	// Lenient parsing does not fail.
+	m, _ := messageFromResponse(response, false)
+	return &SearchResponse{
+		Message:   *m,
+		LocalAddr: response.Header.Get(httpu.LocalAddressHeader),
+	}
+}
+
+// Search is like RawSearch, but returns the parsed responses.
+func Search(
+	ctx context.Context,
+	httpu HTTPUClientCtx,
+	searchTarget string,
+	numSends int,
+) ([]*SearchResponse, error) {
+	return (&Searcher{}).Search(ctx, httpu, searchTarget, numSends)
+}
+
+// Search is like the package-level Search, but sends the searcher's identity.
+func (s *Searcher) Search(
+	ctx context.Context,
+	httpu HTTPUClientCtx,
+	searchTarget string,
+	numSends int,
+) ([]*SearchResponse, error) {
+	responses, err := s.RawSearch(ctx, httpu, searchTarget, numSends)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*SearchResponse, len(responses))
+	for i, response := range responses {
+		results[i] = NewSearchResponse(response)
+	}
+	return results, nil
+}
@@ -0,0 +1,142 @@
+package ssdp
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMessage(t *testing.T) {
+	const response = "HTTP/1.1 200 OK\r\n" +
+		"CACHE-CONTROL: max-age=1800\r\n" +
+		"EXT:\r\n" +
+		"LOCATION: http://192.168.1.1:80/desc.xml\r\n" +
+		"SERVER: Linux/5.0 UPnP/1.1 Test/1.0\r\n" +
+		"ST: upnp:rootdevice\r\n" +
+		"USN: uuid:1::upnp:rootdevice\r\n" +
+		"BOOTID.UPNP.ORG: 7\r\n" +
+		"CONFIGID.UPNP.ORG: 3\r\n" +
+		"\r\n"
+	m, err := ParseMessage([]byte(response))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Type != MessageResponse || m.ST != UPNPRootDevice || m.USN != "uuid:1::upnp:rootdevice" ||
+		m.Location.String() != "http://192.168.1.1:80/desc.xml" || m.Server != "Linux/5.0 UPnP/1.1 Test/1.0" ||
+		m.MaxAge != 1800*time.Second || !m.Ext || m.BootID != 7 || m.ConfigID != 3 || m.SearchPort != -1 {
+		t.Errorf("got %+v", m)
+	}
+
+	// Formatting and parsing again gives the same message.
+	m2, err := ParseMessage(m.Format())
+	if err != nil {
+		t.Fatalf("parsing formatted message: %v\n%s", err, m.Format())
+	}
+	if m2.ST != m.ST || m2.USN != m.USN || m2.Location.String() != m.Location.String() ||
+		m2.MaxAge != m.MaxAge || !m2.Ext || m2.BootID != m.BootID || m2.ConfigID != m.ConfigID ||
+		m2.SearchPort != -1 || m2.Server != m.Server {
+		t.Errorf("got %+v after formatting, want %+v", m2, m)
+	}
+}
+
+func TestParseMessageStrictAndLenient(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     string
+		wantErr string // From strict parsing.
+		check   func(*Message) bool
+	}{
+		{
+			name: "search without MX",
+			msg: "M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\n" +
+				"MAN: \"ssdp:discover\"\r\nST: ssdp:all\r\n\r\n",
+			wantErr: "missing MX",
+			check:   func(m *Message) bool { return m.Type == MessageSearch && m.ST == SSDPAll && m.MX == 0 },
+		},
+		{
+			name: "notify with bad BOOTID",
+			msg: "NOTIFY * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nNT: upnp:rootdevice\r\n" +
+				"NTS: ssdp:alive\r\nUSN: uuid:1::upnp:rootdevice\r\nCACHE-CONTROL: max-age=60\r\n" +
+				"LOCATION: http://192.168.1.1/desc.xml\r\nBOOTID.UPNP.ORG: x\r\n\r\n",
+			wantErr: "BOOTID.UPNP.ORG",
+			check: func(m *Message) bool {
+				return m.Type == MessageNotify && m.NTS == ntsAlive && m.BootID == -1 && m.MaxAge == time.Minute
+			},
+		},
+		{
+			name:    "response without EXT, blank line or valid max-age",
+			msg:     "HTTP/1.1 200 OK\r\nCACHE-CONTROL: no-cache\r\nLOCATION: http://192.168.1.1/desc.xml\r\nST: upnp:rootdevice\r\nUSN: uuid:1",
+			wantErr: "error parsing response",
+			check: func(m *Message) bool {
+				return m.Type == MessageResponse && !m.Ext && m.MaxAge == 0 && m.USN == "uuid:1"
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ParseMessage([]byte(test.msg)); err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("strict: got error %v, want error containing %q", err, test.wantErr)
+			}
+			m, err := ParseMessageLenient([]byte(test.msg))
+			if err != nil {
+				t.Fatalf("lenient: %v", err)
+			}
+			if !test.check(m) {
+				t.Errorf("lenient: got %+v", m)
+			}
+		})
+	}
+}
+
+func TestFormatSearch(t *testing.T) {
+	m := &Message{
+		Type:       MessageSearch,
+		Host:       ssdpUDP4Addr,
+		MX:         2,
+		ST:         SSDPAll,
+		BootID:     -1,
+		ConfigID:   -1,
+		SearchPort: -1,
+		Header:     http.Header{"USER-AGENT": []string{"test"}},
+	}
+	want := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: ssdp:all\r\n" +
+		"USER-AGENT: test\r\n" +
+		"\r\n"
+	if got := string(m.Format()); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFormatZeroValues(t *testing.T) {
+	// A zero Message formats as a response.
+	zero, err := ParseMessageLenient((&Message{}).Format())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zero.Type != MessageResponse || zero.StatusCode != http.StatusOK {
+		t.Errorf("got %v %d, want %v 200", zero.Type, zero.StatusCode, MessageResponse)
+	}
+	if zero.BootID != 0 || zero.ConfigID != 0 || zero.SearchPort != -1 {
+		t.Errorf("got BootID %d, ConfigID %d, SearchPort %d; want 0, 0, -1",
+			zero.BootID, zero.ConfigID, zero.SearchPort)
+	}
+
+	search := &Message{
+		Type: MessageSearch,
+		Host: ssdpUDP4Addr,
+		MX:   2,
+		ST:   SSDPAll,
+	}
+	got, err := ParseMessage(search.Format())
+	if err != nil {
+		t.Fatalf("ParseMessage of formatted search literal: %v", err)
+	}
+	if got.ST != search.ST || got.MX != search.MX || got.SearchPort != -1 {
+		t.Errorf("got %+v, want search for %q with MX 2 and no search port", got, search.ST)
+	}
+}
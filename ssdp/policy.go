@@ -0,0 +1,186 @@
+package ssdp
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// LocationRejection is the reason that a LocationPolicy rejected a location.
+type LocationRejection int8
+
+const (
+	// RejectedScheme is for a location that is not an http URL, or https if
+	// allowed.
+	RejectedScheme = LocationRejection(iota + 1)
+	// RejectedPort is for a location port outside of the allowed range.
+	RejectedPort
+	// RejectedAddress is for a location host that is not a private,
+	// link-local or loopback IP address.
+	RejectedAddress
+	// RejectedHost is for a location host that is not the address that the
+	// message was received from.
+	RejectedHost
+)
+
+func (lr LocationRejection) String() string {
+	switch lr {
+	case RejectedScheme:
+		return "RejectedScheme"
+	case RejectedPort:
+		return "RejectedPort"
+	case RejectedAddress:
+		return "RejectedAddress"
+	case RejectedHost:
+		return "RejectedHost"
+	default:
+		return fmt.Sprintf("RejectedUnknown(%d)", int8(lr))
+	}
+}
+
+// LocationError is the error for a location rejected by a LocationPolicy.
+type LocationError struct {
+	// The rejected location.
+	Location string
+	// The address that the message was received from, "" if unknown.
+	Source string
+	// Why the location was rejected.
+	Reason LocationRejection
+}
+
+func (err *LocationError) Error() string {
+	var why string
+	switch err.Reason {
+	case RejectedScheme:
+		why = "scheme is not allowed"
+	case RejectedPort:
+		why = "port is not allowed"
+	case RejectedAddress:
+		why = "host is not a private, link-local or loopback address"
+	case RejectedHost:
+		why = "host is not the message source " + err.Source
+	default:
+		why = err.Reason.String()
+	}
+	return fmt.Sprintf("ssdp: rejected location %q: %s", err.Location, why)
+}
+
+// LocationPolicy validates the LOCATION of SSDP messages, so that a hostile
+// peer on the network cannot make a control point fetch arbitrary URLs, such
+// as internal admin endpoints or cloud metadata. The zero value is the
+// strictest policy: the location must be an http URL whose host is the
+// private, link-local or loopback IP address that the message was received
+// from, if that is known.
+//
+// NOTE: the interface for this is experimental and may change, or go away
+// entirely.
+type LocationPolicy struct {
+	// AllowOtherHosts allows location hosts other than the address that the
+	// message was received from, including host names.
+	AllowOtherHosts bool
+	// AllowPublicAddrs allows location hosts other than private (RFC 1918,
+	// RFC 4193), link-local and loopback IP addresses, including host names.
+	AllowPublicAddrs bool
+	// AllowHTTPS allows https locations, as well as http.
+	AllowHTTPS bool
+	// MinPort and MaxPort limit the location port, or the default port for
+	// the scheme if it has none. They are 1 and 65535 if 0.
+	MinPort int
+	MaxPort int
+}
+
+// Check returns a *LocationError if the policy rejects the location, which
+// was in a message received from the address source ("host:port", or "" if
+// unknown). The location host is only checked against the source if it is
+// known, as it is not by HTTPU clients that do not set
+// httpu.RemoteAddressHeader.
+func (p *LocationPolicy) Check(loc *url.URL, source string) error {
+	reject := func(reason LocationRejection) error {
+		return &LocationError{Location: loc.String(), Source: source, Reason: reason}
+	}
+
+	defaultPort := 80
+	switch {
+	case loc.Scheme == "http":
+	case loc.Scheme == "https" && p.AllowHTTPS:
+		defaultPort = 443
+	default:
+		return reject(RejectedScheme)
+	}
+
+	port := defaultPort
+	if portStr := loc.Port(); portStr != "" {
+		var err error
+		if port, err = strconv.Atoi(portStr); err != nil {
+			return reject(RejectedPort)
+		}
+	}
+	minPort, maxPort := p.MinPort, p.MaxPort
+	if minPort <= 0 {
+		minPort = 1
+	}
+	if maxPort <= 0 {
+		maxPort = 65535
+	}
+	if port < minPort || port > maxPort {
+		return reject(RejectedPort)
+	}
+
+	host := loc.Hostname()
+	if i := strings.LastIndexByte(host, '%'); i >= 0 {
+		host = host[:i]
+	}
+	ip := net.ParseIP(host)
+	if !p.AllowPublicAddrs && (ip == nil || !isLocalIP(ip)) {
+		return reject(RejectedAddress)
+	}
+	if !p.AllowOtherHosts && source != "" {
+		sourceHost, _, err := net.SplitHostPort(source)
+		if err != nil {
+			sourceHost = source
+		}
+		if i := strings.LastIndexByte(sourceHost, '%'); i >= 0 {
+			sourceHost = sourceHost[:i]
+		}
+		if sourceIP := net.ParseIP(sourceHost); ip == nil || sourceIP == nil || !ip.Equal(sourceIP) {
+			return reject(RejectedHost)
+		}
+	}
+	return nil
+}
+
+// localNets are the private and link-local IP address ranges.
+var localNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"10.0.0.0/8",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"169.254.0.0/16",
+		"fc00::/7",
+		"fe80::/10",
+	} {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}()
+
+// isLocalIP reports whether the IP address is private, link-local or
+// loopback.
+func isLocalIP(ip net.IP) bool {
+	if ip.IsLoopback() {
+		return true
+	}
+	for _, ipNet := range localNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
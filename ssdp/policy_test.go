@@ -0,0 +1,65 @@
+package ssdp
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestLocationPolicyCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy LocationPolicy
+		loc    string
+		source string
+		want   LocationRejection // 0 if accepted.
+	}{
+		{"from source", LocationPolicy{}, "http://192.168.1.1:80/desc.xml", "192.168.1.1:1900", 0},
+		{"default port", LocationPolicy{}, "http://192.168.1.1/desc.xml", "192.168.1.1:1900", 0},
+		{"link-local with zone", LocationPolicy{}, "http://[fe80::1%25eth0]:80/desc.xml", "[fe80::1%eth0]:1900", 0},
+		{"not from source", LocationPolicy{}, "http://192.168.1.2/desc.xml", "192.168.1.1:1900", RejectedHost},
+		{"unknown source", LocationPolicy{}, "http://192.168.1.1/desc.xml", "", 0},
+		{"unknown source, public", LocationPolicy{}, "http://8.8.8.8/desc.xml", "", RejectedAddress},
+		{"other host allowed", LocationPolicy{AllowOtherHosts: true}, "http://192.168.1.2/desc.xml", "192.168.1.1:1900", 0},
+		{"public", LocationPolicy{}, "http://8.8.8.8/desc.xml", "8.8.8.8:1900", RejectedAddress},
+		{"host name", LocationPolicy{AllowOtherHosts: true}, "http://router.local/desc.xml", "192.168.1.1:1900", RejectedAddress},
+		{"public allowed", LocationPolicy{AllowPublicAddrs: true}, "http://8.8.8.8/desc.xml", "8.8.8.8:1900", 0},
+		{"metadata", LocationPolicy{}, "http://169.254.169.254/latest/meta-data", "192.168.1.1:1900", RejectedHost},
+		{"file scheme", LocationPolicy{}, "file:///etc/passwd", "192.168.1.1:1900", RejectedScheme},
+		{"https", LocationPolicy{}, "https://192.168.1.1/desc.xml", "192.168.1.1:1900", RejectedScheme},
+		{"https allowed", LocationPolicy{AllowHTTPS: true}, "https://192.168.1.1/desc.xml", "192.168.1.1:1900", 0},
+		{"port below range", LocationPolicy{MinPort: 1024}, "http://192.168.1.1/desc.xml", "192.168.1.1:1900", RejectedPort},
+		{"port in range", LocationPolicy{MinPort: 1024}, "http://192.168.1.1:49152/desc.xml", "192.168.1.1:1900", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loc, err := url.Parse(test.loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = test.policy.Check(loc, test.source)
+			var locErr *LocationError
+			switch {
+			case test.want == 0 && err != nil:
+				t.Errorf("got %v, want accepted", err)
+			case test.want != 0 && (!errors.As(err, &locErr) || locErr.Reason != test.want):
+				t.Errorf("got %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestRegistryLocationPolicy(t *testing.T) {
+	reg := NewRegistry()
+	reg.LocationPolicy = &LocationPolicy{}
+	req := newNotify(ntsAlive, "uuid:1::upnp:rootdevice", UPNPRootDevice)
+	req.Header.Set("Location", "http://192.168.1.2:80/desc.xml")
+	reg.ServeMessage(req)
+	if entries := reg.GetService(UPNPRootDevice); len(entries) != 0 {
+		t.Errorf("got entries %v for location on another host, want none", entries)
+	}
+	reg.ServeMessage(newNotify(ntsAlive, "uuid:1::upnp:rootdevice", UPNPRootDevice))
+	if entries := reg.GetService(UPNPRootDevice); len(entries) != 1 {
+		t.Errorf("got %d entries for location on sending host, want 1", len(entries))
+	}
+}
@@ -1,6 +1,7 @@
 package ssdp
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -15,6 +16,10 @@ import (
 
 const (
 	maxExpiryTimeSeconds = 24 * 60 * 60
+
+	// DefaultSweepInterval is the default interval at which a Registry's
+	// sweeper removes expired entries.
+	DefaultSweepInterval = 30 * time.Second
 )
 
 var (
@@ -25,6 +30,28 @@ const (
 	EventAlive = EventType(iota)
 	EventUpdate
 	EventByeBye
+	// EventExpired is sent when an entry is removed because its cache expiry
+	// passed without it being renewed.
+	EventExpired
+
+	// Device-level events, sent to subscriptions from
+	// Registry.SubscribeDevices.
+
+	// EventDeviceOnline is sent when the first entry for a device is added.
+	EventDeviceOnline
+	// EventDeviceChanged is sent when a device's advertised types or
+	// location change.
+	EventDeviceChanged
+	// EventDeviceOffline is sent when the last entry for a device is removed.
+	EventDeviceOffline
+	// EventDeviceRebooted is sent when a device's BOOTID increases, which it
+	// does when the device reboots, or announces with ssdp:update that its
+	// network has changed. Its previous state, such as event subscriptions,
+	// should be assumed lost.
+	EventDeviceRebooted
+	// EventDeviceConfigChanged is sent when a device's CONFIGID changes,
+	// meaning that its device or service descriptions have changed.
+	EventDeviceConfigChanged
 )
 
 type EventType int8
@@ -37,22 +64,44 @@ func (et EventType) String() string {
 		return "EventUpdate"
 	case EventByeBye:
 		return "EventByeBye"
+	case EventExpired:
+		return "EventExpired"
+	case EventDeviceOnline:
+		return "EventDeviceOnline"
+	case EventDeviceChanged:
+		return "EventDeviceChanged"
+	case EventDeviceOffline:
+		return "EventDeviceOffline"
+	case EventDeviceRebooted:
+		return "EventDeviceRebooted"
+	case EventDeviceConfigChanged:
+		return "EventDeviceConfigChanged"
 	default:
 		return fmt.Sprintf("EventUnknown(%d)", int8(et))
 	}
 }
 
 type Update struct {
-	// The USN of the service.
+	// The USN of the service, or for device-level events, the UDN of the
+	// device.
 	USN string
 	// What happened.
 	EventType EventType
 	// The entry, which is nil if the service was not known and
-	// EventType==EventByeBye. The contents of this must not be modified as it is
-	// shared with the registry and other listeners. Once created, the Registry
-	// does not modify the Entry value - any updates are replaced with a new
-	// Entry value.
+	// EventType==EventByeBye, and for device-level events. The contents of
+	// this must not be modified as it is shared with the registry and other
+	// listeners. Once created, the Registry does not modify the Entry value -
+	// any updates are replaced with a new Entry value.
 	Entry *Entry
+	// The device, for device-level events. For EventDeviceOffline, this is
+	// the device as it last was. As with Entry, the contents of this must not
+	// be modified.
+	Device *Device
+}
+
+// isDeviceEvent reports whether the event is a device-level event.
+func (et EventType) isDeviceEvent() bool {
+	return et >= EventDeviceOnline
 }
 
 type Entry struct {
@@ -67,6 +116,11 @@ type Entry struct {
 	Host   string
 	// Location of the UPnP root device description.
 	Location url.URL
+	// The name of the interface that the entry data was received on, and the
+	// local address on it. Empty if the server did not listen on specific
+	// interfaces, see httpu.Server.Interfaces.
+	Interface string
+	LocalAddr string
 
 	// Despite BOOTID,CONFIGID being required fields, apparently they are not
 	// always set by devices. Set to -1 if not present.
@@ -82,27 +136,40 @@ type Entry struct {
 	CacheExpiry time.Time
 }
 
-func newEntryFromRequest(r *http.Request) (*Entry, error) {
-	now := time.Now()
-	expiryDuration, err := parseCacheControlMaxAge(r.Header.Get("CACHE-CONTROL"))
+func newEntryFromRequest(r *http.Request, now time.Time) (*Entry, error) {
+	entry, err := newEntry(r.Header, r.RemoteAddr, r.Header.Get("NT"), now)
+	if err != nil {
+		return nil, err
+	}
+	entry.Host = r.Header.Get("HOST")
+	entry.Interface = r.Header.Get(httpu.InterfaceHeader)
+	entry.LocalAddr = r.Header.Get(httpu.LocalAddressHeader)
+	return entry, nil
+}
+
+// newEntry creates an entry from the headers of a NOTIFY request or search
+// response, received from remoteAddr, for the notification type nt.
+func newEntry(header http.Header, remoteAddr, nt string, now time.Time) (*Entry, error) {
+	expiryDuration, err := parseCacheControlMaxAge(header.Get("CACHE-CONTROL"))
 	if err != nil {
 		return nil, fmt.Errorf("ssdp: error parsing CACHE-CONTROL max age: %v", err)
 	}
 
-	loc, err := url.Parse(r.Header.Get("LOCATION"))
+	loc, err := url.Parse(header.Get("LOCATION"))
 	if err != nil {
 		return nil, fmt.Errorf("ssdp: error parsing entry Location URL: %v", err)
 	}
+	addZone(loc, zoneOf(remoteAddr))
 
-	bootID, err := parseUpnpIntHeader(r.Header, "BOOTID.UPNP.ORG", -1)
+	bootID, err := parseUpnpIntHeader(header, "BOOTID.UPNP.ORG", -1)
 	if err != nil {
 		return nil, err
 	}
-	configID, err := parseUpnpIntHeader(r.Header, "CONFIGID.UPNP.ORG", -1)
+	configID, err := parseUpnpIntHeader(header, "CONFIGID.UPNP.ORG", -1)
 	if err != nil {
 		return nil, err
 	}
-	searchPort, err := parseUpnpIntHeader(r.Header, "SEARCHPORT.UPNP.ORG", ssdpSearchPort)
+	searchPort, err := parseUpnpIntHeader(header, "SEARCHPORT.UPNP.ORG", ssdpSearchPort)
 	if err != nil {
 		return nil, err
 	}
@@ -112,11 +179,10 @@ func newEntryFromRequest(r *http.Request) (*Entry, error) {
 	}
 
 	return &Entry{
-		RemoteAddr:  r.RemoteAddr,
-		USN:         r.Header.Get("USN"),
-		NT:          r.Header.Get("NT"),
-		Server:      r.Header.Get("SERVER"),
-		Host:        r.Header.Get("HOST"),
+		RemoteAddr:  remoteAddr,
+		USN:         header.Get("USN"),
+		NT:          nt,
+		Server:      header.Get("SERVER"),
 		Location:    *loc,
 		BootID:      bootID,
 		ConfigID:    configID,
@@ -163,23 +229,36 @@ var _ httpu.Handler = new(Registry)
 // NOTE: the interface for this is experimental and may change, or go away
 // entirely.
 type Registry struct {
+	// Now returns the current time, and is time.Now if nil. It may be replaced
+	// before the registry is used, so that tests can control expiry.
+	Now func() time.Time
+	// LocationPolicy, if not nil, validates the locations of announcements,
+	// and announcements with rejected locations are ignored. It may be set
+	// before the registry is used.
+	LocationPolicy *LocationPolicy
+
 	lock  sync.Mutex
 	byUSN map[string]*Entry
+	byUDN map[string]*Device
 
 	listenersLock sync.RWMutex
-	listeners     map[chan<- Update]struct{}
+	subs          map[*Subscription]struct{}
+	listeners     map[chan<- Update]*Subscription
 }
 
 func NewRegistry() *Registry {
 	return &Registry{
 		byUSN:     make(map[string]*Entry),
-		listeners: make(map[chan<- Update]struct{}),
+		byUDN:     make(map[string]*Device),
+		subs:      make(map[*Subscription]struct{}),
+		listeners: make(map[chan<- Update]*Subscription),
 	}
 }
 
 // NewServerAndRegistry is a convenience function to create a registry, and an
 // httpu server to pass it messages. Call ListenAndServe on the server for
-// messages to be processed.
+// messages to be processed. The server only listens over IPv4, see
+// NewServersAndRegistry to also listen over IPv6.
 func NewServerAndRegistry() (*httpu.Server, *Registry) {
 	reg := NewRegistry()
 	srv := &httpu.Server{
@@ -190,36 +269,210 @@ func NewServerAndRegistry() (*httpu.Server, *Registry) {
 	return srv, reg
 }
 
+// NewServersAndRegistry is like NewServerAndRegistry, but the servers listen
+// on each multicast-capable interface, including interfaces that come up
+// later, and there are also servers for the IPv6 link-local and site-local
+// SSDP multicast groups. Entries record the interface that they were received
+// on. The IPv4 server is first. Call ListenAndServe on each server for
+// messages to be processed.
+func NewServersAndRegistry() ([]*httpu.Server, *Registry, error) {
+	reg := NewRegistry()
+	var servers []*httpu.Server
+	for _, addr := range []string{ssdpUDP4Addr, ssdpUDP6LinkLocalAddr, ssdpUDP6SiteLocalAddr} {
+		servers = append(servers, &httpu.Server{
+			Addr:          addr,
+			Multicast:     true,
+			AllInterfaces: true,
+			Handler:       reg,
+		})
+	}
+	return servers, reg, nil
+}
+
+// AddListener sends updates to c, until RemoveListener is called with it.
+// Updates are buffered as for a Subscription with DefaultSubscriptionBuffer
+// and DropOldest, so that a slow listener does not block the registry.
 func (reg *Registry) AddListener(c chan<- Update) {
+	sub := reg.Subscribe(DefaultSubscriptionBuffer, DropOldest)
 	reg.listenersLock.Lock()
-	defer reg.listenersLock.Unlock()
-	reg.listeners[c] = struct{}{}
+	old := reg.listeners[c]
+	reg.listeners[c] = sub
+	reg.listenersLock.Unlock()
+	if old != nil {
+		old.Cancel()
+	}
+
+	go func() {
+		for u := range sub.Updates() {
+			select {
+			case c <- u:
+			case <-sub.cancelled:
+				return
+			}
+		}
+	}()
 }
 
+// RemoveListener stops sending updates to c.
 func (reg *Registry) RemoveListener(c chan<- Update) {
 	reg.listenersLock.Lock()
-	defer reg.listenersLock.Unlock()
+	sub := reg.listeners[c]
 	delete(reg.listeners, c)
+	reg.listenersLock.Unlock()
+	if sub != nil {
+		sub.Cancel()
+	}
+}
+
+// Subscribe returns a new subscription to updates, which buffers up to
+// bufferSize updates (at least 1) that have not yet been received, and applies
+// policy when the buffer is full.
+func (reg *Registry) Subscribe(bufferSize int, policy OverflowPolicy) *Subscription {
+	return reg.subscribe(bufferSize, policy, false)
+}
+
+// SubscribeDevices is like Subscribe, but the subscription receives
+// device-level updates (EventDeviceOnline, EventDeviceChanged,
+// EventDeviceOffline, EventDeviceRebooted and EventDeviceConfigChanged) rather
+// than updates of individual entries.
+func (reg *Registry) SubscribeDevices(bufferSize int, policy OverflowPolicy) *Subscription {
+	return reg.subscribe(bufferSize, policy, true)
 }
 
+func (reg *Registry) subscribe(bufferSize int, policy OverflowPolicy, devices bool) *Subscription {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	sub := &Subscription{
+		reg:       reg,
+		policy:    policy,
+		devices:   devices,
+		updates:   make(chan Update, bufferSize),
+		cancelled: make(chan struct{}),
+	}
+	reg.listenersLock.Lock()
+	reg.subs[sub] = struct{}{}
+	reg.listenersLock.Unlock()
+	return sub
+}
+
+// sendUpdate buffers the update for the subscriptions that receive it, which
+// does not block. The registry holds reg.lock while sending updates, so that
+// each subscription receives them in the order that they happened.
 func (reg *Registry) sendUpdate(u Update) {
 	reg.listenersLock.RLock()
-	defer reg.listenersLock.RUnlock()
-	for c := range reg.listeners {
-		c <- u
+	var disconnected []*Subscription
+	for sub := range reg.subs {
+		if sub.devices != u.EventType.isDeviceEvent() {
+			continue
+		}
+		if !sub.deliver(u) {
+			disconnected = append(disconnected, sub)
+		}
+	}
+	reg.listenersLock.RUnlock()
+
+	for _, sub := range disconnected {
+		sub.Cancel()
+	}
+}
+
+func (reg *Registry) now() time.Time {
+	if reg.Now != nil {
+		return reg.Now()
 	}
+	return time.Now()
+}
+
+// StartSweeper starts removing expired entries every interval (or
+// DefaultSweepInterval if interval is not positive) until the returned stop
+// function is called. Without a sweeper, expired entries are only removed by
+// calls to Sweep.
+func (reg *Registry) StartSweeper(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = DefaultSweepInterval
+	}
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				reg.Sweep()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+// Sweep removes the entries whose cache expiry has passed, and sends an
+// EventExpired update for each.
+func (reg *Registry) Sweep() {
+	now := reg.now()
+	var expired []*Entry
+	var deviceUpdates []Update
+	reg.lock.Lock()
+	for usn, entry := range reg.byUSN {
+		if !now.Before(entry.CacheExpiry) {
+			expired = append(expired, entry)
+			delete(reg.byUSN, usn)
+		}
+	}
+	for _, entry := range expired {
+		udn, _ := SplitUSN(entry.USN)
+		deviceUpdates = append(deviceUpdates, reg.refreshDeviceLocked(udn)...)
+	}
+	for _, entry := range expired {
+		reg.sendUpdate(Update{
+			USN:       entry.USN,
+			EventType: EventExpired,
+			Entry:     entry,
+		})
+	}
+	for _, u := range deviceUpdates {
+		reg.sendUpdate(u)
+	}
+	reg.lock.Unlock()
 }
 
 // GetService returns known service (or device) entries for the given service
-// URN.
+// URN. Entries whose cache expiry has passed are not returned, even if they
+// have not been swept yet.
 func (reg *Registry) GetService(serviceURN string) []*Entry {
 	// Currently assumes that the map is small, so we do a linear search rather
 	// than indexed to avoid maintaining two maps.
 	var results []*Entry
+	now := reg.now()
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+	for _, entry := range reg.byUSN {
+		if entry.NT == serviceURN && now.Before(entry.CacheExpiry) {
+			results = append(results, entry)
+		}
+	}
+	return results
+}
+
+// GetInterfaceEntries returns the unexpired entries last received on the
+// named interface.
+func (reg *Registry) GetInterfaceEntries(iface string) []*Entry {
+	var results []*Entry
+	now := reg.now()
 	reg.lock.Lock()
 	defer reg.lock.Unlock()
 	for _, entry := range reg.byUSN {
-		if entry.NT == serviceURN {
+		if entry.Interface == iface && now.Before(entry.CacheExpiry) {
 			results = append(results, entry)
 		}
 	}
@@ -252,61 +505,101 @@ func (reg *Registry) ServeMessage(r *http.Request) {
 }
 
 func (reg *Registry) handleNTSAlive(r *http.Request) error {
-	entry, err := newEntryFromRequest(r)
+	entry, err := newEntryFromRequest(r, reg.now())
 	if err != nil {
 		return err
 	}
+	if err := reg.checkLocation(entry); err != nil {
+		return err
+	}
+	reg.storeEntry(entry, EventAlive)
+	return nil
+}
+
+// checkLocation checks the entry's location against reg.LocationPolicy.
+func (reg *Registry) checkLocation(entry *Entry) error {
+	if reg.LocationPolicy == nil {
+		return nil
+	}
+	return reg.LocationPolicy.Check(&entry.Location, entry.RemoteAddr)
+}
 
+// storeEntry adds or replaces the entry, and sends the update with the event
+// type, and any device-level updates.
+func (reg *Registry) storeEntry(entry *Entry, eventType EventType) {
 	reg.lock.Lock()
+	defer reg.lock.Unlock()
+	reg.storeEntryLocked(entry, eventType)
+}
+
+// storeEntryLocked is storeEntry, for when reg.lock is already held.
+func (reg *Registry) storeEntryLocked(entry *Entry, eventType EventType) {
+	udn, _ := SplitUSN(entry.USN)
 	reg.byUSN[entry.USN] = entry
-	reg.lock.Unlock()
+	deviceUpdates := reg.refreshDeviceLocked(udn)
 
 	reg.sendUpdate(Update{
 		USN:       entry.USN,
-		EventType: EventAlive,
+		EventType: eventType,
 		Entry:     entry,
 	})
-
-	return nil
+	for _, u := range deviceUpdates {
+		reg.sendUpdate(u)
+	}
 }
 
+// handleNTSUpdate applies an ssdp:update to the existing entry for its USN.
+// An update has no CACHE-CONTROL, so the entry keeps its expiry and location,
+// and takes the new BOOTID and CONFIGID. Updates for unknown entries are
+// ignored, as there is nothing to update until the next ssdp:alive.
 func (reg *Registry) handleNTSUpdate(r *http.Request) error {
-	entry, err := newEntryFromRequest(r)
+	usn := r.Header.Get("USN")
+	nextBootID, err := parseUpnpIntHeader(r.Header, "NEXTBOOTID.UPNP.ORG", -1)
 	if err != nil {
 		return err
 	}
-	nextBootID, err := parseUpnpIntHeader(r.Header, "NEXTBOOTID.UPNP.ORG", -1)
+	if nextBootID < 0 {
+		return errors.New("ssdp: update is missing NEXTBOOTID.UPNP.ORG")
+	}
+	configID, err := parseUpnpIntHeader(r.Header, "CONFIGID.UPNP.ORG", -1)
 	if err != nil {
 		return err
 	}
-	entry.BootID = nextBootID
 
 	reg.lock.Lock()
-	reg.byUSN[entry.USN] = entry
-	reg.lock.Unlock()
-
-	reg.sendUpdate(Update{
-		USN:       entry.USN,
-		EventType: EventUpdate,
-		Entry:     entry,
-	})
-
+	defer reg.lock.Unlock()
+	old := reg.byUSN[usn]
+	if old == nil {
+		return nil
+	}
+	entry := *old
+	entry.BootID = nextBootID
+	if configID >= 0 {
+		entry.ConfigID = configID
+	}
+	entry.LastUpdate = reg.now()
+	reg.storeEntryLocked(&entry, EventUpdate)
 	return nil
 }
 
 func (reg *Registry) handleNTSByebye(r *http.Request) error {
 	usn := r.Header.Get("USN")
 
+	udn, _ := SplitUSN(usn)
 	reg.lock.Lock()
+	defer reg.lock.Unlock()
 	entry := reg.byUSN[usn]
 	delete(reg.byUSN, usn)
-	reg.lock.Unlock()
+	deviceUpdates := reg.refreshDeviceLocked(udn)
 
 	reg.sendUpdate(Update{
 		USN:       usn,
 		EventType: EventByeBye,
 		Entry:     entry,
 	})
+	for _, u := range deviceUpdates {
+		reg.sendUpdate(u)
+	}
 
 	return nil
 }
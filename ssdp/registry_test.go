@@ -0,0 +1,68 @@
+package ssdp
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newNotify(nts, usn, nt string) *http.Request {
+	return &http.Request{
+		Method:     methodNotify,
+		RemoteAddr: "192.168.1.1:1900",
+		Header: http.Header{
+			"Nts":           []string{nts},
+			"Usn":           []string{usn},
+			"Nt":            []string{nt},
+			"Location":      []string{"http://192.168.1.1:80/desc.xml"},
+			"Cache-Control": []string{"max-age=60"},
+		},
+	}
+}
+
+func TestRegistryExpiry(t *testing.T) {
+	const nt = "urn:schemas-upnp-org:device:Basic:1"
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	reg := NewRegistry()
+	reg.Now = func() time.Time { return now }
+	sub := reg.Subscribe(10, DropNewest)
+	updates := sub.Updates()
+
+	reg.ServeMessage(newNotify(ntsAlive, "uuid:1::"+nt, nt))
+	if u := <-updates; u.EventType != EventAlive {
+		t.Fatalf("got %v, want EventAlive", u.EventType)
+	}
+
+	now = now.Add(59 * time.Second)
+	reg.Sweep()
+	if got := len(reg.GetService(nt)); got != 1 {
+		t.Errorf("before expiry: got %d entries, want 1", got)
+	}
+	select {
+	case u := <-updates:
+		t.Errorf("before expiry: got update %v, want none", u.EventType)
+	default:
+	}
+
+	now = now.Add(time.Second)
+	if got := len(reg.GetService(nt)); got != 0 {
+		t.Errorf("after expiry, before sweep: got %d entries, want 0", got)
+	}
+	reg.Sweep()
+	select {
+	case u := <-updates:
+		if u.EventType != EventExpired || u.Entry == nil || u.USN != "uuid:1::"+nt {
+			t.Errorf("got update %+v, want EventExpired for the entry", u)
+		}
+	default:
+		t.Error("after sweep: got no update, want EventExpired")
+	}
+}
+
+func TestRegistryStartSweeper(t *testing.T) {
+	reg := NewRegistry()
+	stop := reg.StartSweeper(time.Millisecond)
+	stop()
+	// Stopping again has no effect.
+	stop()
+}
@@ -0,0 +1,11 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
+
+package ssdp
+
+import "net"
+
+// setMulticastTTL does nothing, as the TTL cannot be set on this platform.
+func setMulticastTTL(conn *net.UDPConn, ttl int) error {
+	return nil
+}
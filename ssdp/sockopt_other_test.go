@@ -0,0 +1,11 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package ssdp
+
+import "net"
+
+// multicastTTL reports that the TTL cannot be read on this platform.
+func multicastTTL(conn *net.UDPConn) (int, bool, error) {
+	return 0, false, nil
+}
@@ -0,0 +1,25 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package ssdp
+
+import (
+	"net"
+	"syscall"
+)
+
+// setMulticastTTL sets the TTL of IPv4 multicast sent from conn.
+func setMulticastTTL(conn *net.UDPConn, ttl int) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_TTL, ttl)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -0,0 +1,26 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package ssdp
+
+import (
+	"net"
+	"syscall"
+)
+
+// multicastTTL returns the TTL of IPv4 multicast sent from conn.
+func multicastTTL(conn *net.UDPConn) (int, bool, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, false, err
+	}
+	var ttl int
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		ttl, sockErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_TTL)
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return ttl, true, sockErr
+}
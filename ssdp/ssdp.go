@@ -3,11 +3,19 @@ package ssdp
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/huin/goupnp/controlpoint"
+	"github.com/huin/goupnp/httpu"
+	"github.com/huin/goupnp/urn"
 )
 
 const (
@@ -20,12 +28,21 @@ const (
 	methodSearch   = "M-SEARCH"
 	methodNotify   = "NOTIFY"
 
+	unicastSearchTimeout = time.Second
+
 	// SSDPAll is a value for searchTarget that searches for all devices and services.
 	SSDPAll = "ssdp:all"
 	// UPNPRootDevice is a value for searchTarget that searches for all root devices.
 	UPNPRootDevice = "upnp:rootdevice"
 )
 
+// The IPv6 SSDP multicast addresses. Link-local addresses are only meaningful
+// with a zone, which httpu clients bound to an IPv6 address fill in.
+const (
+	ssdpUDP6LinkLocalAddr = "[FF02::C]:1900"
+	ssdpUDP6SiteLocalAddr = "[FF05::C]:1900"
+)
+
 // HTTPUClient is the interface required to perform HTTP-over-UDP requests.
 type HTTPUClient interface {
 	Do(
@@ -44,6 +61,27 @@ type HTTPUClientCtx interface {
 	) ([]*http.Response, error)
 }
 
+// HTTPUClientStream is an optional interface that will be used to receive
+// HTTP-over-UDP responses as they arrive if the client implements it.
+type HTTPUClientStream interface {
+	StreamWithContext(
+		req *http.Request,
+		numSends int,
+		handler func(*http.Response),
+	) error
+}
+
+// Searcher sends SSDP searches identifying the control point. The
+// package-level search functions use a zero Searcher.
+type Searcher struct {
+	// Identity identifies the control point in searches. If nil, only a
+	// USER-AGENT with controlpoint.DefaultProduct is sent.
+	Identity *controlpoint.Identity
+	// LocationPolicy, if not nil, validates the locations of responses, and
+	// responses with rejected locations are discarded.
+	LocationPolicy *LocationPolicy
+}
+
 // SSDPRawSearchCtx performs a fairly raw SSDP search request, and returns the
 // unique response(s) that it receives. Each response has the requested
 // searchTarget, a USN, and a valid location. maxWaitSeconds states how long to
@@ -58,7 +96,7 @@ func SSDPRawSearchCtx(
 	maxWaitSeconds int,
 	numSends int,
 ) ([]*http.Response, error) {
-	req, err := prepareRequest(ctx, searchTarget, maxWaitSeconds)
+	req, err := prepareRequest(ctx, ssdpUDP4Addr, searchTarget, maxWaitSeconds, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -67,7 +105,7 @@ func SSDPRawSearchCtx(
 	if err != nil {
 		return nil, err
 	}
-	return processSSDPResponses(searchTarget, allResponses)
+	return processSSDPResponses(searchTarget, allResponses, nil)
 }
 
 // RawSearch performs a fairly raw SSDP search request, and returns the
@@ -76,6 +114,13 @@ func SSDPRawSearchCtx(
 // or is canceled, the search will be aborted. numSends is the number of
 // requests to send - 3 is a reasonable value for this.
 //
+// The search is sent to the IPv4 and the IPv6 link-local and site-local SSDP
+// multicast addresses. IPv6 searches are only sent by httpu clients bound to
+// an IPv6 address, such as those created with httpu.NewHTTPUClientAddr, and
+// failures to send them are not reported, as IPv6 is commonly unavailable.
+// Responses from a device over IPv6 are discarded if the device also
+// responded over IPv4.
+//
 // The provided context should have a deadline, since the SSDP protocol
 // requires the max wait time be included in search requests. If the context
 // has no deadline, then a default deadline of 3 seconds will be applied.
@@ -84,6 +129,17 @@ func RawSearch(
 	httpu HTTPUClientCtx,
 	searchTarget string,
 	numSends int,
+) ([]*http.Response, error) {
+	return (&Searcher{}).RawSearch(ctx, httpu, searchTarget, numSends)
+}
+
+// RawSearch is like the package-level RawSearch, but sends the searcher's
+// identity.
+func (s *Searcher) RawSearch(
+	ctx context.Context,
+	httpu HTTPUClientCtx,
+	searchTarget string,
+	numSends int,
 ) ([]*http.Response, error) {
 	// We need a timeout value to include in the SSDP request; get it by
 	// checking the deadline on the context.
@@ -99,72 +155,352 @@ func RawSearch(
 		defer cancel()
 	}
 
-	req, err := prepareRequest(ctx, searchTarget, maxWaitSeconds)
+	return s.RawSearchMX(ctx, httpu, searchTarget, maxWaitSeconds, numSends)
+}
+
+// RawSearchMX is like RawSearch, but sends maxWaitSeconds as the MX value of
+// the search request rather than deriving it from the context's deadline.
+// Responses are awaited until the context is done, so it must have a deadline
+// or be canceled, and maxWaitSeconds should be no longer than that.
+func RawSearchMX(
+	ctx context.Context,
+	httpu HTTPUClientCtx,
+	searchTarget string,
+	maxWaitSeconds int,
+	numSends int,
+) ([]*http.Response, error) {
+	return (&Searcher{}).RawSearchMX(ctx, httpu, searchTarget, maxWaitSeconds, numSends)
+}
+
+// RawSearchMX is like the package-level RawSearchMX, but sends the searcher's
+// identity.
+func (s *Searcher) RawSearchMX(
+	ctx context.Context,
+	httpu HTTPUClientCtx,
+	searchTarget string,
+	maxWaitSeconds int,
+	numSends int,
+) ([]*http.Response, error) {
+	var responses []*http.Response
+	err := s.RawSearchStream(ctx, httpu, searchTarget, maxWaitSeconds, numSends, func(response *http.Response) {
+		responses = append(responses, response)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return preferIPv4(responses), nil
+}
+
+// RawSearchStream is like RawSearchMX, but calls handler with each unique
+// response as soon as it is received, rather than returning them once the
+// search ends. handler is not called concurrently, nor after RawSearchStream
+// returns. Cancel the context to end the search early.
+//
+// Responses are passed on as they arrive if httpu implements
+// HTTPUClientStream, as httpu.HTTPUClient and httpu.MultiClientCtx do, and
+// otherwise once its DoWithContext returns. A response over IPv6 is skipped if
+// the device has already responded over IPv4, but unlike RawSearchMX, a
+// response over IPv6 that has been passed on is not replaced by a later one
+// over IPv4.
+func RawSearchStream(
+	ctx context.Context,
+	httpu HTTPUClientCtx,
+	searchTarget string,
+	maxWaitSeconds int,
+	numSends int,
+	handler func(*http.Response),
+) error {
+	return (&Searcher{}).RawSearchStream(ctx, httpu, searchTarget, maxWaitSeconds, numSends, handler)
+}
+
+// RawSearchStream is like the package-level RawSearchStream, but sends the
+// searcher's identity.
+func (s *Searcher) RawSearchStream(
+	ctx context.Context,
+	httpu HTTPUClientCtx,
+	searchTarget string,
+	maxWaitSeconds int,
+	numSends int,
+	handler func(*http.Response),
+) error {
+	var reqs []*http.Request
+	for _, addr := range []string{ssdpUDP4Addr, ssdpUDP6LinkLocalAddr, ssdpUDP6SiteLocalAddr} {
+		req, err := prepareRequest(ctx, addr, searchTarget, maxWaitSeconds, s.Identity)
+		if err != nil {
+			return err
+		}
+		reqs = append(reqs, req)
+	}
+
+	filter := newResponseFilter(searchTarget, s.LocationPolicy)
+	var handlerLock sync.Mutex
+	handle := func(response *http.Response) {
+		handlerLock.Lock()
+		defer handlerLock.Unlock()
+		if filter.accept(response) {
+			handler(response)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(reqs))
+	for i, req := range reqs {
+		wg.Add(1)
+		go func(i int, req *http.Request) {
+			defer wg.Done()
+			if streamer, ok := httpu.(HTTPUClientStream); ok {
+				errs[i] = streamer.StreamWithContext(req, numSends, handle)
+				return
+			}
+			var responses []*http.Response
+			if responses, errs[i] = httpu.DoWithContext(req, numSends); errs[i] == nil {
+				for _, response := range responses {
+					handle(response)
+				}
+			}
+		}(i, req)
+	}
+	wg.Wait()
+	// Only the IPv4 search (the first) is required to succeed.
+	return errs[0]
+}
+
+// UnicastSearch sends an SSDP search request directly to the device at host,
+// rather than multicasting it, and returns the unique response(s) that it
+// receives as RawSearch does. This works where multicast is filtered, such as
+// across VPNs, as long as the device is known. host is an IP address, which
+// for IPv6 link-local addresses must include the zone. port is the device's
+// SEARCHPORT.UPNP.ORG value, or 0 for the default SSDP port.
+//
+// Responses are awaited until the context is done. If the context has no
+// deadline, then a default deadline of 1 second is applied, as devices
+// respond to unicast searches without delay.
+func UnicastSearch(
+	ctx context.Context,
+	httpu HTTPUClientCtx,
+	host string,
+	port int,
+	searchTarget string,
+	numSends int,
+) ([]*http.Response, error) {
+	return (&Searcher{}).UnicastSearch(ctx, httpu, host, port, searchTarget, numSends)
+}
+
+// UnicastSearch is like the package-level UnicastSearch, but sends the
+// searcher's identity.
+func (s *Searcher) UnicastSearch(
+	ctx context.Context,
+	httpu HTTPUClientCtx,
+	host string,
+	port int,
+	searchTarget string,
+	numSends int,
+) ([]*http.Response, error) {
+	req, err := prepareUnicastRequest(ctx, host, port, searchTarget, s.Identity)
 	if err != nil {
 		return nil, err
 	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, unicastSearchTimeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
 
 	allResponses, err := httpu.DoWithContext(req, numSends)
 	if err != nil {
 		return nil, err
 	}
-	return processSSDPResponses(searchTarget, allResponses)
+	return processSSDPResponses(searchTarget, allResponses, s.LocationPolicy)
 }
 
 // prepareRequest checks the provided parameters and constructs a SSDP search
 // request to be sent.
-func prepareRequest(ctx context.Context, searchTarget string, maxWaitSeconds int) (*http.Request, error) {
+func prepareRequest(ctx context.Context, host, searchTarget string, maxWaitSeconds int, id *controlpoint.Identity) (*http.Request, error) {
 	if maxWaitSeconds < 1 {
 		return nil, errors.New("ssdp: request timeout must be at least 1s")
 	}
 
+	req := searchRequest(ctx, host, host, searchTarget, id)
+	req.Header["MX"] = []string{strconv.FormatInt(int64(maxWaitSeconds), 10)}
+	return req, nil
+}
+
+// prepareUnicastRequest constructs a SSDP search request to be sent to the
+// device at host and port. Unicast search requests have no MX.
+func prepareUnicastRequest(ctx context.Context, host string, port int, searchTarget string, id *controlpoint.Identity) (*http.Request, error) {
+	if port == 0 {
+		port = ssdpSearchPort
+	}
+	if port < 1 || port > 65535 {
+		return nil, fmt.Errorf("ssdp: search port %d is out of range", port)
+	}
+	ipHost := host
+	if i := strings.LastIndexByte(host, '%'); i >= 0 {
+		ipHost = host[:i]
+	}
+	if net.ParseIP(ipHost) == nil {
+		return nil, fmt.Errorf("ssdp: unicast search host %q is not an IP address", host)
+	}
+	portStr := strconv.Itoa(port)
+	// The zone is needed to send the request, but means nothing to the device.
+	return searchRequest(ctx, net.JoinHostPort(host, portStr), net.JoinHostPort(ipHost, portStr), searchTarget, id), nil
+}
+
+// searchRequest constructs a SSDP search request to send to dest, with the
+// HOST header host, identifying the control point as id.
+func searchRequest(ctx context.Context, dest, host, searchTarget string, id *controlpoint.Identity) *http.Request {
 	req := (&http.Request{
 		Method: methodSearch,
-		// TODO: Support both IPv4 and IPv6.
-		Host: ssdpUDP4Addr,
-		URL:  &url.URL{Opaque: "*"},
+		Host:   dest,
+		URL:    &url.URL{Opaque: "*"},
 		Header: http.Header{
 			// Putting headers in here avoids them being title-cased.
 			// (The UPnP discovery protocol uses case-sensitive headers)
-			"HOST": []string{ssdpUDP4Addr},
-			"MX":   []string{strconv.FormatInt(int64(maxWaitSeconds), 10)},
+			"HOST": []string{host},
 			"MAN":  []string{ssdpDiscover},
 			"ST":   []string{searchTarget},
 		},
 	}).WithContext(ctx)
-	return req, nil
+	id.SetSearchHeaders(req.Header)
+	return req
 }
 
 func processSSDPResponses(
 	searchTarget string,
 	allResponses []*http.Response,
+	policy *LocationPolicy,
 ) ([]*http.Response, error) {
-	isExactSearch := searchTarget != SSDPAll && searchTarget != UPNPRootDevice
-
-	seenIDs := make(map[string]bool)
+	filter := newResponseFilter(searchTarget, policy)
 	var responses []*http.Response
 	for _, response := range allResponses {
-		if response.StatusCode != 200 {
-			log.Printf("ssdp: got response status code %q in search response", response.Status)
-			continue
+		if filter.accept(response) {
+			responses = append(responses, response)
 		}
-		if st := response.Header.Get("ST"); isExactSearch && st != searchTarget {
-			continue
+	}
+	return preferIPv4(responses), nil
+}
+
+// responseFilter selects the unique, valid responses to a search.
+type responseFilter struct {
+	searchTarget  string
+	isExactSearch bool
+	seenIDs       map[string]bool
+	seenIPv4USNs  map[string]bool
+	policy        *LocationPolicy
+}
+
+func newResponseFilter(searchTarget string, policy *LocationPolicy) *responseFilter {
+	return &responseFilter{
+		searchTarget:  searchTarget,
+		isExactSearch: searchTarget != SSDPAll && searchTarget != UPNPRootDevice,
+		seenIDs:       make(map[string]bool),
+		seenIPv4USNs:  make(map[string]bool),
+		policy:        policy,
+	}
+}
+
+// accept reports whether the response should be passed on. It adds the zone
+// to IPv6 link-local locations in accepted responses.
+func (f *responseFilter) accept(response *http.Response) bool {
+	if response.StatusCode != 200 {
+		log.Printf("ssdp: got response status code %q in search response", response.Status)
+		return false
+	}
+	// Devices should respond with the searched for version of their type, but
+	// some respond with their own, later version.
+	if st := response.Header.Get("ST"); f.isExactSearch && !urn.Match(st, f.searchTarget) {
+		return false
+	}
+	usn := response.Header.Get("USN")
+	loc, err := response.Location()
+	if err != nil {
+		// No usable location in search response - discard.
+		return false
+	}
+	if addZone(loc, zoneOf(response.Header.Get(httpu.LocalAddressHeader))) {
+		response.Header.Set("Location", loc.String())
+	}
+	if f.policy != nil {
+		if err := f.policy.Check(loc, response.Header.Get(httpu.RemoteAddressHeader)); err != nil {
+			log.Print(err)
+			return false
+		}
+	}
+	isIPv6 := isIPv6Host(loc.Hostname())
+	if isIPv6 && f.seenIPv4USNs[usn] {
+		return false
+	}
+	id := loc.String() + "\x00" + usn
+	if f.seenIDs[id] {
+		return false
+	}
+	f.seenIDs[id] = true
+	if !isIPv6 {
+		f.seenIPv4USNs[usn] = true
+	}
+	return true
+}
+
+// preferIPv4 removes responses with IPv6 locations from devices that also
+// responded with an IPv4 location.
+func preferIPv4(responses []*http.Response) []*http.Response {
+	seenIPv4USNs := make(map[string]bool)
+	for _, response := range responses {
+		if loc, err := response.Location(); err == nil && !isIPv6Host(loc.Hostname()) {
+			seenIPv4USNs[response.Header.Get("USN")] = true
 		}
-		usn := response.Header.Get("USN")
+	}
+	merged := responses[:0]
+	for _, response := range responses {
 		loc, err := response.Location()
-		if err != nil {
-			// No usable location in search response - discard.
+		if err == nil && isIPv6Host(loc.Hostname()) && seenIPv4USNs[response.Header.Get("USN")] {
 			continue
 		}
-		id := loc.String() + "\x00" + usn
-		if _, alreadySeen := seenIDs[id]; !alreadySeen {
-			seenIDs[id] = true
-			responses = append(responses, response)
-		}
+		merged = append(merged, response)
+	}
+	return merged
+}
+
+// isIPv6Host reports whether the host of a URL is an IPv6 address.
+func isIPv6Host(host string) bool {
+	if i := strings.LastIndexByte(host, '%'); i >= 0 {
+		host = host[:i]
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.To4() == nil
+}
+
+// zoneOf returns the zone of an IP address, or of the host of a host:port
+// address, or "" if it has none.
+func zoneOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
 	}
+	if i := strings.LastIndexByte(addr, '%'); i >= 0 {
+		return addr[i+1:]
+	}
+	return ""
+}
 
-	return responses, nil
+// addZone adds the zone to the host of loc if it is an IPv6 link-local address
+// without one, as devices cannot know the zone that they were discovered in.
+// It reports whether loc was changed.
+func addZone(loc *url.URL, zone string) bool {
+	host := loc.Hostname()
+	if zone == "" || strings.Contains(host, "%") {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.To4() != nil || !ip.IsLinkLocalUnicast() {
+		return false
+	}
+	if port := loc.Port(); port != "" {
+		loc.Host = net.JoinHostPort(host+"%"+zone, port)
+	} else {
+		loc.Host = "[" + host + "%" + zone + "]"
+	}
+	return true
 }
 
 // SSDPRawSearch is the legacy version of SSDPRawSearchCtx, but uses
@@ -0,0 +1,201 @@
+package ssdp
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/huin/goupnp/httpu"
+)
+
+// fakeHTTPUClient responds to searches sent to each host with the locations
+// in responses, as if received on the local address in localAddrs.
+type fakeHTTPUClient struct {
+	responses  map[string][]string
+	localAddrs map[string]string
+
+	lock  sync.Mutex
+	hosts []string
+}
+
+func (c *fakeHTTPUClient) DoWithContext(req *http.Request, numSends int) ([]*http.Response, error) {
+	c.lock.Lock()
+	c.hosts = append(c.hosts, req.Header["HOST"][0])
+	c.lock.Unlock()
+
+	var responses []*http.Response
+	for _, loc := range c.responses[req.Host] {
+		header := http.Header{}
+		header.Set("ST", UPNPRootDevice)
+		header.Set("USN", "uuid:1::upnp:rootdevice")
+		header.Set("Location", loc)
+		header.Set(httpu.LocalAddressHeader, c.localAddrs[req.Host])
+		responses = append(responses, &http.Response{StatusCode: 200, Header: header})
+	}
+	return responses, nil
+}
+
+func TestRawSearchIPv6(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses map[string][]string
+		want      []string
+	}{
+		{
+			name: "IPv4 preferred",
+			responses: map[string][]string{
+				ssdpUDP4Addr:          {"http://192.168.1.1:80/desc.xml"},
+				ssdpUDP6LinkLocalAddr: {"http://[fe80::1]:80/desc.xml"},
+			},
+			want: []string{"http://192.168.1.1:80/desc.xml"},
+		},
+		{
+			name: "IPv6 only, zone added",
+			responses: map[string][]string{
+				ssdpUDP6LinkLocalAddr: {"http://[fe80::1]:80/desc.xml"},
+				ssdpUDP6SiteLocalAddr: {"http://[fd00::1]:80/desc.xml"},
+			},
+			want: []string{
+				"http://[fd00::1]:80/desc.xml",
+				"http://[fe80::1%25eth0]:80/desc.xml",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &fakeHTTPUClient{
+				responses: test.responses,
+				localAddrs: map[string]string{
+					ssdpUDP4Addr:          "192.168.1.2",
+					ssdpUDP6LinkLocalAddr: "fe80::2%eth0",
+					ssdpUDP6SiteLocalAddr: "fd00::2",
+				},
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			responses, err := RawSearch(ctx, client, UPNPRootDevice, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sort.Strings(client.hosts)
+			wantHosts := []string{ssdpUDP4Addr, ssdpUDP6LinkLocalAddr, ssdpUDP6SiteLocalAddr}
+			sort.Strings(wantHosts)
+			if !equalStrings(client.hosts, wantHosts) {
+				t.Errorf("got searches to %q, want %q", client.hosts, wantHosts)
+			}
+
+			var got []string
+			for _, response := range responses {
+				loc, err := response.Location()
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, loc.String())
+			}
+			sort.Strings(got)
+			if !equalStrings(got, test.want) {
+				t.Errorf("got locations %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// streamingHTTPUClient responds to IPv4 searches with a response from each
+// location, then waits for the request to be done.
+type streamingHTTPUClient struct {
+	locations []string
+}
+
+func (c *streamingHTTPUClient) DoWithContext(req *http.Request, numSends int) ([]*http.Response, error) {
+	panic("DoWithContext called on streaming client")
+}
+
+func (c *streamingHTTPUClient) StreamWithContext(req *http.Request, numSends int, handler func(*http.Response)) error {
+	if req.Host == ssdpUDP4Addr {
+		for _, loc := range c.locations {
+			header := http.Header{}
+			header.Set("ST", UPNPRootDevice)
+			header.Set("USN", "uuid:1::upnp:rootdevice")
+			header.Set("Location", loc)
+			handler(&http.Response{StatusCode: 200, Header: header})
+		}
+	}
+	<-req.Context().Done()
+	return nil
+}
+
+func TestRawSearchStream(t *testing.T) {
+	client := &streamingHTTPUClient{locations: []string{
+		"http://192.168.1.1:80/desc.xml",
+		"http://192.168.1.1:80/desc.xml",
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var got []string
+	start := time.Now()
+	err := RawSearchStream(ctx, client, UPNPRootDevice, 1, 1, func(response *http.Response) {
+		got = append(got, response.Header.Get("Location"))
+		// Stop at the first response.
+		cancel()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("search took %v after the first response, want it to end early", elapsed)
+	}
+	if want := client.locations[:1]; !equalStrings(got, want) {
+		t.Errorf("got locations %q, want %q", got, want)
+	}
+}
+
+func TestProcessSSDPResponsesVersions(t *testing.T) {
+	const searchTarget = "urn:schemas-upnp-org:service:WANIPConnection:1"
+	var responses []*http.Response
+	for i, st := range []string{
+		searchTarget,
+		"urn:schemas-upnp-org:service:WANIPConnection:2",
+		"urn:schemas-upnp-org:service:WANPPPConnection:1",
+		"urn:schemas-upnp-org:device:WANIPConnection:2",
+	} {
+		header := http.Header{}
+		header.Set("ST", st)
+		header.Set("USN", "uuid:"+strconv.Itoa(i)+"::"+st)
+		header.Set("Location", "http://192.168.1.1:80/desc.xml")
+		responses = append(responses, &http.Response{StatusCode: 200, Header: header})
+	}
+
+	got, err := processSSDPResponses(searchTarget, responses, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotUSNs []string
+	for _, response := range got {
+		gotUSNs = append(gotUSNs, response.Header.Get("USN"))
+	}
+	want := []string{
+		"uuid:0::" + searchTarget,
+		"uuid:1::urn:schemas-upnp-org:service:WANIPConnection:2",
+	}
+	if !equalStrings(gotUSNs, want) {
+		t.Errorf("got responses %q, want %q", gotUSNs, want)
+	}
+}
@@ -0,0 +1,124 @@
+package ssdp
+
+import (
+	"fmt"
+	"sync"
+)
+
+// DefaultSubscriptionBuffer is the number of updates buffered for listeners
+// added with Registry.AddListener.
+const DefaultSubscriptionBuffer = 64
+
+// OverflowPolicy selects what happens to an update for a Subscription whose
+// buffer is full.
+type OverflowPolicy int8
+
+const (
+	// DropOldest discards the oldest buffered update to make room.
+	DropOldest = OverflowPolicy(iota)
+	// DropNewest discards the new update.
+	DropNewest
+	// Disconnect cancels the subscription, discarding the new update.
+	Disconnect
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case DropOldest:
+		return "DropOldest"
+	case DropNewest:
+		return "DropNewest"
+	case Disconnect:
+		return "Disconnect"
+	default:
+		return fmt.Sprintf("OverflowPolicyUnknown(%d)", int8(p))
+	}
+}
+
+// Subscription receives updates from a Registry, buffering them so that a
+// slow receiver does not delay the registry or other subscriptions. Create
+// one with Registry.Subscribe.
+type Subscription struct {
+	reg       *Registry
+	policy    OverflowPolicy
+	devices   bool
+	updates   chan Update
+	cancelled chan struct{}
+
+	// lock serializes delivery, and protects the following fields.
+	lock         sync.Mutex
+	dropped      uint64
+	closed       bool
+	disconnected bool
+}
+
+// Updates returns the channel of updates. It is closed when the subscription
+// is cancelled, after any buffered updates have been received.
+func (sub *Subscription) Updates() <-chan Update {
+	return sub.updates
+}
+
+// Dropped returns the number of updates that have been discarded because the
+// buffer was full.
+func (sub *Subscription) Dropped() uint64 {
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	return sub.dropped
+}
+
+// Disconnected reports whether the subscription was cancelled because its
+// buffer overflowed with the Disconnect policy.
+func (sub *Subscription) Disconnected() bool {
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	return sub.disconnected
+}
+
+// Cancel ends the subscription. No further updates are buffered, and the
+// updates channel is closed.
+func (sub *Subscription) Cancel() {
+	sub.reg.listenersLock.Lock()
+	delete(sub.reg.subs, sub)
+	sub.reg.listenersLock.Unlock()
+
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	close(sub.cancelled)
+	close(sub.updates)
+}
+
+// deliver buffers the update, and returns false if the subscription should be
+// disconnected.
+func (sub *Subscription) deliver(u Update) bool {
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	if sub.closed {
+		return true
+	}
+	for {
+		select {
+		case sub.updates <- u:
+			return true
+		default:
+		}
+		sub.dropped++
+		switch sub.policy {
+		case DropOldest:
+			select {
+			case <-sub.updates:
+			default:
+				// The receiver made room.
+				sub.dropped--
+			}
+		case DropNewest:
+			return true
+		default:
+			sub.disconnected = true
+			return false
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package ssdp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscriptionOverflow(t *testing.T) {
+	tests := []struct {
+		policy           OverflowPolicy
+		wantUSNs         []string
+		wantDropped      uint64
+		wantDisconnected bool
+	}{
+		{policy: DropOldest, wantUSNs: []string{"2", "3"}, wantDropped: 2},
+		{policy: DropNewest, wantUSNs: []string{"0", "1"}, wantDropped: 2},
+		{policy: Disconnect, wantUSNs: []string{"0", "1"}, wantDropped: 1, wantDisconnected: true},
+	}
+	for _, test := range tests {
+		t.Run(test.policy.String(), func(t *testing.T) {
+			reg := NewRegistry()
+			sub := reg.Subscribe(2, test.policy)
+			other := reg.Subscribe(10, DropNewest)
+			for _, usn := range []string{"0", "1", "2", "3"} {
+				reg.sendUpdate(Update{USN: usn, EventType: EventByeBye})
+			}
+
+			// A disconnected subscription is already cancelled.
+			if !test.wantDisconnected {
+				sub.Cancel()
+			}
+			var got []string
+			for u := range sub.Updates() {
+				got = append(got, u.USN)
+			}
+			if !equalStrings(got, test.wantUSNs) {
+				t.Errorf("got USNs %q, want %q", got, test.wantUSNs)
+			}
+			if got := sub.Dropped(); got != test.wantDropped {
+				t.Errorf("got %d dropped, want %d", got, test.wantDropped)
+			}
+			if got := sub.Disconnected(); got != test.wantDisconnected {
+				t.Errorf("got disconnected %t, want %t", got, test.wantDisconnected)
+			}
+			if got := len(other.Updates()); got != 4 {
+				t.Errorf("other subscription got %d updates, want 4", got)
+			}
+		})
+	}
+}
+
+func TestAddListenerDoesNotBlock(t *testing.T) {
+	reg := NewRegistry()
+	c := make(chan Update) // Never received from.
+	reg.AddListener(c)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2*DefaultSubscriptionBuffer; i++ {
+			reg.sendUpdate(Update{USN: "uuid:1", EventType: EventByeBye})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sending updates blocked on listener")
+	}
+	reg.RemoveListener(c)
+}
@@ -0,0 +1,89 @@
+// Package urn parses the URNs of UPnP device and service types, such as
+// "urn:schemas-upnp-org:service:WANIPConnection:2", and matches them by
+// version. As UDA requires devices and services to be backward compatible, a
+// type with a higher version can be used in place of an earlier one.
+//
+// NOTE: the interface for this is experimental and may change, or go away
+// entirely.
+package urn
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Kinds of type.
+const (
+	KindDevice  = "device"
+	KindService = "service"
+)
+
+// URN is a parsed device or service type URN.
+type URN struct {
+	// Domain is the domain name of the organisation that defined the type,
+	// with periods replaced by hyphens, e.g. "schemas-upnp-org".
+	Domain string
+	// Kind is KindDevice or KindService.
+	Kind string
+	// Type is the name of the type, e.g. "WANIPConnection".
+	Type string
+	// Version is the version of the type, from 1.
+	Version int
+}
+
+// Parse parses a device or service type URN of the form
+// "urn:domain:device:type:version" or "urn:domain:service:type:version".
+func Parse(s string) (URN, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 5 || parts[0] != "urn" {
+		return URN{}, fmt.Errorf("urn: %q is not a device or service type", s)
+	}
+	u := URN{Domain: parts[1], Kind: parts[2], Type: parts[3]}
+	if u.Domain == "" || u.Type == "" {
+		return URN{}, fmt.Errorf("urn: %q has an empty domain or type", s)
+	}
+	if u.Kind != KindDevice && u.Kind != KindService {
+		return URN{}, fmt.Errorf("urn: %q has unknown kind %q", s, u.Kind)
+	}
+	version, err := strconv.Atoi(parts[4])
+	if err != nil || version < 1 {
+		return URN{}, fmt.Errorf("urn: %q has bad version %q", s, parts[4])
+	}
+	u.Version = version
+	return u, nil
+}
+
+// String returns the URN in its text form.
+func (u URN) String() string {
+	return "urn:" + u.Domain + ":" + u.Kind + ":" + u.Type + ":" + strconv.Itoa(u.Version)
+}
+
+// SameType reports whether u and other are the same type, of any version.
+func (u URN) SameType(other URN) bool {
+	return u.Domain == other.Domain && u.Kind == other.Kind && u.Type == other.Type
+}
+
+// Satisfies reports whether a device or service of type u can be used as one
+// of type want, as it is the same type, with at least the version of want.
+func (u URN) Satisfies(want URN) bool {
+	return u.SameType(want) && u.Version >= want.Version
+}
+
+// Match reports whether a device or service of type have can be used as one
+// of type want. Types that are not URNs, such as "upnp:rootdevice" or UDNs,
+// only match if they are equal.
+func Match(have, want string) bool {
+	if have == want {
+		return true
+	}
+	haveURN, err := Parse(have)
+	if err != nil {
+		return false
+	}
+	wantURN, err := Parse(want)
+	if err != nil {
+		return false
+	}
+	return haveURN.Satisfies(wantURN)
+}
@@ -0,0 +1,66 @@
+package urn
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    URN
+		wantErr bool
+	}{
+		{
+			s:    "urn:schemas-upnp-org:service:WANIPConnection:2",
+			want: URN{Domain: "schemas-upnp-org", Kind: KindService, Type: "WANIPConnection", Version: 2},
+		},
+		{
+			s:    "urn:dial-multiscreen-org:device:dial:1",
+			want: URN{Domain: "dial-multiscreen-org", Kind: KindDevice, Type: "dial", Version: 1},
+		},
+		{s: "upnp:rootdevice", wantErr: true},
+		{s: "uuid:1234", wantErr: true},
+		{s: "urn:schemas-upnp-org:service:WANIPConnection", wantErr: true},
+		{s: "urn:schemas-upnp-org:serviceId:WANIPConn:1", wantErr: true},
+		{s: "urn:schemas-upnp-org:service:WANIPConnection:0", wantErr: true},
+		{s: "urn:schemas-upnp-org:service:WANIPConnection:x", wantErr: true},
+		{s: "urn::service:WANIPConnection:1", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.s)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("Parse(%q) got error %v, want error: %t", test.s, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", test.s, got, test.want)
+		}
+		if err == nil && got.String() != test.s {
+			t.Errorf("Parse(%q).String() = %q", test.s, got.String())
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	const (
+		ip1  = "urn:schemas-upnp-org:service:WANIPConnection:1"
+		ip2  = "urn:schemas-upnp-org:service:WANIPConnection:2"
+		ppp1 = "urn:schemas-upnp-org:service:WANPPPConnection:1"
+	)
+	tests := []struct {
+		have, want string
+		match      bool
+	}{
+		{ip1, ip1, true},
+		{ip2, ip1, true},
+		{ip1, ip2, false},
+		{ppp1, ip1, false},
+		{"urn:schemas-upnp-org:device:WANIPConnection:2", ip1, false},
+		{"urn:example-com:service:WANIPConnection:2", ip1, false},
+		{"upnp:rootdevice", "upnp:rootdevice", true},
+		{"uuid:1", "uuid:2", false},
+	}
+	for _, test := range tests {
+		if got := Match(test.have, test.want); got != test.match {
+			t.Errorf("Match(%q, %q) = %t, want %t", test.have, test.want, got, test.match)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
 	"errors"
 	"flag"
@@ -23,6 +24,7 @@ import (
 	"github.com/huin/goupnp/v2alpha/description/typedesc"
 	"github.com/huin/goupnp/v2alpha/description/xmlsrvdesc"
 	"github.com/huin/goupnp/v2alpha/soap"
+	"github.com/huin/goupnp/v2alpha/soap/server"
 	"golang.org/x/exp/maps"
 
 	soaptypes "github.com/huin/goupnp/v2alpha/soap/types"
@@ -38,7 +40,13 @@ var (
 			"https://openconnectivity.org/upnp-specs/upnpresources.zip.")
 )
 
-const soapActionInterface = "SOAPActionInterface"
+// Names of non-SOAP types that are referenced by the template.
+const (
+	soapActionInterface  = "SOAPActionInterface"
+	soapServiceInterface = "SOAPServiceInterface"
+	soapUPnPError        = "SOAPUPnPError"
+	contextInterface     = "ContextInterface"
+)
 
 func main() {
 	flag.Parse()
@@ -99,6 +107,15 @@ func run() error {
 	typeMap[soapActionInterface] = typedesc.TypeDesc{
 		GoType: reflect.TypeOf((*soap.Action)(nil)).Elem(),
 	}
+	typeMap[soapServiceInterface] = typedesc.TypeDesc{
+		GoType: reflect.TypeOf((*server.Service)(nil)).Elem(),
+	}
+	typeMap[soapUPnPError] = typedesc.TypeDesc{
+		GoType: reflect.TypeOf(server.UPnPError{}),
+	}
+	typeMap[contextInterface] = typedesc.TypeDesc{
+		GoType: reflect.TypeOf((*context.Context)(nil)).Elem(),
+	}
 
 	for _, m := range manifests.DCPS {
 		if err := processDCP(upnpresources, m, typeMap, tmpl, *outputDir); err != nil {
@@ -294,6 +311,9 @@ func accumulateTypes(
 ) (*types, error) {
 	typeNames := make(map[string]struct{})
 	typeNames[soapActionInterface] = struct{}{}
+	typeNames[soapServiceInterface] = struct{}{}
+	typeNames[soapUPnPError] = struct{}{}
+	typeNames[contextInterface] = struct{}{}
 
 	var stringVarDefs []stringVarDef
 	sortedVarNames := maps.Keys(srvDesc.VariableByName)
@@ -68,14 +68,37 @@ func WithHTTPClient(httpClient HTTPClient) Option {
 	}
 }
 
+// Identity identifies the control point making requests, see WithIdentity.
+type Identity struct {
+	// UserAgent is the User-Agent header value, of the form
+	// "OS/version UPnP/2.0 product/version". The HTTP client's default if
+	// empty.
+	UserAgent string
+	// FriendlyName is sent as CPFN.UPNP.ORG, as defined by UDA 2.0, if not
+	// empty.
+	FriendlyName string
+	// UUID is sent as CPUUID.UPNP.ORG, as defined by UDA 2.0, if not empty.
+	UUID string
+}
+
+// WithIdentity identifies the control point in requests. Some devices
+// throttle or misbehave with control points that do not identify themselves.
+func WithIdentity(identity Identity) Option {
+	return func(o *options) {
+		o.identity = identity
+	}
+}
+
 type options struct {
 	httpClient HTTPClient
+	identity   Identity
 }
 
 // Client is a SOAP client, attached to a specific SOAP endpoint.
 // the zero value is not usable, use NewClient() to create an instance.
 type Client struct {
 	httpClient  HTTPClient
+	identity    Identity
 	endpointURL string
 }
 
@@ -90,6 +113,7 @@ func New(endpointURL string, opts ...Option) *Client {
 	}
 	return &Client{
 		httpClient:  co.httpClient,
+		identity:    co.identity,
 		endpointURL: endpointURL,
 	}
 }
@@ -107,6 +131,7 @@ func (c *Client) Do(
 	if err := SetRequestAction(req, actionIn); err != nil {
 		return err
 	}
+	c.setIdentity(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -124,6 +149,19 @@ func (c *Client) Do(
 	return ParseResponseAction(resp, actionOut)
 }
 
+// setIdentity sets the headers identifying the control point in req.
+func (c *Client) setIdentity(req *http.Request) {
+	if c.identity.UserAgent != "" {
+		req.Header.Set("User-Agent", c.identity.UserAgent)
+	}
+	if c.identity.FriendlyName != "" {
+		req.Header["CPFN.UPNP.ORG"] = []string{c.identity.FriendlyName}
+	}
+	if c.identity.UUID != "" {
+		req.Header["CPUUID.UPNP.ORG"] = []string{c.identity.UUID}
+	}
+}
+
 // PerformAction makes a SOAP request, with the given action.
 //
 // This is a convenience for calling `Client.Do` without creating
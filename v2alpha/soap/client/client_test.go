@@ -44,6 +44,7 @@ var _ http.Handler = &fakeSoapServer{}
 type fakeSoapServer struct {
 	responses map[actionKey]*envelope.Action
 	errors    []error
+	headers   []http.Header
 }
 
 func (fss *fakeSoapServer) badRequest(w http.ResponseWriter, err error) {
@@ -57,6 +58,7 @@ func (fss *fakeSoapServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		fss.badRequest(w, fmt.Errorf("want POST, got %q", r.Method))
 		return
 	}
+	fss.headers = append(fss.headers, r.Header)
 	actions := r.Header.Values("SOAPACTION")
 	if len(actions) != 1 {
 		fss.badRequest(w, fmt.Errorf("want exactly 1 SOAPACTION, got %d: %q", len(actions), actions))
@@ -105,7 +107,12 @@ func TestPerformAction(t *testing.T) {
 	ts := httptest.NewServer(service)
 	t.Cleanup(ts.Close)
 
-	c := New(ts.URL + "/endpointpath")
+	identity := Identity{
+		UserAgent:    "Linux/5.10 UPnP/2.0 test/1.0",
+		FriendlyName: "Test",
+		UUID:         "uuid:1",
+	}
+	c := New(ts.URL+"/endpointpath", WithIdentity(identity))
 
 	a := &Action{
 		req: ActionArgs{Name: "World"},
@@ -122,4 +129,16 @@ func TestPerformAction(t *testing.T) {
 	for _, err := range service.errors {
 		t.Errorf("Service error: %v", err)
 	}
+	for _, h := range service.headers {
+		if got := h.Get("User-Agent"); got != identity.UserAgent {
+			t.Errorf("got User-Agent %q, want %q", got, identity.UserAgent)
+		}
+		// The server canonicalizes header names.
+		if got := h.Get("CPFN.UPNP.ORG"); got != identity.FriendlyName {
+			t.Errorf("got CPFN.UPNP.ORG %q, want %q", got, identity.FriendlyName)
+		}
+		if got := h.Get("CPUUID.UPNP.ORG"); got != identity.UUID {
+			t.Errorf("got CPUUID.UPNP.ORG %q, want %q", got, identity.UUID)
+		}
+	}
 }
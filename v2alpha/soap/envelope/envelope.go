@@ -22,7 +22,7 @@ type FaultDetail struct {
 type Fault struct {
 	Code   string      `xml:"faultcode"`
 	String string      `xml:"faultstring"`
-	Actor  string      `xml:"faultactor"`
+	Actor  string      `xml:"faultactor,omitempty"`
 	Detail FaultDetail `xml:"detail"`
 }
 
@@ -222,6 +222,26 @@ func Write(w io.Writer, action *Action) error {
 	return err
 }
 
+// WriteFault marshals a SOAP envelope containing the fault to the writer.
+// Errors can be from the writer or XML encoding.
+func WriteFault(w io.Writer, fault *Fault) error {
+	_, err := w.Write(envOpen)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	// Hardcodes the SOAP namespace prefix, as in Write().
+	err = enc.EncodeElement(fault, xml.StartElement{Name: xml.Name{Local: "s:Fault"}})
+	if err != nil {
+		return err
+	}
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+	_, err = w.Write(envClose)
+	return err
+}
+
 // Read unmarshals a SOAP envelope from the reader. Errors can either be from
 // the reader, XML decoding, or a *Fault.
 func Read(r io.Reader, action *Action) error {
@@ -244,6 +264,70 @@ func Read(r io.Reader, action *Action) error {
 	return nil
 }
 
+// ReadRequest unmarshals a SOAP envelope containing an action request from the
+// reader. newArgs is called with the name of the action, and returns the value
+// to decode the action's arguments into. Errors can be from the reader, XML
+// decoding, or newArgs.
+func ReadRequest(r io.Reader, newArgs func(name xml.Name) (any, error)) (*Action, error) {
+	env := requestEnvelope{
+		Body: requestBody{
+			newArgs: newArgs,
+		},
+	}
+
+	dec := xml.NewDecoder(r)
+	err := dec.Decode(&env)
+	if err != nil {
+		return nil, err
+	}
+
+	return env.Body.action, nil
+}
+
+type requestEnvelope struct {
+	XMLName xml.Name    `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Body    requestBody `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+}
+
+// requestBody decodes the single action in the body of a request, where the
+// type of its arguments depends on the action name.
+type requestBody struct {
+	newArgs func(name xml.Name) (any, error)
+	action  *Action
+}
+
+var _ xml.Unmarshaler = &requestBody{}
+
+// UnmarshalXML implements `xml.Unmarshaller`.
+func (b *requestBody) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for {
+		untypedToken, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch token := untypedToken.(type) {
+		case xml.StartElement:
+			if b.action != nil {
+				return errors.New("SOAP body contains more than one action")
+			}
+			args, err := b.newArgs(token.Name)
+			if err != nil {
+				return err
+			}
+			action := &Action{Args: args}
+			if err := action.UnmarshalXML(d, token); err != nil {
+				return err
+			}
+			b.action = action
+		case xml.EndElement:
+			if b.action == nil {
+				return errors.New("SOAP body contains no action")
+			}
+			return nil
+		}
+	}
+}
+
 type envelope struct {
 	XMLName       xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
 	EncodingStyle string   `xml:"http://schemas.xmlsoap.org/soap/envelope/ encodingStyle,attr"`
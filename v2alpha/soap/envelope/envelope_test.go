@@ -186,3 +186,58 @@ func TestFault(t *testing.T) {
 		})
 	}
 }
+
+func TestReadRequest(t *testing.T) {
+	actionIn := NewSendAction("urn:schemas-upnp-org:service:FakeService:1", "MyAction", &testStructArgs{
+		Foo: "foo-1",
+		Bar: "bar-2",
+	})
+	buf := &bytes.Buffer{}
+	if err := Write(buf, actionIn); err != nil {
+		t.Fatalf("Write want success, got err=%v", err)
+	}
+
+	var gotName xml.Name
+	argsOut := &testStructArgs{}
+	actionOut, err := ReadRequest(buf, func(name xml.Name) (any, error) {
+		gotName = name
+		return argsOut, nil
+	})
+	if err != nil {
+		t.Fatalf("ReadRequest want success, got err=%v", err)
+	}
+	if gotName != actionIn.XMLName {
+		t.Errorf("want newArgs called with %v, got %v", actionIn.XMLName, gotName)
+	}
+	if diff := cmp.Diff(actionIn, actionOut); diff != "" {
+		t.Errorf("\nwant actionOut=%+v\ngot  %+v\ndiff:\n%s", actionIn, actionOut, diff)
+	}
+
+	wantErr := errors.New("unknown action")
+	_, err = ReadRequest(bytes.NewBufferString(string(envOpen)+`<u:Other xmlns:u="urn:x"/>`+string(envClose)),
+		func(name xml.Name) (any, error) { return nil, wantErr })
+	if !errors.Is(err, wantErr) {
+		t.Errorf("want err=%v from newArgs, got %v", wantErr, err)
+	}
+}
+
+func TestWriteFault(t *testing.T) {
+	fault := &Fault{
+		Code:   "s:Client",
+		String: "UPnPError",
+		Detail: FaultDetail{Raw: []byte("<UPnPError><errorCode>401</errorCode></UPnPError>")},
+	}
+	buf := &bytes.Buffer{}
+	if err := WriteFault(buf, fault); err != nil {
+		t.Fatalf("WriteFault want success, got err=%v", err)
+	}
+
+	err := Read(buf, NewRecvAction(&testStructArgs{}))
+	gotFault, ok := err.(*Fault)
+	if !ok {
+		t.Fatalf("want *Fault, got %T (%v)", err, err)
+	}
+	if !reflect.DeepEqual(fault, gotFault) {
+		t.Errorf("want %+v, got %+v", fault, gotFault)
+	}
+}
@@ -0,0 +1,206 @@
+// Package server provides a basic SOAP server, for hosting UPnP services.
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/huin/goupnp/v2alpha/soap"
+	"github.com/huin/goupnp/v2alpha/soap/envelope"
+)
+
+const (
+	// maxRequestBytes limits the size of request bodies accepted by Handler.
+	maxRequestBytes = 1 << 20
+)
+
+// UPnP error codes for SOAP faults, as described by section 3.2.2 "Action
+// Response" in
+// http://upnp.org/specs/arch/UPnP-arch-DeviceArchitecture-v1.1.pdf
+const (
+	ErrorCodeInvalidAction                = 401
+	ErrorCodeInvalidArgs                  = 402
+	ErrorCodeActionFailed                 = 501
+	ErrorCodeArgumentValueInvalid         = 600
+	ErrorCodeArgumentValueOutOfRange      = 601
+	ErrorCodeOptionalActionNotImplemented = 602
+	ErrorCodeOutOfMemory                  = 603
+	ErrorCodeHumanInterventionRequired    = 604
+	ErrorCodeStringArgumentTooLong        = 605
+)
+
+var errorDescriptions = map[int]string{
+	ErrorCodeInvalidAction:                "Invalid Action",
+	ErrorCodeInvalidArgs:                  "Invalid Args",
+	ErrorCodeActionFailed:                 "Action Failed",
+	ErrorCodeArgumentValueInvalid:         "Argument Value Invalid",
+	ErrorCodeArgumentValueOutOfRange:      "Argument Value Out of Range",
+	ErrorCodeOptionalActionNotImplemented: "Optional Action Not Implemented",
+	ErrorCodeOutOfMemory:                  "Out of Memory",
+	ErrorCodeHumanInterventionRequired:    "Human Intervention Required",
+	ErrorCodeStringArgumentTooLong:        "String Argument Too Long",
+}
+
+// UPnPError is an error that is reported to the client as a SOAP fault with
+// the given UPnP error code and description. Errors returned by a Service that
+// are not (and do not wrap) a *UPnPError are reported with
+// ErrorCodeActionFailed.
+type UPnPError struct {
+	Code        int
+	Description string
+}
+
+// NewUPnPError creates a UPnPError with the standard description for the
+// code, if there is one.
+func NewUPnPError(code int) *UPnPError {
+	return &UPnPError{Code: code, Description: errorDescriptions[code]}
+}
+
+func (e *UPnPError) Error() string {
+	return fmt.Sprintf("UPnP error %d: %s", e.Code, e.Description)
+}
+
+// Service is implemented by the generated Dispatcher of each service type,
+// and by hand-written services.
+type Service interface {
+	// ServiceType returns the service type, e.g.
+	// "urn:schemas-upnp-org:service:Foo:1".
+	ServiceType() string
+	// NewAction returns a new action value for the named action, or nil if
+	// the service does not define the action.
+	NewAction(actionName string) soap.Action
+	// Perform performs the action, whose request has been decoded, and fills
+	// in its response.
+	Perform(ctx context.Context, action soap.Action) error
+}
+
+var _ http.Handler = &Handler{}
+
+// Handler is an http.Handler that serves SOAP control requests for a single
+// service.
+type Handler struct {
+	service Service
+}
+
+// NewHandler creates a Handler for the service.
+func NewHandler(service Service) *Handler {
+	return &Handler{service: service}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBytes+1))
+	if err != nil {
+		writeFault(w, &UPnPError{Code: ErrorCodeActionFailed, Description: err.Error()})
+		return
+	}
+	if len(body) > maxRequestBytes {
+		writeFault(w, &UPnPError{Code: ErrorCodeActionFailed, Description: "request too large"})
+		return
+	}
+
+	var action soap.Action
+	_, err = envelope.ReadRequest(bytes.NewReader(body), func(name xml.Name) (any, error) {
+		if name.Space != h.service.ServiceType() {
+			return nil, NewUPnPError(ErrorCodeInvalidAction)
+		}
+		if action = h.service.NewAction(name.Local); action == nil {
+			return nil, NewUPnPError(ErrorCodeInvalidAction)
+		}
+		return action.RefRequest(), nil
+	})
+	if err != nil {
+		var upnpErr *UPnPError
+		switch {
+		case errors.As(err, &upnpErr):
+			writeFault(w, upnpErr)
+		case action != nil:
+			// The action was known, so its arguments failed to decode.
+			writeFault(w, &UPnPError{Code: ErrorCodeInvalidArgs, Description: err.Error()})
+		default:
+			writeFault(w, &UPnPError{Code: ErrorCodeInvalidAction, Description: "malformed envelope: " + err.Error()})
+		}
+		return
+	}
+
+	if header := r.Header.Get("SOAPACTION"); header != "" {
+		want := action.ServiceType() + "#" + action.ActionName()
+		if strings.Trim(strings.TrimSpace(header), `"`) != want {
+			writeFault(w, &UPnPError{
+				Code:        ErrorCodeInvalidAction,
+				Description: fmt.Sprintf("SOAPACTION %q does not match envelope", header),
+			})
+			return
+		}
+	}
+
+	if err := h.service.Perform(r.Context(), action); err != nil {
+		var upnpErr *UPnPError
+		if !errors.As(err, &upnpErr) {
+			upnpErr = &UPnPError{Code: ErrorCodeActionFailed, Description: err.Error()}
+		}
+		writeFault(w, upnpErr)
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	actionOut := envelope.NewSendAction(
+		action.ServiceType(), action.ActionName()+"Response", action.RefResponse())
+	if err := envelope.Write(buf, actionOut); err != nil {
+		writeFault(w, &UPnPError{Code: ErrorCodeActionFailed, Description: "encoding response: " + err.Error()})
+		return
+	}
+	writeEnvelope(w, http.StatusOK, buf.Bytes())
+}
+
+// upnpErrorDetail is the XML form of a UPnPError in a fault detail.
+type upnpErrorDetail struct {
+	XMLName     xml.Name `xml:"urn:schemas-upnp-org:control-1-0 UPnPError"`
+	Code        int      `xml:"errorCode"`
+	Description string   `xml:"errorDescription"`
+}
+
+// writeFault writes a SOAP fault envelope for the error.
+func writeFault(w http.ResponseWriter, upnpErr *UPnPError) {
+	detail, err := xml.Marshal(upnpErrorDetail{
+		Code:        upnpErr.Code,
+		Description: upnpErr.Description,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	buf := &bytes.Buffer{}
+	err = envelope.WriteFault(buf, &envelope.Fault{
+		Code:   "s:Client",
+		String: "UPnPError",
+		Detail: envelope.FaultDetail{Raw: detail},
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeEnvelope(w, http.StatusInternalServerError, buf.Bytes())
+}
+
+func writeEnvelope(w http.ResponseWriter, status int, body []byte) {
+	header := w.Header()
+	header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	header["EXT"] = []string{""}
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/huin/goupnp/v2alpha/soap"
+	"github.com/huin/goupnp/v2alpha/soap/client"
+	"github.com/huin/goupnp/v2alpha/soap/envelope"
+	"github.com/huin/goupnp/v2alpha/soap/types"
+)
+
+const serviceType = "urn:schemas-upnp-org:service:FakeService:1"
+
+type addAction struct {
+	req  addArgs
+	resp addReply
+}
+
+var _ soap.Action = &addAction{}
+
+func (a *addAction) ServiceType() string { return serviceType }
+func (a *addAction) ActionName() string  { return "Add" }
+func (a *addAction) RefRequest() any     { return &a.req }
+func (a *addAction) RefResponse() any    { return &a.resp }
+
+type addArgs struct {
+	A types.UI4
+	B types.UI4
+}
+type addReply struct {
+	Sum types.UI4
+}
+
+// fakeService is what a generated Dispatcher does, for a single action.
+type fakeService struct{}
+
+var _ Service = fakeService{}
+
+func (fakeService) ServiceType() string { return serviceType }
+
+func (fakeService) NewAction(actionName string) soap.Action {
+	if actionName == "Add" {
+		return &addAction{}
+	}
+	return nil
+}
+
+func (fakeService) Perform(ctx context.Context, action soap.Action) error {
+	a, ok := action.(*addAction)
+	if !ok {
+		return NewUPnPError(ErrorCodeInvalidAction)
+	}
+	if a.req.A == 0 {
+		return errors.New("zero is not allowed")
+	}
+	if a.req.B == 0 {
+		return &UPnPError{Code: ErrorCodeArgumentValueOutOfRange, Description: "B is zero"}
+	}
+	a.resp.Sum = a.req.A + a.req.B
+	return nil
+}
+
+func TestHandlerAction(t *testing.T) {
+	ts := httptest.NewServer(NewHandler(fakeService{}))
+	t.Cleanup(ts.Close)
+
+	c := client.New(ts.URL)
+	action := &addAction{req: addArgs{A: 2, B: 3}}
+	if err := client.PerformAction(context.Background(), c, action); err != nil {
+		t.Fatalf("PerformAction want success, got err=%v", err)
+	}
+	if got, want := action.resp.Sum, types.UI4(5); got != want {
+		t.Errorf("got Sum=%d, want %d", got, want)
+	}
+}
+
+func TestHandlerFaults(t *testing.T) {
+	ts := httptest.NewServer(NewHandler(fakeService{}))
+	t.Cleanup(ts.Close)
+
+	tests := []struct {
+		name     string
+		action   *envelope.Action
+		wantCode int
+	}{
+		{
+			"unknown action",
+			envelope.NewSendAction(serviceType, "Subtract", &addArgs{A: 1, B: 1}),
+			ErrorCodeInvalidAction,
+		},
+		{
+			"wrong service type",
+			envelope.NewSendAction("urn:schemas-upnp-org:service:Other:1", "Add", &addArgs{A: 1, B: 1}),
+			ErrorCodeInvalidAction,
+		},
+		{
+			"bad arg",
+			envelope.NewSendAction(serviceType, "Add", map[string]string{"A": "x", "B": "1"}),
+			ErrorCodeInvalidArgs,
+		},
+		{
+			"plain error",
+			envelope.NewSendAction(serviceType, "Add", &addArgs{A: 0, B: 1}),
+			ErrorCodeActionFailed,
+		},
+		{
+			"UPnP error",
+			envelope.NewSendAction(serviceType, "Add", &addArgs{A: 1, B: 0}),
+			ErrorCodeArgumentValueOutOfRange,
+		},
+	}
+
+	for _, test := range tests {
+		test := test // copy for closure
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, ts.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := client.SetRequestAction(req, test.action); err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if got, want := resp.StatusCode, http.StatusInternalServerError; got != want {
+				t.Errorf("got HTTP status %d, want %d", got, want)
+			}
+
+			err = envelope.Read(resp.Body, envelope.NewRecvAction(&addReply{}))
+			var fault *envelope.Fault
+			if !errors.As(err, &fault) {
+				t.Fatalf("want *envelope.Fault, got err=%v", err)
+			}
+			var detail upnpErrorDetail
+			if err := xml.Unmarshal(bytes.TrimSpace(fault.Detail.Raw), &detail); err != nil {
+				t.Fatalf("want UPnPError detail, got %q: %v", fault.Detail.Raw, err)
+			}
+			if detail.Code != test.wantCode {
+				t.Errorf("got errorCode=%d, want %d (%s)", detail.Code, test.wantCode, detail.Description)
+			}
+		})
+	}
+}
@@ -4,8 +4,10 @@
 package lanhostcfgmgmt1
 
 import (
-	pkg1 "github.com/huin/goupnp/v2alpha/soap"
-	pkg2 "github.com/huin/goupnp/v2alpha/soap/types"
+	pkg1 "context"
+	pkg2 "github.com/huin/goupnp/v2alpha/soap"
+	pkg3 "github.com/huin/goupnp/v2alpha/soap/server"
+	pkg4 "github.com/huin/goupnp/v2alpha/soap/types"
 )
 
 const ServiceType = "urn:schemas-upnp-org:service:LANHostConfigManagement:1"
@@ -18,7 +20,7 @@ type DeleteDNSServer struct {
 	Response DeleteDNSServerResponse
 }
 
-var _ pkg1.Action = &DeleteDNSServer{}
+var _ pkg2.Action = &DeleteDNSServer{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *DeleteDNSServer) ServiceType() string { return ServiceType }
@@ -49,7 +51,7 @@ type DeleteIPRouter struct {
 	Response DeleteIPRouterResponse
 }
 
-var _ pkg1.Action = &DeleteIPRouter{}
+var _ pkg2.Action = &DeleteIPRouter{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *DeleteIPRouter) ServiceType() string { return ServiceType }
@@ -80,7 +82,7 @@ type DeleteReservedAddress struct {
 	Response DeleteReservedAddressResponse
 }
 
-var _ pkg1.Action = &DeleteReservedAddress{}
+var _ pkg2.Action = &DeleteReservedAddress{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *DeleteReservedAddress) ServiceType() string { return ServiceType }
@@ -111,7 +113,7 @@ type GetAddressRange struct {
 	Response GetAddressRangeResponse
 }
 
-var _ pkg1.Action = &GetAddressRange{}
+var _ pkg2.Action = &GetAddressRange{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetAddressRange) ServiceType() string { return ServiceType }
@@ -144,7 +146,7 @@ type GetDHCPRelay struct {
 	Response GetDHCPRelayResponse
 }
 
-var _ pkg1.Action = &GetDHCPRelay{}
+var _ pkg2.Action = &GetDHCPRelay{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetDHCPRelay) ServiceType() string { return ServiceType }
@@ -164,7 +166,7 @@ type GetDHCPRelayRequest struct{}
 // GetDHCPRelayResponse contains the "out" args for the "GetDHCPRelay" action.
 type GetDHCPRelayResponse struct {
 	// NewDHCPRelay relates to state variable DHCPRelay.
-	NewDHCPRelay pkg2.Boolean
+	NewDHCPRelay pkg4.Boolean
 }
 
 // GetDHCPServerConfigurable provides request and response for the action.
@@ -175,7 +177,7 @@ type GetDHCPServerConfigurable struct {
 	Response GetDHCPServerConfigurableResponse
 }
 
-var _ pkg1.Action = &GetDHCPServerConfigurable{}
+var _ pkg2.Action = &GetDHCPServerConfigurable{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetDHCPServerConfigurable) ServiceType() string { return ServiceType }
@@ -195,7 +197,7 @@ type GetDHCPServerConfigurableRequest struct{}
 // GetDHCPServerConfigurableResponse contains the "out" args for the "GetDHCPServerConfigurable" action.
 type GetDHCPServerConfigurableResponse struct {
 	// NewDHCPServerConfigurable relates to state variable DHCPServerConfigurable.
-	NewDHCPServerConfigurable pkg2.Boolean
+	NewDHCPServerConfigurable pkg4.Boolean
 }
 
 // GetDNSServers provides request and response for the action.
@@ -206,7 +208,7 @@ type GetDNSServers struct {
 	Response GetDNSServersResponse
 }
 
-var _ pkg1.Action = &GetDNSServers{}
+var _ pkg2.Action = &GetDNSServers{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetDNSServers) ServiceType() string { return ServiceType }
@@ -237,7 +239,7 @@ type GetDomainName struct {
 	Response GetDomainNameResponse
 }
 
-var _ pkg1.Action = &GetDomainName{}
+var _ pkg2.Action = &GetDomainName{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetDomainName) ServiceType() string { return ServiceType }
@@ -268,7 +270,7 @@ type GetIPRoutersList struct {
 	Response GetIPRoutersListResponse
 }
 
-var _ pkg1.Action = &GetIPRoutersList{}
+var _ pkg2.Action = &GetIPRoutersList{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetIPRoutersList) ServiceType() string { return ServiceType }
@@ -299,7 +301,7 @@ type GetReservedAddresses struct {
 	Response GetReservedAddressesResponse
 }
 
-var _ pkg1.Action = &GetReservedAddresses{}
+var _ pkg2.Action = &GetReservedAddresses{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetReservedAddresses) ServiceType() string { return ServiceType }
@@ -330,7 +332,7 @@ type GetSubnetMask struct {
 	Response GetSubnetMaskResponse
 }
 
-var _ pkg1.Action = &GetSubnetMask{}
+var _ pkg2.Action = &GetSubnetMask{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetSubnetMask) ServiceType() string { return ServiceType }
@@ -361,7 +363,7 @@ type SetAddressRange struct {
 	Response SetAddressRangeResponse
 }
 
-var _ pkg1.Action = &SetAddressRange{}
+var _ pkg2.Action = &SetAddressRange{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *SetAddressRange) ServiceType() string { return ServiceType }
@@ -394,7 +396,7 @@ type SetDHCPRelay struct {
 	Response SetDHCPRelayResponse
 }
 
-var _ pkg1.Action = &SetDHCPRelay{}
+var _ pkg2.Action = &SetDHCPRelay{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *SetDHCPRelay) ServiceType() string { return ServiceType }
@@ -411,7 +413,7 @@ func (a *SetDHCPRelay) RefResponse() any { return &a.Response }
 // SetDHCPRelayRequest contains the "in" args for the "SetDHCPRelay" action.
 type SetDHCPRelayRequest struct {
 	// NewDHCPRelay relates to state variable DHCPRelay.
-	NewDHCPRelay pkg2.Boolean
+	NewDHCPRelay pkg4.Boolean
 }
 
 // SetDHCPRelayResponse contains the "out" args for the "SetDHCPRelay" action.
@@ -425,7 +427,7 @@ type SetDHCPServerConfigurable struct {
 	Response SetDHCPServerConfigurableResponse
 }
 
-var _ pkg1.Action = &SetDHCPServerConfigurable{}
+var _ pkg2.Action = &SetDHCPServerConfigurable{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *SetDHCPServerConfigurable) ServiceType() string { return ServiceType }
@@ -442,7 +444,7 @@ func (a *SetDHCPServerConfigurable) RefResponse() any { return &a.Response }
 // SetDHCPServerConfigurableRequest contains the "in" args for the "SetDHCPServerConfigurable" action.
 type SetDHCPServerConfigurableRequest struct {
 	// NewDHCPServerConfigurable relates to state variable DHCPServerConfigurable.
-	NewDHCPServerConfigurable pkg2.Boolean
+	NewDHCPServerConfigurable pkg4.Boolean
 }
 
 // SetDHCPServerConfigurableResponse contains the "out" args for the "SetDHCPServerConfigurable" action.
@@ -456,7 +458,7 @@ type SetDNSServer struct {
 	Response SetDNSServerResponse
 }
 
-var _ pkg1.Action = &SetDNSServer{}
+var _ pkg2.Action = &SetDNSServer{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *SetDNSServer) ServiceType() string { return ServiceType }
@@ -487,7 +489,7 @@ type SetDomainName struct {
 	Response SetDomainNameResponse
 }
 
-var _ pkg1.Action = &SetDomainName{}
+var _ pkg2.Action = &SetDomainName{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *SetDomainName) ServiceType() string { return ServiceType }
@@ -518,7 +520,7 @@ type SetIPRouter struct {
 	Response SetIPRouterResponse
 }
 
-var _ pkg1.Action = &SetIPRouter{}
+var _ pkg2.Action = &SetIPRouter{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *SetIPRouter) ServiceType() string { return ServiceType }
@@ -549,7 +551,7 @@ type SetReservedAddress struct {
 	Response SetReservedAddressResponse
 }
 
-var _ pkg1.Action = &SetReservedAddress{}
+var _ pkg2.Action = &SetReservedAddress{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *SetReservedAddress) ServiceType() string { return ServiceType }
@@ -580,7 +582,7 @@ type SetSubnetMask struct {
 	Response SetSubnetMaskResponse
 }
 
-var _ pkg1.Action = &SetSubnetMask{}
+var _ pkg2.Action = &SetSubnetMask{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *SetSubnetMask) ServiceType() string { return ServiceType }
@@ -602,3 +604,147 @@ type SetSubnetMaskRequest struct {
 
 // SetSubnetMaskResponse contains the "out" args for the "SetSubnetMask" action.
 type SetSubnetMaskResponse struct{}
+
+// Server is implemented by providers of the service, with a method that
+// performs each action.
+type Server interface {
+	// DeleteDNSServer performs the "DeleteDNSServer" action.
+	DeleteDNSServer(ctx pkg1.Context, req *DeleteDNSServerRequest, resp *DeleteDNSServerResponse) error
+	// DeleteIPRouter performs the "DeleteIPRouter" action.
+	DeleteIPRouter(ctx pkg1.Context, req *DeleteIPRouterRequest, resp *DeleteIPRouterResponse) error
+	// DeleteReservedAddress performs the "DeleteReservedAddress" action.
+	DeleteReservedAddress(ctx pkg1.Context, req *DeleteReservedAddressRequest, resp *DeleteReservedAddressResponse) error
+	// GetAddressRange performs the "GetAddressRange" action.
+	GetAddressRange(ctx pkg1.Context, req *GetAddressRangeRequest, resp *GetAddressRangeResponse) error
+	// GetDHCPRelay performs the "GetDHCPRelay" action.
+	GetDHCPRelay(ctx pkg1.Context, req *GetDHCPRelayRequest, resp *GetDHCPRelayResponse) error
+	// GetDHCPServerConfigurable performs the "GetDHCPServerConfigurable" action.
+	GetDHCPServerConfigurable(ctx pkg1.Context, req *GetDHCPServerConfigurableRequest, resp *GetDHCPServerConfigurableResponse) error
+	// GetDNSServers performs the "GetDNSServers" action.
+	GetDNSServers(ctx pkg1.Context, req *GetDNSServersRequest, resp *GetDNSServersResponse) error
+	// GetDomainName performs the "GetDomainName" action.
+	GetDomainName(ctx pkg1.Context, req *GetDomainNameRequest, resp *GetDomainNameResponse) error
+	// GetIPRoutersList performs the "GetIPRoutersList" action.
+	GetIPRoutersList(ctx pkg1.Context, req *GetIPRoutersListRequest, resp *GetIPRoutersListResponse) error
+	// GetReservedAddresses performs the "GetReservedAddresses" action.
+	GetReservedAddresses(ctx pkg1.Context, req *GetReservedAddressesRequest, resp *GetReservedAddressesResponse) error
+	// GetSubnetMask performs the "GetSubnetMask" action.
+	GetSubnetMask(ctx pkg1.Context, req *GetSubnetMaskRequest, resp *GetSubnetMaskResponse) error
+	// SetAddressRange performs the "SetAddressRange" action.
+	SetAddressRange(ctx pkg1.Context, req *SetAddressRangeRequest, resp *SetAddressRangeResponse) error
+	// SetDHCPRelay performs the "SetDHCPRelay" action.
+	SetDHCPRelay(ctx pkg1.Context, req *SetDHCPRelayRequest, resp *SetDHCPRelayResponse) error
+	// SetDHCPServerConfigurable performs the "SetDHCPServerConfigurable" action.
+	SetDHCPServerConfigurable(ctx pkg1.Context, req *SetDHCPServerConfigurableRequest, resp *SetDHCPServerConfigurableResponse) error
+	// SetDNSServer performs the "SetDNSServer" action.
+	SetDNSServer(ctx pkg1.Context, req *SetDNSServerRequest, resp *SetDNSServerResponse) error
+	// SetDomainName performs the "SetDomainName" action.
+	SetDomainName(ctx pkg1.Context, req *SetDomainNameRequest, resp *SetDomainNameResponse) error
+	// SetIPRouter performs the "SetIPRouter" action.
+	SetIPRouter(ctx pkg1.Context, req *SetIPRouterRequest, resp *SetIPRouterResponse) error
+	// SetReservedAddress performs the "SetReservedAddress" action.
+	SetReservedAddress(ctx pkg1.Context, req *SetReservedAddressRequest, resp *SetReservedAddressResponse) error
+	// SetSubnetMask performs the "SetSubnetMask" action.
+	SetSubnetMask(ctx pkg1.Context, req *SetSubnetMaskRequest, resp *SetSubnetMaskResponse) error
+}
+
+// Dispatcher implements "github.com/huin/goupnp/v2alpha/soap/server".Service, calling the method of
+// Server for each action.
+type Dispatcher struct {
+	Server Server
+}
+
+var _ pkg3.Service = Dispatcher{}
+
+// ServiceType implements "github.com/huin/goupnp/v2alpha/soap/server".Service.
+func (d Dispatcher) ServiceType() string { return ServiceType }
+
+// NewAction implements "github.com/huin/goupnp/v2alpha/soap/server".Service.
+func (d Dispatcher) NewAction(actionName string) pkg2.Action {
+	switch actionName {
+	case "DeleteDNSServer":
+		return &DeleteDNSServer{}
+	case "DeleteIPRouter":
+		return &DeleteIPRouter{}
+	case "DeleteReservedAddress":
+		return &DeleteReservedAddress{}
+	case "GetAddressRange":
+		return &GetAddressRange{}
+	case "GetDHCPRelay":
+		return &GetDHCPRelay{}
+	case "GetDHCPServerConfigurable":
+		return &GetDHCPServerConfigurable{}
+	case "GetDNSServers":
+		return &GetDNSServers{}
+	case "GetDomainName":
+		return &GetDomainName{}
+	case "GetIPRoutersList":
+		return &GetIPRoutersList{}
+	case "GetReservedAddresses":
+		return &GetReservedAddresses{}
+	case "GetSubnetMask":
+		return &GetSubnetMask{}
+	case "SetAddressRange":
+		return &SetAddressRange{}
+	case "SetDHCPRelay":
+		return &SetDHCPRelay{}
+	case "SetDHCPServerConfigurable":
+		return &SetDHCPServerConfigurable{}
+	case "SetDNSServer":
+		return &SetDNSServer{}
+	case "SetDomainName":
+		return &SetDomainName{}
+	case "SetIPRouter":
+		return &SetIPRouter{}
+	case "SetReservedAddress":
+		return &SetReservedAddress{}
+	case "SetSubnetMask":
+		return &SetSubnetMask{}
+	}
+	return nil
+}
+
+// Perform implements "github.com/huin/goupnp/v2alpha/soap/server".Service.
+func (d Dispatcher) Perform(ctx pkg1.Context, action pkg2.Action) error {
+	switch a := action.(type) {
+	case *DeleteDNSServer:
+		return d.Server.DeleteDNSServer(ctx, &a.Request, &a.Response)
+	case *DeleteIPRouter:
+		return d.Server.DeleteIPRouter(ctx, &a.Request, &a.Response)
+	case *DeleteReservedAddress:
+		return d.Server.DeleteReservedAddress(ctx, &a.Request, &a.Response)
+	case *GetAddressRange:
+		return d.Server.GetAddressRange(ctx, &a.Request, &a.Response)
+	case *GetDHCPRelay:
+		return d.Server.GetDHCPRelay(ctx, &a.Request, &a.Response)
+	case *GetDHCPServerConfigurable:
+		return d.Server.GetDHCPServerConfigurable(ctx, &a.Request, &a.Response)
+	case *GetDNSServers:
+		return d.Server.GetDNSServers(ctx, &a.Request, &a.Response)
+	case *GetDomainName:
+		return d.Server.GetDomainName(ctx, &a.Request, &a.Response)
+	case *GetIPRoutersList:
+		return d.Server.GetIPRoutersList(ctx, &a.Request, &a.Response)
+	case *GetReservedAddresses:
+		return d.Server.GetReservedAddresses(ctx, &a.Request, &a.Response)
+	case *GetSubnetMask:
+		return d.Server.GetSubnetMask(ctx, &a.Request, &a.Response)
+	case *SetAddressRange:
+		return d.Server.SetAddressRange(ctx, &a.Request, &a.Response)
+	case *SetDHCPRelay:
+		return d.Server.SetDHCPRelay(ctx, &a.Request, &a.Response)
+	case *SetDHCPServerConfigurable:
+		return d.Server.SetDHCPServerConfigurable(ctx, &a.Request, &a.Response)
+	case *SetDNSServer:
+		return d.Server.SetDNSServer(ctx, &a.Request, &a.Response)
+	case *SetDomainName:
+		return d.Server.SetDomainName(ctx, &a.Request, &a.Response)
+	case *SetIPRouter:
+		return d.Server.SetIPRouter(ctx, &a.Request, &a.Response)
+	case *SetReservedAddress:
+		return d.Server.SetReservedAddress(ctx, &a.Request, &a.Response)
+	case *SetSubnetMask:
+		return d.Server.SetSubnetMask(ctx, &a.Request, &a.Response)
+	}
+	return &pkg3.UPnPError{Code: 401, Description: "Invalid Action"}
+}
@@ -4,8 +4,10 @@
 package wanpppconn1
 
 import (
-	pkg1 "github.com/huin/goupnp/v2alpha/soap"
-	pkg2 "github.com/huin/goupnp/v2alpha/soap/types"
+	pkg1 "context"
+	pkg2 "github.com/huin/goupnp/v2alpha/soap"
+	pkg3 "github.com/huin/goupnp/v2alpha/soap/server"
+	pkg4 "github.com/huin/goupnp/v2alpha/soap/types"
 )
 
 // Allowed values for state variable ConnectionStatus.
@@ -47,7 +49,7 @@ type AddPortMapping struct {
 	Response AddPortMappingResponse
 }
 
-var _ pkg1.Action = &AddPortMapping{}
+var _ pkg2.Action = &AddPortMapping{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *AddPortMapping) ServiceType() string { return ServiceType }
@@ -66,19 +68,19 @@ type AddPortMappingRequest struct {
 	// NewRemoteHost relates to state variable RemoteHost.
 	NewRemoteHost string
 	// NewExternalPort relates to state variable ExternalPort.
-	NewExternalPort pkg2.UI2
+	NewExternalPort pkg4.UI2
 	// NewProtocol relates to state variable PortMappingProtocol (2 standard allowed values).
 	NewProtocol string
 	// NewInternalPort relates to state variable InternalPort.
-	NewInternalPort pkg2.UI2
+	NewInternalPort pkg4.UI2
 	// NewInternalClient relates to state variable InternalClient.
 	NewInternalClient string
 	// NewEnabled relates to state variable PortMappingEnabled.
-	NewEnabled pkg2.Boolean
+	NewEnabled pkg4.Boolean
 	// NewPortMappingDescription relates to state variable PortMappingDescription.
 	NewPortMappingDescription string
 	// NewLeaseDuration relates to state variable PortMappingLeaseDuration.
-	NewLeaseDuration pkg2.UI4
+	NewLeaseDuration pkg4.UI4
 }
 
 // AddPortMappingResponse contains the "out" args for the "AddPortMapping" action.
@@ -92,7 +94,7 @@ type ConfigureConnection struct {
 	Response ConfigureConnectionResponse
 }
 
-var _ pkg1.Action = &ConfigureConnection{}
+var _ pkg2.Action = &ConfigureConnection{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *ConfigureConnection) ServiceType() string { return ServiceType }
@@ -125,7 +127,7 @@ type DeletePortMapping struct {
 	Response DeletePortMappingResponse
 }
 
-var _ pkg1.Action = &DeletePortMapping{}
+var _ pkg2.Action = &DeletePortMapping{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *DeletePortMapping) ServiceType() string { return ServiceType }
@@ -144,7 +146,7 @@ type DeletePortMappingRequest struct {
 	// NewRemoteHost relates to state variable RemoteHost.
 	NewRemoteHost string
 	// NewExternalPort relates to state variable ExternalPort.
-	NewExternalPort pkg2.UI2
+	NewExternalPort pkg4.UI2
 	// NewProtocol relates to state variable PortMappingProtocol (2 standard allowed values).
 	NewProtocol string
 }
@@ -160,7 +162,7 @@ type ForceTermination struct {
 	Response ForceTerminationResponse
 }
 
-var _ pkg1.Action = &ForceTermination{}
+var _ pkg2.Action = &ForceTermination{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *ForceTermination) ServiceType() string { return ServiceType }
@@ -188,7 +190,7 @@ type GetAutoDisconnectTime struct {
 	Response GetAutoDisconnectTimeResponse
 }
 
-var _ pkg1.Action = &GetAutoDisconnectTime{}
+var _ pkg2.Action = &GetAutoDisconnectTime{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetAutoDisconnectTime) ServiceType() string { return ServiceType }
@@ -208,7 +210,7 @@ type GetAutoDisconnectTimeRequest struct{}
 // GetAutoDisconnectTimeResponse contains the "out" args for the "GetAutoDisconnectTime" action.
 type GetAutoDisconnectTimeResponse struct {
 	// NewAutoDisconnectTime relates to state variable AutoDisconnectTime.
-	NewAutoDisconnectTime pkg2.UI4
+	NewAutoDisconnectTime pkg4.UI4
 }
 
 // GetConnectionTypeInfo provides request and response for the action.
@@ -219,7 +221,7 @@ type GetConnectionTypeInfo struct {
 	Response GetConnectionTypeInfoResponse
 }
 
-var _ pkg1.Action = &GetConnectionTypeInfo{}
+var _ pkg2.Action = &GetConnectionTypeInfo{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetConnectionTypeInfo) ServiceType() string { return ServiceType }
@@ -252,7 +254,7 @@ type GetExternalIPAddress struct {
 	Response GetExternalIPAddressResponse
 }
 
-var _ pkg1.Action = &GetExternalIPAddress{}
+var _ pkg2.Action = &GetExternalIPAddress{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetExternalIPAddress) ServiceType() string { return ServiceType }
@@ -283,7 +285,7 @@ type GetGenericPortMappingEntry struct {
 	Response GetGenericPortMappingEntryResponse
 }
 
-var _ pkg1.Action = &GetGenericPortMappingEntry{}
+var _ pkg2.Action = &GetGenericPortMappingEntry{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetGenericPortMappingEntry) ServiceType() string { return ServiceType }
@@ -300,7 +302,7 @@ func (a *GetGenericPortMappingEntry) RefResponse() any { return &a.Response }
 // GetGenericPortMappingEntryRequest contains the "in" args for the "GetGenericPortMappingEntry" action.
 type GetGenericPortMappingEntryRequest struct {
 	// NewPortMappingIndex relates to state variable PortMappingNumberOfEntries.
-	NewPortMappingIndex pkg2.UI2
+	NewPortMappingIndex pkg4.UI2
 }
 
 // GetGenericPortMappingEntryResponse contains the "out" args for the "GetGenericPortMappingEntry" action.
@@ -308,19 +310,19 @@ type GetGenericPortMappingEntryResponse struct {
 	// NewRemoteHost relates to state variable RemoteHost.
 	NewRemoteHost string
 	// NewExternalPort relates to state variable ExternalPort.
-	NewExternalPort pkg2.UI2
+	NewExternalPort pkg4.UI2
 	// NewProtocol relates to state variable PortMappingProtocol (2 standard allowed values).
 	NewProtocol string
 	// NewInternalPort relates to state variable InternalPort.
-	NewInternalPort pkg2.UI2
+	NewInternalPort pkg4.UI2
 	// NewInternalClient relates to state variable InternalClient.
 	NewInternalClient string
 	// NewEnabled relates to state variable PortMappingEnabled.
-	NewEnabled pkg2.Boolean
+	NewEnabled pkg4.Boolean
 	// NewPortMappingDescription relates to state variable PortMappingDescription.
 	NewPortMappingDescription string
 	// NewLeaseDuration relates to state variable PortMappingLeaseDuration.
-	NewLeaseDuration pkg2.UI4
+	NewLeaseDuration pkg4.UI4
 }
 
 // GetIdleDisconnectTime provides request and response for the action.
@@ -331,7 +333,7 @@ type GetIdleDisconnectTime struct {
 	Response GetIdleDisconnectTimeResponse
 }
 
-var _ pkg1.Action = &GetIdleDisconnectTime{}
+var _ pkg2.Action = &GetIdleDisconnectTime{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetIdleDisconnectTime) ServiceType() string { return ServiceType }
@@ -351,7 +353,7 @@ type GetIdleDisconnectTimeRequest struct{}
 // GetIdleDisconnectTimeResponse contains the "out" args for the "GetIdleDisconnectTime" action.
 type GetIdleDisconnectTimeResponse struct {
 	// NewIdleDisconnectTime relates to state variable IdleDisconnectTime.
-	NewIdleDisconnectTime pkg2.UI4
+	NewIdleDisconnectTime pkg4.UI4
 }
 
 // GetLinkLayerMaxBitRates provides request and response for the action.
@@ -362,7 +364,7 @@ type GetLinkLayerMaxBitRates struct {
 	Response GetLinkLayerMaxBitRatesResponse
 }
 
-var _ pkg1.Action = &GetLinkLayerMaxBitRates{}
+var _ pkg2.Action = &GetLinkLayerMaxBitRates{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetLinkLayerMaxBitRates) ServiceType() string { return ServiceType }
@@ -382,9 +384,9 @@ type GetLinkLayerMaxBitRatesRequest struct{}
 // GetLinkLayerMaxBitRatesResponse contains the "out" args for the "GetLinkLayerMaxBitRates" action.
 type GetLinkLayerMaxBitRatesResponse struct {
 	// NewUpstreamMaxBitRate relates to state variable UpstreamMaxBitRate.
-	NewUpstreamMaxBitRate pkg2.UI4
+	NewUpstreamMaxBitRate pkg4.UI4
 	// NewDownstreamMaxBitRate relates to state variable DownstreamMaxBitRate.
-	NewDownstreamMaxBitRate pkg2.UI4
+	NewDownstreamMaxBitRate pkg4.UI4
 }
 
 // GetNATRSIPStatus provides request and response for the action.
@@ -395,7 +397,7 @@ type GetNATRSIPStatus struct {
 	Response GetNATRSIPStatusResponse
 }
 
-var _ pkg1.Action = &GetNATRSIPStatus{}
+var _ pkg2.Action = &GetNATRSIPStatus{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetNATRSIPStatus) ServiceType() string { return ServiceType }
@@ -415,9 +417,9 @@ type GetNATRSIPStatusRequest struct{}
 // GetNATRSIPStatusResponse contains the "out" args for the "GetNATRSIPStatus" action.
 type GetNATRSIPStatusResponse struct {
 	// NewRSIPAvailable relates to state variable RSIPAvailable.
-	NewRSIPAvailable pkg2.Boolean
+	NewRSIPAvailable pkg4.Boolean
 	// NewNATEnabled relates to state variable NATEnabled.
-	NewNATEnabled pkg2.Boolean
+	NewNATEnabled pkg4.Boolean
 }
 
 // GetPPPAuthenticationProtocol provides request and response for the action.
@@ -428,7 +430,7 @@ type GetPPPAuthenticationProtocol struct {
 	Response GetPPPAuthenticationProtocolResponse
 }
 
-var _ pkg1.Action = &GetPPPAuthenticationProtocol{}
+var _ pkg2.Action = &GetPPPAuthenticationProtocol{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetPPPAuthenticationProtocol) ServiceType() string { return ServiceType }
@@ -459,7 +461,7 @@ type GetPPPCompressionProtocol struct {
 	Response GetPPPCompressionProtocolResponse
 }
 
-var _ pkg1.Action = &GetPPPCompressionProtocol{}
+var _ pkg2.Action = &GetPPPCompressionProtocol{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetPPPCompressionProtocol) ServiceType() string { return ServiceType }
@@ -490,7 +492,7 @@ type GetPPPEncryptionProtocol struct {
 	Response GetPPPEncryptionProtocolResponse
 }
 
-var _ pkg1.Action = &GetPPPEncryptionProtocol{}
+var _ pkg2.Action = &GetPPPEncryptionProtocol{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetPPPEncryptionProtocol) ServiceType() string { return ServiceType }
@@ -521,7 +523,7 @@ type GetPassword struct {
 	Response GetPasswordResponse
 }
 
-var _ pkg1.Action = &GetPassword{}
+var _ pkg2.Action = &GetPassword{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetPassword) ServiceType() string { return ServiceType }
@@ -552,7 +554,7 @@ type GetSpecificPortMappingEntry struct {
 	Response GetSpecificPortMappingEntryResponse
 }
 
-var _ pkg1.Action = &GetSpecificPortMappingEntry{}
+var _ pkg2.Action = &GetSpecificPortMappingEntry{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetSpecificPortMappingEntry) ServiceType() string { return ServiceType }
@@ -571,7 +573,7 @@ type GetSpecificPortMappingEntryRequest struct {
 	// NewRemoteHost relates to state variable RemoteHost.
 	NewRemoteHost string
 	// NewExternalPort relates to state variable ExternalPort.
-	NewExternalPort pkg2.UI2
+	NewExternalPort pkg4.UI2
 	// NewProtocol relates to state variable PortMappingProtocol (2 standard allowed values).
 	NewProtocol string
 }
@@ -579,15 +581,15 @@ type GetSpecificPortMappingEntryRequest struct {
 // GetSpecificPortMappingEntryResponse contains the "out" args for the "GetSpecificPortMappingEntry" action.
 type GetSpecificPortMappingEntryResponse struct {
 	// NewInternalPort relates to state variable InternalPort.
-	NewInternalPort pkg2.UI2
+	NewInternalPort pkg4.UI2
 	// NewInternalClient relates to state variable InternalClient.
 	NewInternalClient string
 	// NewEnabled relates to state variable PortMappingEnabled.
-	NewEnabled pkg2.Boolean
+	NewEnabled pkg4.Boolean
 	// NewPortMappingDescription relates to state variable PortMappingDescription.
 	NewPortMappingDescription string
 	// NewLeaseDuration relates to state variable PortMappingLeaseDuration.
-	NewLeaseDuration pkg2.UI4
+	NewLeaseDuration pkg4.UI4
 }
 
 // GetStatusInfo provides request and response for the action.
@@ -598,7 +600,7 @@ type GetStatusInfo struct {
 	Response GetStatusInfoResponse
 }
 
-var _ pkg1.Action = &GetStatusInfo{}
+var _ pkg2.Action = &GetStatusInfo{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetStatusInfo) ServiceType() string { return ServiceType }
@@ -622,7 +624,7 @@ type GetStatusInfoResponse struct {
 	// NewLastConnectionError relates to state variable LastConnectionError (1 standard allowed values).
 	NewLastConnectionError string
 	// NewUptime relates to state variable Uptime.
-	NewUptime pkg2.UI4
+	NewUptime pkg4.UI4
 }
 
 // GetUserName provides request and response for the action.
@@ -633,7 +635,7 @@ type GetUserName struct {
 	Response GetUserNameResponse
 }
 
-var _ pkg1.Action = &GetUserName{}
+var _ pkg2.Action = &GetUserName{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetUserName) ServiceType() string { return ServiceType }
@@ -664,7 +666,7 @@ type GetWarnDisconnectDelay struct {
 	Response GetWarnDisconnectDelayResponse
 }
 
-var _ pkg1.Action = &GetWarnDisconnectDelay{}
+var _ pkg2.Action = &GetWarnDisconnectDelay{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *GetWarnDisconnectDelay) ServiceType() string { return ServiceType }
@@ -684,7 +686,7 @@ type GetWarnDisconnectDelayRequest struct{}
 // GetWarnDisconnectDelayResponse contains the "out" args for the "GetWarnDisconnectDelay" action.
 type GetWarnDisconnectDelayResponse struct {
 	// NewWarnDisconnectDelay relates to state variable WarnDisconnectDelay.
-	NewWarnDisconnectDelay pkg2.UI4
+	NewWarnDisconnectDelay pkg4.UI4
 }
 
 // RequestConnection provides request and response for the action.
@@ -695,7 +697,7 @@ type RequestConnection struct {
 	Response RequestConnectionResponse
 }
 
-var _ pkg1.Action = &RequestConnection{}
+var _ pkg2.Action = &RequestConnection{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *RequestConnection) ServiceType() string { return ServiceType }
@@ -723,7 +725,7 @@ type RequestTermination struct {
 	Response RequestTerminationResponse
 }
 
-var _ pkg1.Action = &RequestTermination{}
+var _ pkg2.Action = &RequestTermination{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *RequestTermination) ServiceType() string { return ServiceType }
@@ -751,7 +753,7 @@ type SetAutoDisconnectTime struct {
 	Response SetAutoDisconnectTimeResponse
 }
 
-var _ pkg1.Action = &SetAutoDisconnectTime{}
+var _ pkg2.Action = &SetAutoDisconnectTime{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *SetAutoDisconnectTime) ServiceType() string { return ServiceType }
@@ -768,7 +770,7 @@ func (a *SetAutoDisconnectTime) RefResponse() any { return &a.Response }
 // SetAutoDisconnectTimeRequest contains the "in" args for the "SetAutoDisconnectTime" action.
 type SetAutoDisconnectTimeRequest struct {
 	// NewAutoDisconnectTime relates to state variable AutoDisconnectTime.
-	NewAutoDisconnectTime pkg2.UI4
+	NewAutoDisconnectTime pkg4.UI4
 }
 
 // SetAutoDisconnectTimeResponse contains the "out" args for the "SetAutoDisconnectTime" action.
@@ -782,7 +784,7 @@ type SetConnectionType struct {
 	Response SetConnectionTypeResponse
 }
 
-var _ pkg1.Action = &SetConnectionType{}
+var _ pkg2.Action = &SetConnectionType{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *SetConnectionType) ServiceType() string { return ServiceType }
@@ -813,7 +815,7 @@ type SetIdleDisconnectTime struct {
 	Response SetIdleDisconnectTimeResponse
 }
 
-var _ pkg1.Action = &SetIdleDisconnectTime{}
+var _ pkg2.Action = &SetIdleDisconnectTime{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *SetIdleDisconnectTime) ServiceType() string { return ServiceType }
@@ -830,7 +832,7 @@ func (a *SetIdleDisconnectTime) RefResponse() any { return &a.Response }
 // SetIdleDisconnectTimeRequest contains the "in" args for the "SetIdleDisconnectTime" action.
 type SetIdleDisconnectTimeRequest struct {
 	// NewIdleDisconnectTime relates to state variable IdleDisconnectTime.
-	NewIdleDisconnectTime pkg2.UI4
+	NewIdleDisconnectTime pkg4.UI4
 }
 
 // SetIdleDisconnectTimeResponse contains the "out" args for the "SetIdleDisconnectTime" action.
@@ -844,7 +846,7 @@ type SetWarnDisconnectDelay struct {
 	Response SetWarnDisconnectDelayResponse
 }
 
-var _ pkg1.Action = &SetWarnDisconnectDelay{}
+var _ pkg2.Action = &SetWarnDisconnectDelay{}
 
 // ServiceType implements "github.com/huin/goupnp/v2alpha/soap".Action.
 func (a *SetWarnDisconnectDelay) ServiceType() string { return ServiceType }
@@ -861,8 +863,188 @@ func (a *SetWarnDisconnectDelay) RefResponse() any { return &a.Response }
 // SetWarnDisconnectDelayRequest contains the "in" args for the "SetWarnDisconnectDelay" action.
 type SetWarnDisconnectDelayRequest struct {
 	// NewWarnDisconnectDelay relates to state variable WarnDisconnectDelay.
-	NewWarnDisconnectDelay pkg2.UI4
+	NewWarnDisconnectDelay pkg4.UI4
 }
 
 // SetWarnDisconnectDelayResponse contains the "out" args for the "SetWarnDisconnectDelay" action.
 type SetWarnDisconnectDelayResponse struct{}
+
+// Server is implemented by providers of the service, with a method that
+// performs each action.
+type Server interface {
+	// AddPortMapping performs the "AddPortMapping" action.
+	AddPortMapping(ctx pkg1.Context, req *AddPortMappingRequest, resp *AddPortMappingResponse) error
+	// ConfigureConnection performs the "ConfigureConnection" action.
+	ConfigureConnection(ctx pkg1.Context, req *ConfigureConnectionRequest, resp *ConfigureConnectionResponse) error
+	// DeletePortMapping performs the "DeletePortMapping" action.
+	DeletePortMapping(ctx pkg1.Context, req *DeletePortMappingRequest, resp *DeletePortMappingResponse) error
+	// ForceTermination performs the "ForceTermination" action.
+	ForceTermination(ctx pkg1.Context, req *ForceTerminationRequest, resp *ForceTerminationResponse) error
+	// GetAutoDisconnectTime performs the "GetAutoDisconnectTime" action.
+	GetAutoDisconnectTime(ctx pkg1.Context, req *GetAutoDisconnectTimeRequest, resp *GetAutoDisconnectTimeResponse) error
+	// GetConnectionTypeInfo performs the "GetConnectionTypeInfo" action.
+	GetConnectionTypeInfo(ctx pkg1.Context, req *GetConnectionTypeInfoRequest, resp *GetConnectionTypeInfoResponse) error
+	// GetExternalIPAddress performs the "GetExternalIPAddress" action.
+	GetExternalIPAddress(ctx pkg1.Context, req *GetExternalIPAddressRequest, resp *GetExternalIPAddressResponse) error
+	// GetGenericPortMappingEntry performs the "GetGenericPortMappingEntry" action.
+	GetGenericPortMappingEntry(ctx pkg1.Context, req *GetGenericPortMappingEntryRequest, resp *GetGenericPortMappingEntryResponse) error
+	// GetIdleDisconnectTime performs the "GetIdleDisconnectTime" action.
+	GetIdleDisconnectTime(ctx pkg1.Context, req *GetIdleDisconnectTimeRequest, resp *GetIdleDisconnectTimeResponse) error
+	// GetLinkLayerMaxBitRates performs the "GetLinkLayerMaxBitRates" action.
+	GetLinkLayerMaxBitRates(ctx pkg1.Context, req *GetLinkLayerMaxBitRatesRequest, resp *GetLinkLayerMaxBitRatesResponse) error
+	// GetNATRSIPStatus performs the "GetNATRSIPStatus" action.
+	GetNATRSIPStatus(ctx pkg1.Context, req *GetNATRSIPStatusRequest, resp *GetNATRSIPStatusResponse) error
+	// GetPPPAuthenticationProtocol performs the "GetPPPAuthenticationProtocol" action.
+	GetPPPAuthenticationProtocol(ctx pkg1.Context, req *GetPPPAuthenticationProtocolRequest, resp *GetPPPAuthenticationProtocolResponse) error
+	// GetPPPCompressionProtocol performs the "GetPPPCompressionProtocol" action.
+	GetPPPCompressionProtocol(ctx pkg1.Context, req *GetPPPCompressionProtocolRequest, resp *GetPPPCompressionProtocolResponse) error
+	// GetPPPEncryptionProtocol performs the "GetPPPEncryptionProtocol" action.
+	GetPPPEncryptionProtocol(ctx pkg1.Context, req *GetPPPEncryptionProtocolRequest, resp *GetPPPEncryptionProtocolResponse) error
+	// GetPassword performs the "GetPassword" action.
+	GetPassword(ctx pkg1.Context, req *GetPasswordRequest, resp *GetPasswordResponse) error
+	// GetSpecificPortMappingEntry performs the "GetSpecificPortMappingEntry" action.
+	GetSpecificPortMappingEntry(ctx pkg1.Context, req *GetSpecificPortMappingEntryRequest, resp *GetSpecificPortMappingEntryResponse) error
+	// GetStatusInfo performs the "GetStatusInfo" action.
+	GetStatusInfo(ctx pkg1.Context, req *GetStatusInfoRequest, resp *GetStatusInfoResponse) error
+	// GetUserName performs the "GetUserName" action.
+	GetUserName(ctx pkg1.Context, req *GetUserNameRequest, resp *GetUserNameResponse) error
+	// GetWarnDisconnectDelay performs the "GetWarnDisconnectDelay" action.
+	GetWarnDisconnectDelay(ctx pkg1.Context, req *GetWarnDisconnectDelayRequest, resp *GetWarnDisconnectDelayResponse) error
+	// RequestConnection performs the "RequestConnection" action.
+	RequestConnection(ctx pkg1.Context, req *RequestConnectionRequest, resp *RequestConnectionResponse) error
+	// RequestTermination performs the "RequestTermination" action.
+	RequestTermination(ctx pkg1.Context, req *RequestTerminationRequest, resp *RequestTerminationResponse) error
+	// SetAutoDisconnectTime performs the "SetAutoDisconnectTime" action.
+	SetAutoDisconnectTime(ctx pkg1.Context, req *SetAutoDisconnectTimeRequest, resp *SetAutoDisconnectTimeResponse) error
+	// SetConnectionType performs the "SetConnectionType" action.
+	SetConnectionType(ctx pkg1.Context, req *SetConnectionTypeRequest, resp *SetConnectionTypeResponse) error
+	// SetIdleDisconnectTime performs the "SetIdleDisconnectTime" action.
+	SetIdleDisconnectTime(ctx pkg1.Context, req *SetIdleDisconnectTimeRequest, resp *SetIdleDisconnectTimeResponse) error
+	// SetWarnDisconnectDelay performs the "SetWarnDisconnectDelay" action.
+	SetWarnDisconnectDelay(ctx pkg1.Context, req *SetWarnDisconnectDelayRequest, resp *SetWarnDisconnectDelayResponse) error
+}
+
+// Dispatcher implements "github.com/huin/goupnp/v2alpha/soap/server".Service, calling the method of
+// Server for each action.
+type Dispatcher struct {
+	Server Server
+}
+
+var _ pkg3.Service = Dispatcher{}
+
+// ServiceType implements "github.com/huin/goupnp/v2alpha/soap/server".Service.
+func (d Dispatcher) ServiceType() string { return ServiceType }
+
+// NewAction implements "github.com/huin/goupnp/v2alpha/soap/server".Service.
+func (d Dispatcher) NewAction(actionName string) pkg2.Action {
+	switch actionName {
+	case "AddPortMapping":
+		return &AddPortMapping{}
+	case "ConfigureConnection":
+		return &ConfigureConnection{}
+	case "DeletePortMapping":
+		return &DeletePortMapping{}
+	case "ForceTermination":
+		return &ForceTermination{}
+	case "GetAutoDisconnectTime":
+		return &GetAutoDisconnectTime{}
+	case "GetConnectionTypeInfo":
+		return &GetConnectionTypeInfo{}
+	case "GetExternalIPAddress":
+		return &GetExternalIPAddress{}
+	case "GetGenericPortMappingEntry":
+		return &GetGenericPortMappingEntry{}
+	case "GetIdleDisconnectTime":
+		return &GetIdleDisconnectTime{}
+	case "GetLinkLayerMaxBitRates":
+		return &GetLinkLayerMaxBitRates{}
+	case "GetNATRSIPStatus":
+		return &GetNATRSIPStatus{}
+	case "GetPPPAuthenticationProtocol":
+		return &GetPPPAuthenticationProtocol{}
+	case "GetPPPCompressionProtocol":
+		return &GetPPPCompressionProtocol{}
+	case "GetPPPEncryptionProtocol":
+		return &GetPPPEncryptionProtocol{}
+	case "GetPassword":
+		return &GetPassword{}
+	case "GetSpecificPortMappingEntry":
+		return &GetSpecificPortMappingEntry{}
+	case "GetStatusInfo":
+		return &GetStatusInfo{}
+	case "GetUserName":
+		return &GetUserName{}
+	case "GetWarnDisconnectDelay":
+		return &GetWarnDisconnectDelay{}
+	case "RequestConnection":
+		return &RequestConnection{}
+	case "RequestTermination":
+		return &RequestTermination{}
+	case "SetAutoDisconnectTime":
+		return &SetAutoDisconnectTime{}
+	case "SetConnectionType":
+		return &SetConnectionType{}
+	case "SetIdleDisconnectTime":
+		return &SetIdleDisconnectTime{}
+	case "SetWarnDisconnectDelay":
+		return &SetWarnDisconnectDelay{}
+	}
+	return nil
+}
+
+// Perform implements "github.com/huin/goupnp/v2alpha/soap/server".Service.
+func (d Dispatcher) Perform(ctx pkg1.Context, action pkg2.Action) error {
+	switch a := action.(type) {
+	case *AddPortMapping:
+		return d.Server.AddPortMapping(ctx, &a.Request, &a.Response)
+	case *ConfigureConnection:
+		return d.Server.ConfigureConnection(ctx, &a.Request, &a.Response)
+	case *DeletePortMapping:
+		return d.Server.DeletePortMapping(ctx, &a.Request, &a.Response)
+	case *ForceTermination:
+		return d.Server.ForceTermination(ctx, &a.Request, &a.Response)
+	case *GetAutoDisconnectTime:
+		return d.Server.GetAutoDisconnectTime(ctx, &a.Request, &a.Response)
+	case *GetConnectionTypeInfo:
+		return d.Server.GetConnectionTypeInfo(ctx, &a.Request, &a.Response)
+	case *GetExternalIPAddress:
+		return d.Server.GetExternalIPAddress(ctx, &a.Request, &a.Response)
+	case *GetGenericPortMappingEntry:
+		return d.Server.GetGenericPortMappingEntry(ctx, &a.Request, &a.Response)
+	case *GetIdleDisconnectTime:
+		return d.Server.GetIdleDisconnectTime(ctx, &a.Request, &a.Response)
+	case *GetLinkLayerMaxBitRates:
+		return d.Server.GetLinkLayerMaxBitRates(ctx, &a.Request, &a.Response)
+	case *GetNATRSIPStatus:
+		return d.Server.GetNATRSIPStatus(ctx, &a.Request, &a.Response)
+	case *GetPPPAuthenticationProtocol:
+		return d.Server.GetPPPAuthenticationProtocol(ctx, &a.Request, &a.Response)
+	case *GetPPPCompressionProtocol:
+		return d.Server.GetPPPCompressionProtocol(ctx, &a.Request, &a.Response)
+	case *GetPPPEncryptionProtocol:
+		return d.Server.GetPPPEncryptionProtocol(ctx, &a.Request, &a.Response)
+	case *GetPassword:
+		return d.Server.GetPassword(ctx, &a.Request, &a.Response)
+	case *GetSpecificPortMappingEntry:
+		return d.Server.GetSpecificPortMappingEntry(ctx, &a.Request, &a.Response)
+	case *GetStatusInfo:
+		return d.Server.GetStatusInfo(ctx, &a.Request, &a.Response)
+	case *GetUserName:
+		return d.Server.GetUserName(ctx, &a.Request, &a.Response)
+	case *GetWarnDisconnectDelay:
+		return d.Server.GetWarnDisconnectDelay(ctx, &a.Request, &a.Response)
+	case *RequestConnection:
+		return d.Server.RequestConnection(ctx, &a.Request, &a.Response)
+	case *RequestTermination:
+		return d.Server.RequestTermination(ctx, &a.Request, &a.Response)
+	case *SetAutoDisconnectTime:
+		return d.Server.SetAutoDisconnectTime(ctx, &a.Request, &a.Response)
+	case *SetConnectionType:
+		return d.Server.SetConnectionType(ctx, &a.Request, &a.Response)
+	case *SetIdleDisconnectTime:
+		return d.Server.SetIdleDisconnectTime(ctx, &a.Request, &a.Response)
+	case *SetWarnDisconnectDelay:
+		return d.Server.SetWarnDisconnectDelay(ctx, &a.Request, &a.Response)
+	}
+	return &pkg3.UPnPError{Code: 401, Description: "Invalid Action"}
+}